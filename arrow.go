@@ -0,0 +1,487 @@
+package gohive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+// Metadata version, message headers, types and units from the Arrow format specification, Schema.fbs and Message.fbs
+const (
+	arrowMetadataV5 int16 = 4
+
+	arrowHeaderSchema      byte = 1
+	arrowHeaderRecordBatch byte = 3
+
+	arrowTypeNull          byte = 1
+	arrowTypeInt           byte = 2
+	arrowTypeFloatingPoint byte = 3
+	arrowTypeBinary        byte = 4
+	arrowTypeUtf8          byte = 5
+	arrowTypeBool          byte = 6
+	arrowTypeDecimal       byte = 7
+	arrowTypeDate          byte = 8
+	arrowTypeTimestamp     byte = 10
+
+	arrowPrecisionSingle int16 = 1
+	arrowPrecisionDouble int16 = 2
+	arrowDateDay         int16 = 0
+	arrowTimeMicrosecond int16 = 2
+)
+
+// arrowContinuation starts every message of a stream, the end of the stream is followed by a zero length
+var arrowContinuation = []byte{0xff, 0xff, 0xff, 0xff}
+
+// WriteArrowIPC fetches all the remaining rows of the cursor and writes them to w in the Arrow IPC streaming format,
+// a schema followed by a record batch per batch fetched from the server. HiveServer2 sends Thrift columns, which
+// are converted: BOOLEAN to Bool, TINYINT, SMALLINT, INT and BIGINT to signed Int of 8 to 64 bits, FLOAT and DOUBLE
+// to FloatingPoint, DECIMAL to a 128 bits Decimal with the precision and scale of the column, DATE to Date in days,
+// TIMESTAMP to Timestamp in microseconds without time zone, TIMESTAMP WITH LOCAL TIME ZONE to Timestamp in
+// microseconds in UTC, BINARY to Binary and NULL to Null. STRING, VARCHAR, CHAR, the intervals and the complex types
+// are written as Utf8, with the text returned by the server. All the fields are nullable.
+func (c *Cursor) WriteArrowIPC(ctx context.Context, w io.Writer) error {
+	schema := c.schema(ctx)
+	if c.Err != nil {
+		return c.Err
+	}
+	writer := newArrowWriter(w, schema)
+	if err := writer.writeSchema(); err != nil {
+		return err
+	}
+	for c.HasMore(ctx) {
+		if c.Err != nil {
+			return c.Err
+		}
+		if len(c.queue) != len(writer.columns) {
+			return errors.Errorf("%d columns were received but the schema has %d", len(c.queue), len(writer.columns))
+		}
+		if err := writer.writeBatch(c.queue, c.columnIndex, c.totalRows); err != nil {
+			return err
+		}
+		c.consumeRows(c.totalRows)
+	}
+	if c.Err != nil {
+		return c.Err
+	}
+	return writer.close()
+}
+
+// ArrowIPCReader runs the query and returns its result in the Arrow IPC streaming format, see WriteArrowIPC. The
+// rows are fetched as the stream is read, each batch of FetchSize rows is a record batch. Closing the reader before
+// the end stops fetching, the cursor must not be used until then.
+func (c *Cursor) ArrowIPCReader(ctx context.Context, query string) (io.ReadCloser, error) {
+	c.Execute(ctx, query, false)
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	reader, writer := io.Pipe()
+	stream := &arrowStream{PipeReader: reader}
+	stream.done.Add(1)
+	go func() {
+		defer stream.done.Done()
+		writer.CloseWithError(c.WriteArrowIPC(ctx, writer))
+	}()
+	return stream, nil
+}
+
+// arrowStream is the reader returned by ArrowIPCReader, closing it waits until the cursor stops fetching
+type arrowStream struct {
+	*io.PipeReader
+	done sync.WaitGroup
+}
+
+func (s *arrowStream) Close() error {
+	err := s.PipeReader.Close()
+	s.done.Wait()
+	return err
+}
+
+type arrowColumn struct {
+	name      string
+	hiveType  hiveserver.TTypeId
+	arrowType byte
+	// Type table of the field in the schema
+	typeTable fbTable
+	// Bytes of the values of fixed width types, 0 for the others
+	width int
+	scale int32
+
+	validity []byte
+	values   bytes.Buffer
+	offsets  []byte
+	rows     int
+	nulls    int
+}
+
+type arrowWriter struct {
+	w       *bufio.Writer
+	columns []*arrowColumn
+}
+
+func newArrowWriter(w io.Writer, schema []*hiveserver.TColumnDesc) *arrowWriter {
+	writer := &arrowWriter{w: bufio.NewWriter(w)}
+	for _, desc := range schema {
+		column := &arrowColumn{name: desc.ColumnName, arrowType: arrowTypeUtf8, typeTable: fbTable{}}
+		entry := primitiveEntry(desc)
+		if entry != nil {
+			column.hiveType = entry.Type
+		} else {
+			column.hiveType = hiveserver.TTypeId_STRING_TYPE
+		}
+		switch column.hiveType {
+		case hiveserver.TTypeId_BOOLEAN_TYPE:
+			column.arrowType = arrowTypeBool
+		case hiveserver.TTypeId_TINYINT_TYPE:
+			column.arrowType, column.width = arrowTypeInt, 1
+		case hiveserver.TTypeId_SMALLINT_TYPE:
+			column.arrowType, column.width = arrowTypeInt, 2
+		case hiveserver.TTypeId_INT_TYPE:
+			column.arrowType, column.width = arrowTypeInt, 4
+		case hiveserver.TTypeId_BIGINT_TYPE:
+			column.arrowType, column.width = arrowTypeInt, 8
+		case hiveserver.TTypeId_FLOAT_TYPE:
+			column.arrowType, column.width = arrowTypeFloatingPoint, 4
+			column.typeTable = fbTable{fbInt16(arrowPrecisionSingle)}
+		case hiveserver.TTypeId_DOUBLE_TYPE:
+			column.arrowType, column.width = arrowTypeFloatingPoint, 8
+			column.typeTable = fbTable{fbInt16(arrowPrecisionDouble)}
+		case hiveserver.TTypeId_DECIMAL_TYPE:
+			var precision int32
+			precision, column.scale = decimalPrecisionScale(entry)
+			column.arrowType, column.width = arrowTypeDecimal, 16
+			column.typeTable = fbTable{fbInt32(precision), fbInt32(column.scale), fbInt32(128)}
+		case hiveserver.TTypeId_DATE_TYPE:
+			column.arrowType, column.width = arrowTypeDate, 4
+			column.typeTable = fbTable{fbInt16(arrowDateDay)}
+		case hiveserver.TTypeId_TIMESTAMP_TYPE:
+			column.arrowType, column.width = arrowTypeTimestamp, 8
+			column.typeTable = fbTable{fbInt16(arrowTimeMicrosecond)}
+		case hiveserver.TTypeId_TIMESTAMPLOCALTZ_TYPE:
+			column.arrowType, column.width = arrowTypeTimestamp, 8
+			column.typeTable = fbTable{fbInt16(arrowTimeMicrosecond), fbString("UTC")}
+		case hiveserver.TTypeId_BINARY_TYPE:
+			column.arrowType = arrowTypeBinary
+		case hiveserver.TTypeId_NULL_TYPE:
+			column.arrowType = arrowTypeNull
+		}
+		if column.arrowType == arrowTypeInt {
+			column.typeTable = fbTable{fbInt32(int32(8 * column.width)), fbBool(true)}
+		}
+		writer.columns = append(writer.columns, column)
+	}
+	return writer
+}
+
+// writeSchema writes the schema message, the first of the stream
+func (a *arrowWriter) writeSchema() error {
+	fields := make(fbTables, len(a.columns))
+	for i, column := range a.columns {
+		// name, nullable, the type and the children, which readers require even if empty
+		fields[i] = fbTable{fbString(column.name), fbBool(true), fbUint8(column.arrowType), column.typeTable, nil, fbTables{}}
+	}
+	return a.writeMessage(arrowHeaderSchema, fbTable{fbInt16(0), fields}, nil)
+}
+
+// writeBatch writes the rows in [from, to) of the columns fetched from the server as a record batch
+func (a *arrowWriter) writeBatch(columns []*hiveserver.TColumn, from int, to int) error {
+	if to <= from {
+		return nil
+	}
+	var body, nodes, buffers []byte
+	addBuffer := func(b []byte) {
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(body)))
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(b)))
+		body = append(body, b...)
+		body = append(body, make([]byte, padding(len(body), 8))...)
+	}
+	for i, column := range a.columns {
+		column.reset()
+		for position := from; position < to; position++ {
+			if err := column.appendValue(columnValue(columns[i], position)); err != nil {
+				return errors.Wrapf(err, "column %s", column.name)
+			}
+		}
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(column.rows))
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(column.nulls))
+		if column.arrowType == arrowTypeNull {
+			continue
+		}
+		if column.nulls == 0 {
+			addBuffer(nil)
+		} else {
+			addBuffer(column.validity)
+		}
+		if column.offsets != nil {
+			addBuffer(column.offsets)
+		}
+		addBuffer(column.values.Bytes())
+	}
+	batch := fbTable{fbInt64(int64(to - from)), fbStructs{count: len(nodes) / 16, data: nodes}, fbStructs{count: len(buffers) / 16, data: buffers}}
+	return a.writeMessage(arrowHeaderRecordBatch, batch, body)
+}
+
+// writeMessage writes the message with the header and the body, whose length is a multiple of 8
+func (a *arrowWriter) writeMessage(headerType byte, header fbTable, body []byte) error {
+	metadata := fbEncode(fbTable{fbInt16(arrowMetadataV5), fbUint8(headerType), header, fbInt64(int64(len(body)))})
+	// The body starts aligned to 8 bytes, after the continuation and the length
+	metadata = append(metadata, make([]byte, padding(len(metadata)+8, 8))...)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(metadata)))
+	for _, b := range [][]byte{arrowContinuation, length[:], metadata, body} {
+		if _, err := a.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close writes the end of the stream
+func (a *arrowWriter) close() error {
+	if _, err := a.w.Write(append(arrowContinuation, 0, 0, 0, 0)); err != nil {
+		return err
+	}
+	return a.w.Flush()
+}
+
+// padding returns the number of bytes after n up to the next multiple of alignment
+func padding(n int, alignment int) int {
+	return (alignment - n%alignment) % alignment
+}
+
+func (column *arrowColumn) reset() {
+	column.validity = column.validity[:0]
+	column.values.Reset()
+	column.offsets = nil
+	if column.arrowType == arrowTypeUtf8 || column.arrowType == arrowTypeBinary {
+		column.offsets = make([]byte, 4, 4*256)
+	}
+	column.rows = 0
+	column.nulls = 0
+}
+
+// appendValue appends the value of the next row, nil for NULL
+func (column *arrowColumn) appendValue(value interface{}) error {
+	row := column.rows
+	column.rows++
+	if row%8 == 0 {
+		column.validity = append(column.validity, 0)
+		if column.arrowType == arrowTypeBool {
+			column.values.WriteByte(0)
+		}
+	}
+	if value == nil || column.arrowType == arrowTypeNull {
+		column.nulls++
+		if column.width > 0 {
+			column.values.Write(make([]byte, column.width))
+		}
+		column.appendOffset()
+		return nil
+	}
+	column.validity[row/8] |= 1 << (row % 8)
+
+	var buf [16]byte
+	switch v := value.(type) {
+	case bool:
+		if v {
+			column.values.Bytes()[row/8] |= 1 << (row % 8)
+		}
+	case int8:
+		column.values.WriteByte(byte(v))
+	case int16:
+		binary.LittleEndian.PutUint16(buf[:2], uint16(v))
+		column.values.Write(buf[:2])
+	case int32:
+		binary.LittleEndian.PutUint32(buf[:4], uint32(v))
+		column.values.Write(buf[:4])
+	case int64:
+		binary.LittleEndian.PutUint64(buf[:8], uint64(v))
+		column.values.Write(buf[:8])
+	case float64:
+		if column.width == 4 {
+			binary.LittleEndian.PutUint32(buf[:4], math.Float32bits(float32(v)))
+			column.values.Write(buf[:4])
+		} else {
+			binary.LittleEndian.PutUint64(buf[:8], math.Float64bits(v))
+			column.values.Write(buf[:8])
+		}
+	case []byte:
+		column.values.Write(v)
+	case string:
+		switch column.arrowType {
+		case arrowTypeDate:
+			days, err := dateDays(v)
+			if err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint32(buf[:4], uint32(days))
+			column.values.Write(buf[:4])
+		case arrowTypeTimestamp:
+			timestamp, err := ParseTimestamp(v, time.UTC)
+			if err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint64(buf[:8], uint64(timestamp.UnixMicro()))
+			column.values.Write(buf[:8])
+		case arrowTypeDecimal:
+			unscaled, err := decimalToFixedBytes(v, column.scale, 16)
+			if err != nil {
+				return err
+			}
+			// Arrow decimals are little endian
+			for i := range unscaled {
+				buf[i] = unscaled[len(unscaled)-1-i]
+			}
+			column.values.Write(buf[:16])
+		default:
+			column.values.WriteString(v)
+		}
+	default:
+		return errors.Errorf("unexpected value %v of type %T", value, value)
+	}
+	column.appendOffset()
+	return nil
+}
+
+// appendOffset appends the end of the value of the row for the variable length types
+func (column *arrowColumn) appendOffset() {
+	if column.offsets != nil {
+		column.offsets = binary.LittleEndian.AppendUint32(column.offsets, uint32(column.values.Len()))
+	}
+}
+
+// fbTable is a flatbuffers table to encode with fbEncode, with the values of its fields in the order of their ids
+// and nil for the absent ones. The values are fbScalar, fbString, fbTable, fbTables or fbStructs.
+type fbTable []interface{}
+
+// fbScalar is the little endian value of a scalar field, stored in the table
+type fbScalar []byte
+
+// fbString is a string referenced by the table
+type fbString string
+
+// fbTables is a vector of tables referenced by the table
+type fbTables []fbTable
+
+// fbStructs is a vector of structs referenced by the table, which are aligned to 8 bytes
+type fbStructs struct {
+	count int
+	data  []byte
+}
+
+func fbUint8(v byte) fbScalar {
+	return fbScalar{v}
+}
+
+func fbBool(v bool) fbScalar {
+	if v {
+		return fbScalar{1}
+	}
+	return fbScalar{0}
+}
+
+func fbInt16(v int16) fbScalar {
+	return binary.LittleEndian.AppendUint16(nil, uint16(v))
+}
+
+func fbInt32(v int32) fbScalar {
+	return binary.LittleEndian.AppendUint32(nil, uint32(v))
+}
+
+func fbInt64(v int64) fbScalar {
+	return binary.LittleEndian.AppendUint64(nil, uint64(v))
+}
+
+// fbEncode returns the flatbuffer with the table as its root. The objects are written after the ones referencing
+// them, each table after its vtable.
+func fbEncode(root fbTable) []byte {
+	e := &fbEncoder{buf: make([]byte, 4, 256)}
+	binary.LittleEndian.PutUint32(e.buf, uint32(e.table(root)))
+	return e.buf
+}
+
+type fbEncoder struct {
+	buf []byte
+}
+
+func (e *fbEncoder) align(alignment int) {
+	e.buf = append(e.buf, make([]byte, padding(len(e.buf), alignment))...)
+}
+
+// table writes the vtable and the table followed by the objects it references, it returns the position of the table
+func (e *fbEncoder) table(t fbTable) int {
+	// The fields follow the offset to the vtable, each one aligned to its size
+	offsets := make([]int, len(t))
+	size, alignment := 4, 4
+	for i, value := range t {
+		if value == nil {
+			continue
+		}
+		width := 4
+		if scalar, ok := value.(fbScalar); ok {
+			width = len(scalar)
+		}
+		size += padding(size, width)
+		offsets[i] = size
+		size += width
+		alignment = max(alignment, width)
+	}
+	e.align(2)
+	vtable := len(e.buf)
+	e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(4+2*len(t)))
+	e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(size))
+	for _, offset := range offsets {
+		e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(offset))
+	}
+	e.align(alignment)
+	position := len(e.buf)
+	e.buf = append(e.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(e.buf[position:], uint32(position-vtable))
+	for i, value := range t {
+		switch value := value.(type) {
+		case nil:
+		case fbScalar:
+			copy(e.buf[position+offsets[i]:], value)
+		default:
+			e.reference(position+offsets[i], value)
+		}
+	}
+	return position
+}
+
+// reference writes the object and sets the offset at slot to it
+func (e *fbEncoder) reference(slot int, value interface{}) {
+	var target int
+	switch value := value.(type) {
+	case fbTable:
+		target = e.table(value)
+	case fbString:
+		e.align(4)
+		target = len(e.buf)
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(len(value)))
+		e.buf = append(append(e.buf, value...), 0)
+	case fbTables:
+		e.align(4)
+		target = len(e.buf)
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(len(value)))
+		slots := len(e.buf)
+		e.buf = append(e.buf, make([]byte, 4*len(value))...)
+		for i, table := range value {
+			e.reference(slots+4*i, table)
+		}
+	case fbStructs:
+		// The length precedes the structs
+		e.buf = append(e.buf, make([]byte, padding(len(e.buf)+4, 8))...)
+		target = len(e.buf)
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(value.count))
+		e.buf = append(e.buf, value.data...)
+	}
+	binary.LittleEndian.PutUint32(e.buf[slot:], uint32(target-slot))
+}
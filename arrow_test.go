@@ -0,0 +1,363 @@
+package gohive
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+// arrowMessage is a message of an Arrow IPC stream read by readArrowStream
+type arrowMessage struct {
+	metadata []byte
+	// Position of the header table in metadata
+	header     int
+	headerType byte
+	body       []byte
+}
+
+// readArrowStream splits the stream in messages, checking their framing and alignment
+func readArrowStream(t *testing.T, stream []byte) []arrowMessage {
+	var messages []arrowMessage
+	for {
+		if len(stream) < 8 || !bytes.Equal(stream[:4], arrowContinuation) {
+			t.Fatalf("Expected a continuation, got %v", stream)
+		}
+		length := int(binary.LittleEndian.Uint32(stream[4:8]))
+		if length == 0 {
+			if len(stream) != 8 {
+				t.Fatalf("Unexpected data after the end of the stream %v", stream[8:])
+			}
+			return messages
+		}
+		if (8+length)%8 != 0 {
+			t.Fatalf("The metadata length %d doesn't align the body", length)
+		}
+		metadata := stream[8 : 8+length]
+		message := fbRoot(metadata)
+		if version := int16(fbUint16(metadata, fbField(metadata, message, 0))); version != arrowMetadataV5 {
+			t.Fatalf("Unexpected version %d", version)
+		}
+		bodyLength := int(binary.LittleEndian.Uint64(metadata[fbField(metadata, message, 3):]))
+		if bodyLength%8 != 0 {
+			t.Fatalf("The body length %d isn't a multiple of 8", bodyLength)
+		}
+		messages = append(messages, arrowMessage{
+			metadata:   metadata,
+			header:     fbReference(metadata, fbField(metadata, message, 2)),
+			headerType: metadata[fbField(metadata, message, 1)],
+			body:       stream[8+length : 8+length+bodyLength],
+		})
+		stream = stream[8+length+bodyLength:]
+	}
+}
+
+func fbUint16(buf []byte, position int) uint16 {
+	return binary.LittleEndian.Uint16(buf[position:])
+}
+
+func fbUint32(buf []byte, position int) int {
+	return int(binary.LittleEndian.Uint32(buf[position:]))
+}
+
+func fbRoot(buf []byte) int {
+	return fbUint32(buf, 0)
+}
+
+// fbField returns the position of the field of the table, 0 if it's absent
+func fbField(buf []byte, table int, id int) int {
+	vtable := table - int(int32(binary.LittleEndian.Uint32(buf[table:])))
+	if 4+2*id >= int(fbUint16(buf, vtable)) {
+		return 0
+	}
+	offset := int(fbUint16(buf, vtable+4+2*id))
+	if offset == 0 {
+		return 0
+	}
+	return table + offset
+}
+
+func fbReference(buf []byte, position int) int {
+	return position + fbUint32(buf, position)
+}
+
+// fbVector returns the position of the elements of the vector field and their number
+func fbVector(buf []byte, table int, id int) (int, int) {
+	vector := fbReference(buf, fbField(buf, table, id))
+	return vector + 4, fbUint32(buf, vector)
+}
+
+func fbStringField(buf []byte, table int, id int) string {
+	start, length := fbVector(buf, table, id)
+	return string(buf[start : start+length])
+}
+
+func TestWriteArrowIPC(t *testing.T) {
+	decimal := parquetColumnDesc("amount", hiveserver.TTypeId_DECIMAL_TYPE)
+	precision, scale := int32(12), int32(2)
+	decimal.TypeDesc.Types[0].PrimitiveEntry.TypeQualifiers = &hiveserver.TTypeQualifiers{Qualifiers: map[string]*hiveserver.TTypeQualifierValue{
+		hiveserver.PRECISION: {I32Value: &precision},
+		hiveserver.SCALE:     {I32Value: &scale},
+	}}
+	schema := []*hiveserver.TColumnDesc{
+		parquetColumnDesc("id", hiveserver.TTypeId_INT_TYPE),
+		parquetColumnDesc("name", hiveserver.TTypeId_STRING_TYPE),
+		decimal,
+		parquetColumnDesc("flag", hiveserver.TTypeId_BOOLEAN_TYPE),
+		parquetColumnDesc("day", hiveserver.TTypeId_DATE_TYPE),
+		parquetColumnDesc("at", hiveserver.TTypeId_TIMESTAMP_TYPE),
+		parquetColumnDesc("ratio", hiveserver.TTypeId_FLOAT_TYPE),
+		parquetColumnDesc("nothing", hiveserver.TTypeId_NULL_TYPE),
+	}
+	description := make([][]string, len(schema))
+	for i, column := range schema {
+		description[i] = []string{column.ColumnName, primitiveEntry(column).Type.String()}
+	}
+	cursor := &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: description,
+		columns:     schema,
+		queue: []*hiveserver.TColumn{
+			{I32Val: &hiveserver.TI32Column{Values: []int32{1, 2, 3}, Nulls: []byte{}}},
+			{StringVal: &hiveserver.TStringColumn{Values: []string{"a", "", "ccc"}, Nulls: []byte{2}}},
+			{StringVal: &hiveserver.TStringColumn{Values: []string{"1.5", "-2", "0.01"}, Nulls: []byte{}}},
+			{BoolVal: &hiveserver.TBoolColumn{Values: []bool{true, false, true}, Nulls: []byte{}}},
+			{StringVal: &hiveserver.TStringColumn{Values: []string{"1970-01-02", "1969-12-31", ""}, Nulls: []byte{4}}},
+			{StringVal: &hiveserver.TStringColumn{Values: []string{"1970-01-01 00:00:01.5", "", ""}, Nulls: []byte{6}}},
+			{DoubleVal: &hiveserver.TDoubleColumn{Values: []float64{0.5, 1, 2}, Nulls: []byte{}}},
+			{StringVal: &hiveserver.TStringColumn{Values: []string{"", "", ""}, Nulls: []byte{7}}},
+		},
+		totalRows: 3,
+	}
+
+	var stream bytes.Buffer
+	if err := cursor.WriteArrowIPC(context.Background(), &stream); err != nil {
+		t.Fatal(err)
+	}
+	messages := readArrowStream(t, stream.Bytes())
+	if len(messages) != 2 || messages[0].headerType != arrowHeaderSchema || messages[1].headerType != arrowHeaderRecordBatch {
+		t.Fatalf("Expected a schema and a record batch, got %d messages", len(messages))
+	}
+
+	metadata, header := messages[0].metadata, messages[0].header
+	fields, count := fbVector(metadata, header, 1)
+	if count != len(schema) {
+		t.Fatalf("Expected %d fields, got %d", len(schema), count)
+	}
+	types := []byte{arrowTypeInt, arrowTypeUtf8, arrowTypeDecimal, arrowTypeBool, arrowTypeDate, arrowTypeTimestamp, arrowTypeFloatingPoint, arrowTypeNull}
+	for i := 0; i < count; i++ {
+		field := fbReference(metadata, fields+4*i)
+		if name := fbStringField(metadata, field, 0); name != schema[i].ColumnName {
+			t.Errorf("Expected the field %s, got %s", schema[i].ColumnName, name)
+		}
+		if metadata[fbField(metadata, field, 1)] != 1 {
+			t.Errorf("Expected %s to be nullable", schema[i].ColumnName)
+		}
+		if typeID := metadata[fbField(metadata, field, 2)]; typeID != types[i] {
+			t.Errorf("Expected the type %d for %s, got %d", types[i], schema[i].ColumnName, typeID)
+		}
+		if _, children := fbVector(metadata, field, 5); children != 0 {
+			t.Errorf("Expected no children for %s", schema[i].ColumnName)
+		}
+		typeTable := fbReference(metadata, fbField(metadata, field, 3))
+		switch types[i] {
+		case arrowTypeInt:
+			if bitWidth := fbUint32(metadata, fbField(metadata, typeTable, 0)); bitWidth != 32 || metadata[fbField(metadata, typeTable, 1)] != 1 {
+				t.Errorf("Expected a signed int of 32 bits, got %d bits", bitWidth)
+			}
+		case arrowTypeDecimal:
+			if p, s := fbUint32(metadata, fbField(metadata, typeTable, 0)), fbUint32(metadata, fbField(metadata, typeTable, 1)); p != 12 || s != 2 {
+				t.Errorf("Expected decimal(12,2), got decimal(%d,%d)", p, s)
+			}
+		case arrowTypeTimestamp:
+			if unit := int16(fbUint16(metadata, fbField(metadata, typeTable, 0))); unit != arrowTimeMicrosecond || fbField(metadata, typeTable, 1) != 0 {
+				t.Errorf("Expected microseconds without time zone, got the unit %d", unit)
+			}
+		}
+	}
+
+	metadata, header = messages[1].metadata, messages[1].header
+	if length := binary.LittleEndian.Uint64(metadata[fbField(metadata, header, 0):]); length != 3 {
+		t.Fatalf("Expected 3 rows, got %d", length)
+	}
+	nodes, count := fbVector(metadata, header, 1)
+	if count != len(schema) || nodes%8 != 0 {
+		t.Fatalf("Expected %d aligned nodes, got %d at %d", len(schema), count, nodes)
+	}
+	nulls := []uint64{0, 1, 0, 0, 1, 2, 0, 3}
+	for i := 0; i < count; i++ {
+		node := nodes + 16*i
+		if length, n := binary.LittleEndian.Uint64(metadata[node:]), binary.LittleEndian.Uint64(metadata[node+8:]); length != 3 || n != nulls[i] {
+			t.Errorf("Expected 3 rows with %d NULL for %s, got %d with %d", nulls[i], schema[i].ColumnName, length, n)
+		}
+	}
+	start, count := fbVector(metadata, header, 2)
+	body := messages[1].body
+	var buffers [][]byte
+	for i := 0; i < count; i++ {
+		offset, length := binary.LittleEndian.Uint64(metadata[start+16*i:]), binary.LittleEndian.Uint64(metadata[start+16*i+8:])
+		if offset%8 != 0 {
+			t.Fatalf("The buffer %d isn't aligned", i)
+		}
+		buffers = append(buffers, body[offset:offset+length])
+	}
+	// Two buffers for the fixed width types and BOOLEAN, three for STRING and none for NULL
+	if len(buffers) != 2+3+2+2+2+2+2 {
+		t.Fatalf("Unexpected number of buffers %d", len(buffers))
+	}
+	expected := [][]byte{
+		{}, {1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0},
+		{5}, {0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 4, 0, 0, 0}, []byte("accc"),
+	}
+	for i, buffer := range expected {
+		if !bytes.Equal(buffers[i], buffer) {
+			t.Errorf("Expected the buffer %d to be %v, got %v", i, buffer, buffers[i])
+		}
+	}
+	decimals := buffers[6]
+	if len(decimals) != 48 || binary.LittleEndian.Uint64(decimals) != 150 || int64(binary.LittleEndian.Uint64(decimals[16:])) != -200 ||
+		binary.LittleEndian.Uint64(decimals[24:]) != math.MaxUint64 || binary.LittleEndian.Uint64(decimals[32:]) != 1 {
+		t.Errorf("Unexpected decimals %v", decimals)
+	}
+	if !reflect.DeepEqual(buffers[7:9], [][]byte{{}, {5}}) {
+		t.Errorf("Unexpected booleans %v", buffers[7:9])
+	}
+	if !bytes.Equal(buffers[9], []byte{3}) || int32(binary.LittleEndian.Uint32(buffers[10])) != 1 || int32(binary.LittleEndian.Uint32(buffers[10][4:])) != -1 {
+		t.Errorf("Unexpected dates %v %v", buffers[9], buffers[10])
+	}
+	if !bytes.Equal(buffers[11], []byte{1}) || binary.LittleEndian.Uint64(buffers[12]) != 1500000 {
+		t.Errorf("Unexpected timestamps %v %v", buffers[11], buffers[12])
+	}
+	if math.Float32frombits(binary.LittleEndian.Uint32(buffers[14][4:])) != 1 || len(buffers[14]) != 12 {
+		t.Errorf("Unexpected floats %v", buffers[14])
+	}
+}
+
+// arrowDecimalCursor returns a cursor with a DECIMAL(38,2) column of the values
+func arrowDecimalCursor(values []string) *Cursor {
+	column := parquetColumnDesc("amount", hiveserver.TTypeId_DECIMAL_TYPE)
+	precision, scale := int32(38), int32(2)
+	column.TypeDesc.Types[0].PrimitiveEntry.TypeQualifiers = &hiveserver.TTypeQualifiers{Qualifiers: map[string]*hiveserver.TTypeQualifierValue{
+		hiveserver.PRECISION: {I32Value: &precision},
+		hiveserver.SCALE:     {I32Value: &scale},
+	}}
+	return &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: [][]string{{"amount", "DECIMAL_TYPE"}},
+		columns:     []*hiveserver.TColumnDesc{column},
+		queue: []*hiveserver.TColumn{
+			{StringVal: &hiveserver.TStringColumn{Values: values, Nulls: []byte{}}},
+		},
+		totalRows: len(values),
+	}
+}
+
+func TestWriteArrowIPCDecimals(t *testing.T) {
+	// The values are 128 bits two's complement integers in little endian, given here as their high and low words
+	tests := []struct {
+		value string
+		high  int64
+		low   uint64
+	}{
+		{"1.005", 0, 101},
+		{"-0.00", 0, 0},
+		{"-0.004", 0, 0},
+		{"-0.005", -1, math.MaxUint64},
+		{"-2.5", -1, math.MaxUint64 - 249},
+		{"184467440737095516.16", 1, 0},
+		{"-184467440737095516.16", -1, 0},
+		{"-1701411834604692317316873037158841057.28", math.MinInt64, 0},
+	}
+	values := make([]string, len(tests))
+	for i, test := range tests {
+		values[i] = test.value
+	}
+	var stream bytes.Buffer
+	if err := arrowDecimalCursor(values).WriteArrowIPC(context.Background(), &stream); err != nil {
+		t.Fatal(err)
+	}
+	messages := readArrowStream(t, stream.Bytes())
+	metadata, header := messages[1].metadata, messages[1].header
+	start, count := fbVector(metadata, header, 2)
+	if count != 2 {
+		t.Fatalf("Expected the validity and values buffers, got %d", count)
+	}
+	offset, length := binary.LittleEndian.Uint64(metadata[start+16:]), binary.LittleEndian.Uint64(metadata[start+24:])
+	decimals := messages[1].body[offset : offset+length]
+	if len(decimals) != 16*len(tests) {
+		t.Fatalf("Expected %d bytes of decimals, got %d", 16*len(tests), len(decimals))
+	}
+	for i, test := range tests {
+		low, high := binary.LittleEndian.Uint64(decimals[16*i:]), int64(binary.LittleEndian.Uint64(decimals[16*i+8:]))
+		if low != test.low || high != test.high {
+			t.Errorf("Expected %d %d for %s, got %d %d", test.high, test.low, test.value, high, low)
+		}
+	}
+
+	// 2^127 doesn't fit
+	if err := arrowDecimalCursor([]string{"1701411834604692317316873037158841057.28"}).WriteArrowIPC(context.Background(), io.Discard); err == nil {
+		t.Fatal("Expected an overflow error")
+	}
+}
+
+func TestArrowIPCReader(t *testing.T) {
+	server := &operationHiveServer{rows: 5}
+	configuration := NewConnectConfiguration()
+	configuration.FetchSize = 2
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+
+	reader, err := cursor.ArrowIPCReader(context.Background(), "SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	messages := readArrowStream(t, stream)
+	// The schema and a record batch per batch of 2 rows
+	if len(messages) != 4 {
+		t.Fatalf("Expected 4 messages, got %d", len(messages))
+	}
+	var values []int32
+	for _, message := range messages[1:] {
+		start, _ := fbVector(message.metadata, message.header, 2)
+		offset, length := binary.LittleEndian.Uint64(message.metadata[start+16:]), binary.LittleEndian.Uint64(message.metadata[start+24:])
+		for i := offset; i < offset+length; i += 4 {
+			values = append(values, int32(binary.LittleEndian.Uint32(message.body[i:])))
+		}
+	}
+	if !reflect.DeepEqual(values, []int32{0, 1, 2, 3, 4}) {
+		t.Fatalf("Unexpected values %v", values)
+	}
+
+	// Closing the reader stops fetching
+	server.rows = 1000
+	reader, err = cursor.ArrowIPCReader(context.Background(), "SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reader.Read(make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+	fetches := server.fetches
+	reader.Close()
+	if server.fetches-fetches > 1 {
+		t.Fatalf("Expected the fetches to stop, %d more were made", server.fetches-fetches)
+	}
+}
@@ -0,0 +1,49 @@
+package gohive
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNull is returned by WriteBinary for NULL values
+var ErrNull = errors.New("gohive: the value is NULL")
+
+// WriteBinary writes the value of the BINARY column at index in the next row to w and advances the cursor one, for
+// exporting large values without copying them. It returns the number of bytes written, ErrNull if the value is NULL
+// and io.EOF when there are no more rows. The cursor isn't advanced if w fails, other errors are also left in Err.
+//
+// The server sends the rows in batches of FetchSize with the values whole, so the batch is held in memory while its
+// rows are read, like with the other accessors. WriteBinary releases each value once written instead of keeping it
+// until the next batch, with a FetchSize of 1 only one value is in memory at a time.
+func (c *Cursor) WriteBinary(ctx context.Context, index int, w io.Writer) (int64, error) {
+	if !c.HasMore(ctx) {
+		if c.Err != nil {
+			return 0, c.Err
+		}
+		return 0, io.EOF
+	}
+	if c.Err != nil {
+		return 0, c.Err
+	}
+	if index < 0 || index >= len(c.queue) {
+		return 0, errors.Errorf("Column %d doesn't exist, the result has %d columns", index, len(c.queue))
+	}
+	column := c.queue[index]
+	if !column.IsSetBinaryVal() {
+		return 0, errors.Errorf("Column %d isn't a binary column", index)
+	}
+	row := c.columnIndex
+	if isNull(column.BinaryVal.Nulls, row) {
+		c.consumeRows(row + 1)
+		return 0, ErrNull
+	}
+	n, err := w.Write(column.BinaryVal.Values[row])
+	if err != nil {
+		return int64(n), err
+	}
+	c.consumeRows(row + 1)
+	column.BinaryVal.Values[row] = nil
+	return int64(n), nil
+}
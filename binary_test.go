@@ -0,0 +1,61 @@
+package gohive
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestWriteBinary(t *testing.T) {
+	cursor := &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: [][]string{{"t.b", "BINARY_TYPE"}, {"t.n", "INT_TYPE"}},
+		queue: []*hiveserver.TColumn{
+			{BinaryVal: &hiveserver.TBinaryColumn{Values: [][]byte{[]byte("first blob"), nil, []byte("third")}, Nulls: []byte{2}}},
+			{I32Val: &hiveserver.TI32Column{Values: []int32{1, 2, 3}, Nulls: []byte{}}},
+		},
+		totalRows: 3,
+	}
+	ctx := context.Background()
+
+	if _, err := cursor.WriteBinary(ctx, 1, io.Discard); err == nil {
+		t.Fatal("Expected an error for an INT column")
+	}
+	if _, err := cursor.WriteBinary(ctx, 2, io.Discard); err == nil {
+		t.Fatal("Expected an error for a missing column")
+	}
+	if _, err := cursor.WriteBinary(ctx, 0, failingWriter{}); err == nil || cursor.columnIndex != 0 {
+		t.Fatalf("Expected the error of the writer without advancing, got %v at row %d", err, cursor.columnIndex)
+	}
+
+	var buffer bytes.Buffer
+	n, err := cursor.WriteBinary(ctx, 0, &buffer)
+	if err != nil || n != 10 || buffer.String() != "first blob" {
+		t.Fatalf("Expected the first value, got %d bytes %q, %v", n, buffer.String(), err)
+	}
+	if cursor.queue[0].BinaryVal.Values[0] != nil {
+		t.Fatal("Expected the written value to be released")
+	}
+	if _, err = cursor.WriteBinary(ctx, 0, &buffer); err != ErrNull {
+		t.Fatalf("Expected ErrNull for the NULL value, got %v", err)
+	}
+	buffer.Reset()
+	if _, err = cursor.WriteBinary(ctx, 0, &buffer); err != nil || buffer.String() != "third" {
+		t.Fatalf("Expected the third value, got %q, %v", buffer.String(), err)
+	}
+	if _, err = cursor.WriteBinary(ctx, 0, &buffer); err != io.EOF {
+		t.Fatalf("Expected io.EOF after the last row, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package gohive
+
+import (
+	"reflect"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+// bindableTypes are the types of the values of the columns, which Bind accepts
+var bindableTypes = map[reflect.Type]bool{
+	reflect.TypeOf(false):       true,
+	reflect.TypeOf(int8(0)):     true,
+	reflect.TypeOf(int16(0)):    true,
+	reflect.TypeOf(int32(0)):    true,
+	reflect.TypeOf(int64(0)):    true,
+	reflect.TypeOf(float32(0)):  true,
+	reflect.TypeOf(float64(0)):  true,
+	reflect.TypeOf(""):          true,
+	reflect.TypeOf([]byte(nil)): true,
+}
+
+// Bind declares the Go types of the columns of the next results read with FetchInto, one per column: bool, int8,
+// int16, int32, int64, float32 or float64 for FLOAT, float64 for DOUBLE, []byte for BINARY and string for the others.
+// FetchInto then sets the elements of dest to pointers to buffers of those types, reused for every row, instead of
+// storing the values, which doesn't allocate. For example an INT column is read as an *int32 and NULL values as nil.
+// The values pointed to are overwritten by the next row, copy the ones that are kept.
+//
+// The types are kept for the next queries and checked against the description of each result, FetchInto sets Err if
+// they don't match. Bind with no types reads the values as usual again.
+func (c *Cursor) Bind(types []reflect.Type) error {
+	if len(types) == 0 {
+		c.boundTypes = nil
+		c.bound = nil
+		return nil
+	}
+	bound := make([]interface{}, len(types))
+	for i, t := range types {
+		if !bindableTypes[t] {
+			return errors.Errorf("Column %d can't be bound to %v", i, t)
+		}
+		bound[i] = reflect.New(t).Interface()
+	}
+	c.boundTypes = append([]reflect.Type(nil), types...)
+	c.bound = bound
+	c.boundChecked = false
+	return nil
+}
+
+// checkBound returns an error if the bound types don't match the description of the result
+func (c *Cursor) checkBound(d [][]string) error {
+	if len(d) != len(c.boundTypes) {
+		return errors.Errorf("%d types are bound but the number of columns is %d", len(c.boundTypes), len(d))
+	}
+	for i, column := range d {
+		typeID, err := hiveserver.TTypeIdFromString(column[1])
+		if err != nil {
+			return errors.Errorf("Column %s has the unknown type %s", column[0], column[1])
+		}
+		expected := goType(typeID)
+		if typeID == hiveserver.TTypeId_FLOAT_TYPE && c.boundTypes[i] == reflect.TypeOf(float32(0)) {
+			expected = c.boundTypes[i]
+		}
+		if c.boundTypes[i] != expected {
+			return errors.Errorf("Column %s of type %s is bound to %v instead of %v", column[0], column[1], c.boundTypes[i], expected)
+		}
+	}
+	return nil
+}
+
+// fetchBound reads one row into the buffers of Bind, it's called by FetchInto
+func (c *Cursor) fetchBound(d [][]string, dest []interface{}) bool {
+	if !c.boundChecked {
+		if c.Err = c.checkBound(d); c.Err != nil {
+			return false
+		}
+		c.boundChecked = true
+	}
+	row := c.columnIndex
+	for i, column := range c.queue {
+		null := false
+		switch buffer := c.bound[i].(type) {
+		case *bool:
+			null = isNull(column.BoolVal.Nulls, row)
+			*buffer = column.BoolVal.Values[row]
+		case *int8:
+			null = isNull(column.ByteVal.Nulls, row)
+			*buffer = column.ByteVal.Values[row]
+		case *int16:
+			null = isNull(column.I16Val.Nulls, row)
+			*buffer = column.I16Val.Values[row]
+		case *int32:
+			null = isNull(column.I32Val.Nulls, row)
+			*buffer = column.I32Val.Values[row]
+		case *int64:
+			null = isNull(column.I64Val.Nulls, row)
+			*buffer = column.I64Val.Values[row]
+		case *float32:
+			null = isNull(column.DoubleVal.Nulls, row)
+			*buffer = float32(column.DoubleVal.Values[row])
+		case *float64:
+			null = isNull(column.DoubleVal.Nulls, row)
+			*buffer = column.DoubleVal.Values[row]
+		case *string:
+			null = isNull(column.StringVal.Nulls, row)
+			*buffer = column.StringVal.Values[row]
+			if d[i][1] == "DECIMAL_TYPE" {
+				*buffer = c.formatDecimal(i, *buffer)
+			}
+		case *[]byte:
+			null = isNull(column.BinaryVal.Nulls, row)
+			*buffer = column.BinaryVal.Values[row]
+		}
+		if null {
+			dest[i] = nil
+		} else {
+			dest[i] = c.bound[i]
+		}
+	}
+	c.consumeRows(row + 1)
+	return true
+}
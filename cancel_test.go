@@ -0,0 +1,203 @@
+package gohive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+// slowFetchHiveServer doesn't answer FetchResults after the first answered ones until release is closed
+type slowFetchHiveServer struct {
+	operationHiveServer
+	release  chan struct{}
+	answered int
+}
+
+func (s *slowFetchHiveServer) FetchResults(ctx context.Context, req *hiveserver.TFetchResultsReq) (*hiveserver.TFetchResultsResp, error) {
+	if s.fetches >= s.answered {
+		<-s.release
+	}
+	return s.operationHiveServer.FetchResults(ctx, req)
+}
+
+func TestCancelInFlightFetch(t *testing.T) {
+	server := &slowFetchHiveServer{operationHiveServer: operationHiveServer{rows: 3}, release: make(chan struct{})}
+	defer close(server.release)
+	configuration := NewConnectConfiguration()
+	configuration.InterruptOnCancel = true
+	connection := connectFakeHiveServer(t, server, configuration)
+	cursor := connection.Cursor()
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	cursor.HasMore(ctx)
+	if !errors.Is(cursor.Err, ErrConnectionInterrupted) {
+		t.Fatalf("Expected ErrConnectionInterrupted after the context was canceled, got %v", cursor.Err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("The fetch took %s to return after the context was canceled", elapsed)
+	}
+
+	// The socket is closed, so the connection and its other cursors can't be used anymore
+	other := connection.Cursor()
+	other.Exec(context.Background(), "SELECT 1")
+	if !errors.Is(other.Err, ErrConnectionInterrupted) {
+		t.Fatalf("Expected ErrConnectionInterrupted for the other cursors, got %v", other.Err)
+	}
+	cursor.Close()
+	if !errors.Is(cursor.Err, ErrConnectionInterrupted) {
+		t.Fatalf("Expected ErrConnectionInterrupted when closing the operation, got %v", cursor.Err)
+	}
+	if err := connection.Close(); !errors.Is(err, ErrConnectionInterrupted) {
+		t.Fatalf("Expected ErrConnectionInterrupted when closing the connection, got %v", err)
+	}
+}
+
+func TestCancelFetchWithoutInterrupt(t *testing.T) {
+	server := &slowFetchHiveServer{operationHiveServer: operationHiveServer{rows: 3}, release: make(chan struct{})}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+	cursor := connection.Cursor()
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+
+	// Without InterruptOnCancel the fetch waits for the server after the context is canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	time.AfterFunc(300*time.Millisecond, func() {
+		close(server.release)
+	})
+	cursor.HasMore(ctx)
+	if cursor.Err == nil {
+		t.Fatal("Expected an error after the context was canceled")
+	}
+	if errors.Is(cursor.Err, ErrConnectionInterrupted) {
+		t.Fatalf("The fetch was interrupted without InterruptOnCancel: %v", cursor.Err)
+	}
+
+	// The socket wasn't closed, so the connection can still be used
+	other := connection.Cursor()
+	other.Exec(context.Background(), "SELECT 1")
+	if other.Err != nil {
+		t.Fatal(other.Err)
+	}
+	other.Close()
+	cursor.Close()
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+}
+
+// slowMetadataHiveServer doesn't answer GetResultSetMetadata until release is closed
+type slowMetadataHiveServer struct {
+	operationHiveServer
+	release chan struct{}
+}
+
+func (s *slowMetadataHiveServer) GetResultSetMetadata(ctx context.Context, req *hiveserver.TGetResultSetMetadataReq) (*hiveserver.TGetResultSetMetadataResp, error) {
+	<-s.release
+	return s.operationHiveServer.GetResultSetMetadata(ctx, req)
+}
+
+func TestDescriptionContext(t *testing.T) {
+	server := &slowMetadataHiveServer{release: make(chan struct{})}
+	host, port := startFakeHiveServer(t, server)
+	t.Cleanup(func() {
+		close(server.release)
+	})
+	configuration := NewConnectConfiguration()
+	configuration.InterruptOnCancel = true
+	connection, err := Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	cursor := connection.Cursor()
+	cursor.Exec(context.Background(), "SELECT 1")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if description := cursor.DescriptionContext(ctx); description != nil || cursor.Err == nil {
+		t.Fatalf("Expected an error after the context was done, got %v", description)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("The metadata request took %s to return after the context was done", elapsed)
+	}
+}
+
+func TestCancelOnInterrupt(t *testing.T) {
+	server := &operationHiveServer{runningPolls: 1000}
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, stop := CancelOnInterrupt(context.Background())
+	defer stop()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if err := process.Signal(os.Interrupt); err != nil {
+			t.Error(err)
+		}
+	}()
+	cursor := connection.Cursor()
+	cursor.Exec(ctx, "SELECT * FROM t")
+	if cursor.Err == nil || ctx.Err() == nil {
+		t.Fatalf("Expected the query to be interrupted, got %v", cursor.Err)
+	}
+	if !server.canceled {
+		t.Fatal("The operation wasn't canceled in the server")
+	}
+	cursor.Close()
+}
+
+func TestConcurrentCursors(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.FetchSize = 7
+	configuration.PollIntervalInMillis = 1
+	connection := connectFakeHiveServer(t, &operationHiveServer{rows: 50}, configuration)
+	defer connection.Close()
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cursor := connection.Cursor()
+			defer cursor.Close()
+			cursor.Exec(context.Background(), "SELECT * FROM t")
+			for cursor.Err == nil && cursor.HasMore(context.Background()) {
+				var value int32
+				cursor.FetchOne(context.Background(), &value)
+			}
+			if cursor.Err != nil {
+				errs <- cursor.Err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,67 @@
+package gohive
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+)
+
+// decodeStrings converts the values of the string columns from the encoding to UTF-8, in place
+func decodeStrings(columns []*hiveserver.TColumn, charset encoding.Encoding) error {
+	decoder := charset.NewDecoder()
+	for i, column := range columns {
+		if !column.IsSetStringVal() {
+			continue
+		}
+		for j, value := range column.StringVal.Values {
+			decoded, err := decoder.String(value)
+			if err != nil {
+				return errors.Wrapf(err, "Can't decode the value of column %d", i)
+			}
+			column.StringVal.Values[j] = decoded
+		}
+	}
+	return nil
+}
+
+// InvalidUTF8 selects what is done with the values of the string columns that aren't valid UTF-8, for example
+// because of bad data ingested in a STRING column, which JSON encoders can't write
+type InvalidUTF8 int
+
+const (
+	// The values are returned as sent by the server
+	InvalidUTF8Keep InvalidUTF8 = iota
+	// Each invalid sequence is replaced with U+FFFD
+	InvalidUTF8Replace
+	// The fetch fails with ErrInvalidUTF8
+	InvalidUTF8Error
+)
+
+// ErrInvalidUTF8 is the cause of the error of the fetches of values that aren't valid UTF-8 with InvalidUTF8Error
+var ErrInvalidUTF8 = errors.New("gohive: the value isn't valid UTF-8")
+
+// checkUTF8 replaces the invalid UTF-8 sequences of the values of the string columns in place, or returns an error
+// for the first one, depending on mode
+func checkUTF8(columns []*hiveserver.TColumn, mode InvalidUTF8) error {
+	if mode == InvalidUTF8Keep {
+		return nil
+	}
+	for i, column := range columns {
+		if !column.IsSetStringVal() {
+			continue
+		}
+		for j, value := range column.StringVal.Values {
+			if utf8.ValidString(value) {
+				continue
+			}
+			if mode == InvalidUTF8Error {
+				return errors.Wrapf(ErrInvalidUTF8, "The value of column %d in the row %d of the batch", i, j)
+			}
+			column.StringVal.Values[j] = strings.ToValidUTF8(value, string(utf8.RuneError))
+		}
+	}
+	return nil
+}
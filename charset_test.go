@@ -0,0 +1,71 @@
+package gohive
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestCharset(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.Charset = charmap.ISO8859_1
+	cursor := &Cursor{conn: &Connection{configuration: configuration}}
+	response := &hiveserver.TFetchResultsResp{
+		Results: &hiveserver.TRowSet{Columns: []*hiveserver.TColumn{
+			{StringVal: &hiveserver.TStringColumn{Values: []string{"caf\xe9", "a"}, Nulls: []byte{}}},
+			{BinaryVal: &hiveserver.TBinaryColumn{Values: [][]byte{[]byte("caf\xe9"), nil}, Nulls: []byte{2}}},
+		}},
+	}
+	if err := cursor.parseResults(response); err != nil {
+		t.Fatal(err)
+	}
+	if values := cursor.queue[0].StringVal.Values; !reflect.DeepEqual(values, []string{"café", "a"}) {
+		t.Fatalf("Expected the strings to be decoded from Latin-1, got %q", values)
+	}
+	if value := cursor.queue[1].BinaryVal.Values[0]; string(value) != "caf\xe9" {
+		t.Fatalf("Expected the binary value to be kept, got %q", value)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	response := func() *hiveserver.TFetchResultsResp {
+		return &hiveserver.TFetchResultsResp{
+			Results: &hiveserver.TRowSet{Columns: []*hiveserver.TColumn{
+				{StringVal: &hiveserver.TStringColumn{Values: []string{"ok", "bad\xff\xfeend", "ñ"}, Nulls: []byte{}}},
+				{BinaryVal: &hiveserver.TBinaryColumn{Values: [][]byte{{0xff}, nil, nil}, Nulls: []byte{6}}},
+			}},
+		}
+	}
+	tests := []struct {
+		mode     InvalidUTF8
+		expected []string
+	}{
+		{InvalidUTF8Keep, []string{"ok", "bad\xff\xfeend", "ñ"}},
+		{InvalidUTF8Replace, []string{"ok", "bad�end", "ñ"}},
+	}
+	for _, test := range tests {
+		configuration := NewConnectConfiguration()
+		configuration.InvalidUTF8 = test.mode
+		cursor := &Cursor{conn: &Connection{configuration: configuration}}
+		if err := cursor.parseResults(response()); err != nil {
+			t.Fatal(err)
+		}
+		if values := cursor.queue[0].StringVal.Values; !reflect.DeepEqual(values, test.expected) {
+			t.Fatalf("Expected %q with the mode %d, got %q", test.expected, test.mode, values)
+		}
+		if value := cursor.queue[1].BinaryVal.Values[0]; string(value) != "\xff" {
+			t.Fatalf("Expected the binary value to be kept, got %q", value)
+		}
+	}
+
+	configuration := NewConnectConfiguration()
+	configuration.InvalidUTF8 = InvalidUTF8Error
+	cursor := &Cursor{conn: &Connection{configuration: configuration}}
+	if err := cursor.parseResults(response()); !errors.Is(err, ErrInvalidUTF8) || !strings.Contains(err.Error(), "row 1") {
+		t.Fatalf("Expected ErrInvalidUTF8 for the second row, got %v", err)
+	}
+}
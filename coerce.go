@@ -0,0 +1,227 @@
+package gohive
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FetchOneCoerce is like FetchOne but converts the values when the destination type doesn't match the column type.
+// The allowed conversions are:
+//
+//	BOOLEAN                         -> bool, string, signed and unsigned integers (0 or 1)
+//	TINYINT, SMALLINT, INT, BIGINT  -> signed and unsigned integers (range checked), float32, float64, string
+//	FLOAT, DOUBLE                   -> float32, float64, string
+//	STRING and other textual types  -> string, []byte, and bool, integers and floats if the value can be parsed
+//	TIMESTAMP                       -> time.Time in UTC, see ParseTimestamp, and the textual destinations
+//	BINARY                          -> []byte, string
+//
+// Any column can be read into an *interface{} or a **T, which is set to nil for NULL values.
+// NULL values read into any other destination set it to its zero value.
+// Other pairs are genuinely incompatible and set the cursor error.
+func (c *Cursor) FetchOneCoerce(ctx context.Context, dests ...interface{}) {
+	c.Err = nil
+	c.fetchIfEmpty(ctx)
+	if c.Err != nil {
+		return
+	}
+
+	if len(c.queue) != len(dests) {
+		c.Err = errors.Errorf("%d arguments where passed for filling but the number of columns is %d", len(dests), len(c.queue))
+		return
+	}
+	for i := 0; i < len(c.queue); i++ {
+		if dests[i] == nil {
+			continue
+		}
+		if err := coerceValue(columnValue(c.queue[i], c.columnIndex), dests[i]); err != nil {
+			c.Err = errors.Wrapf(err, "index is %v", i)
+			return
+		}
+	}
+	c.consumeRows(c.columnIndex + 1)
+}
+
+// coerceValue stores value, as returned by columnValue, in the pointer dest converting it if needed
+func coerceValue(value interface{}, dest interface{}) error {
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return errors.Errorf("Unexpected destination %T, a non nil pointer is needed", dest)
+	}
+	target = target.Elem()
+	if target.Kind() == reflect.Interface {
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+		} else {
+			target.Set(reflect.ValueOf(value))
+		}
+		return nil
+	}
+	if target.Kind() == reflect.Ptr {
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		target = target.Elem()
+	}
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return coerceBool(v, target)
+	case int8:
+		return coerceInt(int64(v), target)
+	case int16:
+		return coerceInt(int64(v), target)
+	case int32:
+		return coerceInt(int64(v), target)
+	case int64:
+		return coerceInt(v, target)
+	case float64:
+		return coerceFloat(v, target)
+	case string:
+		return coerceString(v, target)
+	case []byte:
+		switch {
+		case target.Kind() == reflect.String:
+			target.SetString(string(v))
+			return nil
+		case target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.Uint8:
+			target.SetBytes(v)
+			return nil
+		}
+	}
+	return errors.Errorf("Unexpected data type %s for value %v of type %T", target.Type(), value, value)
+}
+
+func coerceBool(v bool, target reflect.Value) error {
+	switch target.Kind() {
+	case reflect.Bool:
+		target.SetBool(v)
+		return nil
+	case reflect.String:
+		target.SetString(strconv.FormatBool(v))
+		return nil
+	}
+	var i int64
+	if v {
+		i = 1
+	}
+	if isInteger(target.Kind()) {
+		return coerceInt(i, target)
+	}
+	return errors.Errorf("Unexpected data type %s for value %v of type bool", target.Type(), v)
+}
+
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// coerceInt stores v in an integer, float or string target, failing if it overflows the integer type
+func coerceInt(v int64, target reflect.Value) error {
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if target.OverflowInt(v) {
+			return errors.Errorf("Value %d overflows %s", v, target.Type())
+		}
+		target.SetInt(v)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v < 0 || target.OverflowUint(uint64(v)) {
+			return errors.Errorf("Value %d overflows %s", v, target.Type())
+		}
+		target.SetUint(uint64(v))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		target.SetFloat(float64(v))
+		return nil
+	case reflect.String:
+		target.SetString(strconv.FormatInt(v, 10))
+		return nil
+	}
+	return errors.Errorf("Unexpected data type %s for value %v of type int64", target.Type(), v)
+}
+
+func coerceFloat(v float64, target reflect.Value) error {
+	switch target.Kind() {
+	case reflect.Float32:
+		if !math.IsInf(v, 0) && target.OverflowFloat(v) {
+			return errors.Errorf("Value %v overflows %s", v, target.Type())
+		}
+		target.SetFloat(v)
+		return nil
+	case reflect.Float64:
+		target.SetFloat(v)
+		return nil
+	case reflect.String:
+		target.SetString(strconv.FormatFloat(v, 'g', -1, 64))
+		return nil
+	}
+	return errors.Errorf("Unexpected data type %s for value %v of type float64", target.Type(), v)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func coerceString(v string, target reflect.Value) error {
+	switch {
+	case target.Type() == timeType:
+		t, err := ParseTimestamp(v, time.UTC)
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(t))
+		return nil
+	case target.Kind() == reflect.String:
+		target.SetString(v)
+		return nil
+	case target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.Uint8:
+		target.SetBytes([]byte(v))
+		return nil
+	case target.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		target.SetBool(b)
+		return nil
+	case isInteger(target.Kind()):
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		return coerceInt(i, target)
+	case target.Kind() == reflect.Float32 || target.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(v, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+		target.SetFloat(f)
+		return nil
+	}
+	return errors.Errorf("Unexpected data type %s for value %v of type string", target.Type(), v)
+}
+
+// isGoIntDest returns whether dest is one of the platform dependent or unsigned integer destinations
+// accepted by FetchOne for INT and BIGINT columns
+func isGoIntDest(dest interface{}) bool {
+	switch dest.(type) {
+	case *int, *uint, *uint64, **int, **uint, **uint64:
+		return true
+	}
+	return false
+}
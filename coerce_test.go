@@ -0,0 +1,109 @@
+package gohive
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCoerceValue(t *testing.T) {
+	var i int
+	if err := coerceValue(int32(7), &i); err != nil || i != 7 {
+		t.Fatalf("Expected 7, got %d (%v)", i, err)
+	}
+	var i64 int64
+	if err := coerceValue(int32(-7), &i64); err != nil || i64 != -7 {
+		t.Fatalf("Expected -7, got %d (%v)", i64, err)
+	}
+	var s string
+	if err := coerceValue(true, &s); err != nil || s != "true" {
+		t.Fatalf("Expected true, got %s (%v)", s, err)
+	}
+	var b bool
+	if err := coerceValue("false", &b); err != nil || b {
+		t.Fatalf("Expected false, got %v (%v)", b, err)
+	}
+	var f float64
+	if err := coerceValue(int64(3), &f); err != nil || f != 3 {
+		t.Fatalf("Expected 3, got %v (%v)", f, err)
+	}
+	var p *int
+	if err := coerceValue(int64(3), &p); err != nil || p == nil || *p != 3 {
+		t.Fatalf("Expected a pointer to 3, got %v (%v)", p, err)
+	}
+	if err := coerceValue(nil, &p); err != nil || p != nil {
+		t.Fatalf("Expected nil, got %v (%v)", p, err)
+	}
+	var any interface{}
+	if err := coerceValue(int16(2), &any); err != nil || any != int16(2) {
+		t.Fatalf("Expected 2, got %v (%v)", any, err)
+	}
+}
+
+func TestCoerceValueIncompatible(t *testing.T) {
+	var u8 uint8
+	if err := coerceValue(int32(256), &u8); err == nil {
+		t.Fatal("Expected overflow error")
+	}
+	var u uint
+	if err := coerceValue(int64(-1), &u); err == nil {
+		t.Fatal("Expected error for a negative value into an unsigned integer")
+	}
+	var b bool
+	if err := coerceValue(1.5, &b); err == nil {
+		t.Fatal("Expected error for a double into a bool")
+	}
+	var i int
+	if err := coerceValue("abc", &i); err == nil {
+		t.Fatal("Expected error for a non numeric string into an int")
+	}
+	if err := coerceValue(int32(1), i); err == nil {
+		t.Fatal("Expected error for a non pointer destination")
+	}
+}
+
+func TestGoIntDestOverflow(t *testing.T) {
+	var i int
+	if !isGoIntDest(&i) {
+		t.Fatal("*int should be accepted for INT columns")
+	}
+	err := coerceValue(int64(math.MaxInt64), &i)
+	if math.MaxInt == math.MaxInt64 && (err != nil || i != math.MaxInt) {
+		t.Fatalf("Expected %d, got %d (%v)", math.MaxInt, i, err)
+	}
+	if math.MaxInt != math.MaxInt64 && err == nil {
+		t.Fatal("Expected overflow error for a BIGINT into a 32 bit int")
+	}
+	var u uint
+	if err := coerceValue(int32(-1), &u); err == nil {
+		t.Fatal("Expected error for a negative INT into *uint")
+	}
+	var u64 uint64
+	if err := coerceValue(int64(math.MaxInt64), &u64); err != nil || u64 != math.MaxInt64 {
+		t.Fatalf("Expected %d, got %d (%v)", int64(math.MaxInt64), u64, err)
+	}
+	if err := coerceValue(int64(math.MinInt64), &u64); err == nil {
+		t.Fatal("Expected error for a negative BIGINT into *uint64")
+	}
+	var p *uint
+	if err := coerceValue(int32(5), &p); err != nil || *p != 5 {
+		t.Fatalf("Expected a pointer to 5 (%v)", err)
+	}
+	if isGoIntDest(new(float64)) {
+		t.Fatal("*float64 shouldn't be accepted for INT columns")
+	}
+}
+
+func TestCoerceTimestamp(t *testing.T) {
+	var timestamp time.Time
+	if err := coerceValue("2024-02-29 13:14:15.123456789", &timestamp); err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2024, 2, 29, 13, 14, 15, 123456789, time.UTC); !timestamp.Equal(expected) {
+		t.Fatalf("Expected %s, got %s", expected, timestamp)
+	}
+	var p *time.Time
+	if err := coerceValue(nil, &p); err != nil || p != nil {
+		t.Fatalf("Expected nil, got %v (%v)", p, err)
+	}
+}
@@ -0,0 +1,463 @@
+package gohive
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+// Union is a value of a UNIONTYPE column, sent by HiveServer2 as {tag:value}.
+// Tag is the position, starting at 0, of the member type of the value in the declaration of the union,
+// for example 1 is STRING in UNIONTYPE<INT, STRING>. Value holds the types FetchOne uses for *interface{}
+// destinations: nil, bool, int64, float64, string, []interface{} or map[string]interface{}. Its scalars are decoded
+// with the type of the member when the server describes the members of the union, as the entries named after their
+// tag, DECIMAL values are then kept as text. HiveServer2 doesn't describe them, so the scalars are typed from their
+// text. FetchOne returns it for *Union destinations, and RowMap and RowSlice with DecodeUnions.
+type Union struct {
+	Tag   int
+	Value interface{}
+}
+
+var unionType = reflect.TypeOf(Union{})
+
+// ParseUnion parses the text of a UNIONTYPE value, as returned by RowMap and RowSlice unless DecodeUnions is set.
+// The scalars of Value are typed from their text.
+func ParseUnion(s string) (Union, error) {
+	return parseUnion(s, nil)
+}
+
+// parseUnion parses the text of a value of the UNIONTYPE t
+func parseUnion(s string, t *complexType) (Union, error) {
+	value, err := parseComplexValue(s, t)
+	if err != nil {
+		return Union{}, err
+	}
+	return complexUnion(value)
+}
+
+// complexUnion converts a value returned by parseComplexValue to a Union
+func complexUnion(value interface{}) (Union, error) {
+	pairs, ok := value.([]complexPair)
+	if !ok || len(pairs) != 1 {
+		return Union{}, errors.Errorf("Unexpected union value %v, it should be {tag:value}", naturalComplex(value))
+	}
+	tag, ok := pairs[0].key.(int64)
+	if !ok {
+		return Union{}, errors.Errorf("Unexpected union tag %v", pairs[0].key)
+	}
+	return Union{Tag: int(tag), Value: naturalComplex(pairs[0].value)}, nil
+}
+
+// complexPair is an entry of a parsed MAP value, keeping the order sent by the server
+type complexPair struct {
+	key   interface{}
+	value interface{}
+}
+
+// complexToken is an unquoted scalar of a complex value, typed by decodeComplex
+type complexToken string
+
+// complexParser parses the text representation HiveServer2 uses for complex values, which is JSON
+// except for the keys of maps, that can be unquoted numbers or booleans like in {1:"a",2:"b"}
+type complexParser struct {
+	s   string
+	pos int
+}
+
+// parseComplexValue parses a complex value of type t into nil, bool, int64, float64, string,
+// []interface{} for arrays and []complexPair for maps and structs, see decodeComplex
+func parseComplexValue(s string, t *complexType) (interface{}, error) {
+	p := &complexParser{s: s}
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos != len(p.s) {
+		return nil, p.errorf("unexpected trailing data")
+	}
+	value, err = decodeComplex(value, t)
+	if err != nil {
+		return nil, errors.Wrapf(err, "gohive: invalid complex value %q", s)
+	}
+	return value, nil
+}
+
+func (p *complexParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("gohive: invalid complex value %q at position %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *complexParser) skipSpaces() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n' || p.s[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *complexParser) consume(b byte) bool {
+	p.skipSpaces()
+	if p.pos < len(p.s) && p.s[p.pos] == b {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *complexParser) value() (interface{}, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("unexpected end")
+	}
+	switch p.s[p.pos] {
+	case '[':
+		p.pos++
+		values := []interface{}{}
+		if p.consume(']') {
+			return values, nil
+		}
+		for {
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if p.consume(']') {
+				return values, nil
+			}
+			if !p.consume(',') {
+				return nil, p.errorf("expected , or ]")
+			}
+		}
+	case '{':
+		p.pos++
+		pairs := []complexPair{}
+		if p.consume('}') {
+			return pairs, nil
+		}
+		for {
+			key, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume(':') {
+				return nil, p.errorf("expected :")
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, complexPair{key: key, value: value})
+			if p.consume('}') {
+				return pairs, nil
+			}
+			if !p.consume(',') {
+				return nil, p.errorf("expected , or }")
+			}
+		}
+	case '"':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.s) && p.s[p.pos] != '"' {
+			if p.s[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("unterminated string")
+		}
+		p.pos++
+		var s string
+		if err := json.Unmarshal([]byte(p.s[start:p.pos]), &s); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return s, nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !isComplexDelimiter(p.s[p.pos]) {
+		p.pos++
+	}
+	token := p.s[start:p.pos]
+	switch token {
+	case "":
+		return nil, p.errorf("expected a value")
+	case "null":
+		return nil, nil
+	}
+	return complexToken(token), nil
+}
+
+// complexType is the type of a value inside a complex column, an entry of the type descriptor of the column.
+// The nil *complexType is an unknown type, servers like HiveServer2 only describe the top level type of the columns.
+type complexType struct {
+	desc *hiveserver.TTypeDesc
+	ptr  hiveserver.TTypeEntryPtr
+}
+
+// columnComplexType returns the type of the values of column, nil if the server didn't describe it
+func columnComplexType(column *hiveserver.TColumnDesc) *complexType {
+	if column == nil || column.TypeDesc == nil || len(column.TypeDesc.Types) == 0 {
+		return nil
+	}
+	return &complexType{desc: column.TypeDesc}
+}
+
+func (t *complexType) entry() *hiveserver.TTypeEntry {
+	if t == nil || t.ptr < 0 || int(t.ptr) >= len(t.desc.Types) {
+		return nil
+	}
+	return t.desc.Types[t.ptr]
+}
+
+// at returns the type described by the entry ptr of the same type descriptor
+func (t *complexType) at(ptr hiveserver.TTypeEntryPtr) *complexType {
+	return &complexType{desc: t.desc, ptr: ptr}
+}
+
+// decodeComplex types the unquoted scalars of a parsed value with the element, key, value and member types of t. BOOLEAN,
+// the integer types and FLOAT and DOUBLE are decoded into bool, int64 and float64, DECIMAL and the other types are
+// kept as the text sent by the server. The scalars of unknown types are typed from their text instead.
+func decodeComplex(value interface{}, t *complexType) (interface{}, error) {
+	entry := t.entry()
+	switch v := value.(type) {
+	case complexToken:
+		if entry == nil || entry.PrimitiveEntry == nil {
+			return guessScalar(string(v)), nil
+		}
+		return decodeScalar(string(v), entry.PrimitiveEntry.Type)
+	case []interface{}:
+		var element *complexType
+		if entry != nil && entry.ArrayEntry != nil {
+			element = t.at(entry.ArrayEntry.ObjectTypePtr)
+		}
+		for i := range v {
+			decoded, err := decodeComplex(v[i], element)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = decoded
+		}
+	case []complexPair:
+		for i := range v {
+			var key, elem *complexType
+			switch {
+			case entry == nil:
+			case entry.MapEntry != nil:
+				key, elem = t.at(entry.MapEntry.KeyTypePtr), t.at(entry.MapEntry.ValueTypePtr)
+			case entry.StructEntry != nil:
+				if ptr, ok := entry.StructEntry.NameToTypePtr[fmt.Sprint(v[i].key)]; ok {
+					elem = t.at(ptr)
+				}
+			}
+			var err error
+			if v[i].key, err = decodeComplex(v[i].key, key); err != nil {
+				return nil, err
+			}
+			if entry != nil && entry.UnionEntry != nil {
+				// The value of the member whose name is the tag
+				if ptr, ok := entry.UnionEntry.NameToTypePtr[fmt.Sprint(v[i].key)]; ok {
+					elem = t.at(ptr)
+				}
+			}
+			if v[i].value, err = decodeComplex(v[i].value, elem); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return value, nil
+}
+
+// decodeScalar decodes an unquoted scalar of a complex value of type typeId
+func decodeScalar(token string, typeId hiveserver.TTypeId) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch typeId {
+	case hiveserver.TTypeId_BOOLEAN_TYPE:
+		value, err = strconv.ParseBool(token)
+	case hiveserver.TTypeId_TINYINT_TYPE, hiveserver.TTypeId_SMALLINT_TYPE, hiveserver.TTypeId_INT_TYPE, hiveserver.TTypeId_BIGINT_TYPE:
+		value, err = strconv.ParseInt(token, 10, 64)
+	case hiveserver.TTypeId_FLOAT_TYPE, hiveserver.TTypeId_DOUBLE_TYPE:
+		value, err = strconv.ParseFloat(token, 64)
+	default:
+		return token, nil
+	}
+	if err != nil {
+		return nil, errors.Errorf("%q isn't a %s value", token, typeId)
+	}
+	return value, nil
+}
+
+// guessScalar types an unquoted scalar of a complex value of unknown type from its text
+func guessScalar(token string) interface{} {
+	switch token {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(token, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f
+	}
+	// Unquoted values that aren't numbers, like the keys of maps of dates, are kept as strings
+	return token
+}
+
+func isComplexDelimiter(b byte) bool {
+	switch b {
+	case ',', ':', ']', '}', ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+// scanComplex parses value, the text of a complex column of type t or nil, into the pointer dest
+func scanComplex(value interface{}, dest interface{}, t *complexType) error {
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return errors.Errorf("Unexpected destination %T, a non nil pointer is needed", dest)
+	}
+	if value == nil {
+		target.Elem().Set(reflect.Zero(target.Elem().Type()))
+		return nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return errors.Errorf("Unexpected value %v of type %T for a complex column", value, value)
+	}
+	parsed, err := parseComplexValue(s, t)
+	if err != nil {
+		return err
+	}
+	return assignComplex(parsed, target.Elem())
+}
+
+// assignComplex stores a value returned by parseComplexValue in target, converting it to the target type
+func assignComplex(value interface{}, target reflect.Value) error {
+	if target.Type() == unionType {
+		if value == nil {
+			target.Set(reflect.Zero(unionType))
+			return nil
+		}
+		union, err := complexUnion(value)
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(union))
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.Interface:
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+		} else {
+			target.Set(reflect.ValueOf(naturalComplex(value)))
+		}
+		return nil
+	case reflect.Ptr:
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		return assignComplex(value, target.Elem())
+	case reflect.Slice:
+		if target.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			return errors.Errorf("Unexpected data type %s for value %v", target.Type(), naturalComplex(value))
+		}
+		slice := reflect.MakeSlice(target.Type(), len(values), len(values))
+		for i := range values {
+			if err := assignComplex(values[i], slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		target.Set(slice)
+		return nil
+	case reflect.Map:
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		pairs, ok := value.([]complexPair)
+		if !ok {
+			return errors.Errorf("Unexpected data type %s for value %v", target.Type(), naturalComplex(value))
+		}
+		m := reflect.MakeMapWithSize(target.Type(), len(pairs))
+		for _, pair := range pairs {
+			key := reflect.New(target.Type().Key()).Elem()
+			if err := assignComplex(pair.key, key); err != nil {
+				return err
+			}
+			elem := reflect.New(target.Type().Elem()).Elem()
+			if err := assignComplex(pair.value, elem); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+		}
+		target.Set(m)
+		return nil
+	}
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	switch value.(type) {
+	case []interface{}, []complexPair:
+		return errors.Errorf("Unexpected data type %s for value %v", target.Type(), naturalComplex(value))
+	}
+	return coerceValue(value, target.Addr().Interface())
+}
+
+// naturalComplex converts a parsed value to the types used for *interface{} destinations:
+// []interface{} for arrays and map[string]interface{} for maps and structs
+func naturalComplex(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = naturalComplex(v[i])
+		}
+		return values
+	case []complexPair:
+		m := make(map[string]interface{}, len(v))
+		for _, pair := range v {
+			m[fmt.Sprint(pair.key)] = naturalComplex(pair.value)
+		}
+		return m
+	}
+	return value
+}
+
+// isComplexDest returns whether dest is a pointer to a map, a slice other than []byte or a Union,
+// which FetchOne fills by parsing MAP, ARRAY and UNIONTYPE columns
+func isComplexDest(dest interface{}) bool {
+	t := reflect.TypeOf(dest)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return false
+	}
+	if t.Elem() == unionType || (t.Elem().Kind() == reflect.Ptr && t.Elem().Elem() == unionType) {
+		return true
+	}
+	switch t.Elem().Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Slice:
+		return t.Elem().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
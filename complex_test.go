@@ -0,0 +1,263 @@
+package gohive
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestScanComplexMap(t *testing.T) {
+	var ints map[int32]int64
+	if err := scanComplex(`{1:2,3:null}`, &ints, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ints, map[int32]int64{1: 2, 3: 0}) {
+		t.Fatalf("Unexpected map %v", ints)
+	}
+
+	var strings map[string]*string
+	if err := scanComplex(`{"a,b":"x:\"y\"","c":null}`, &strings, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(strings) != 2 || *strings["a,b"] != `x:"y"` || strings["c"] != nil {
+		t.Fatalf("Unexpected map %v", strings)
+	}
+
+	var nested map[string]interface{}
+	if err := scanComplex(`{"a":{1:[1,2.5,"x"]},"b":true}`, &nested, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a": map[string]interface{}{"1": []interface{}{int64(1), 2.5, "x"}},
+		"b": true,
+	}
+	if !reflect.DeepEqual(nested, expected) {
+		t.Fatalf("Expected %v, got %v", expected, nested)
+	}
+
+	if err := scanComplex(nil, &nested, nil); err != nil || nested != nil {
+		t.Fatalf("Expected a nil map, got %v (%v)", nested, err)
+	}
+}
+
+func TestScanComplexMapErrors(t *testing.T) {
+	var ints map[int32]int32
+	if err := scanComplex(`{"a":1}`, &ints, nil); err == nil {
+		t.Fatal("Expected error for a string key into an int32 key")
+	}
+	if err := scanComplex(`{1:2`, &ints, nil); err == nil {
+		t.Fatal("Expected error for an unterminated map")
+	}
+	if err := scanComplex(`[1,2]`, &ints, nil); err == nil {
+		t.Fatal("Expected error for an array into a map")
+	}
+}
+
+func TestScanComplexArray(t *testing.T) {
+	var ints []int32
+	if err := scanComplex(`[1,2,3]`, &ints, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ints, []int32{1, 2, 3}) {
+		t.Fatalf("Unexpected slice %v", ints)
+	}
+
+	var strings []*string
+	if err := scanComplex(`["a,b",null,"[c]"]`, &strings, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(strings) != 3 || *strings[0] != "a,b" || strings[1] != nil || *strings[2] != "[c]" {
+		t.Fatalf("Unexpected slice %v", strings)
+	}
+
+	var nested [][]int64
+	if err := scanComplex(`[[1,2],[],null]`, &nested, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nested, [][]int64{{1, 2}, {}, nil}) {
+		t.Fatalf("Unexpected slice %v", nested)
+	}
+
+	var values []interface{}
+	if err := scanComplex(`[1,"a",{"k":[true]}]`, &values, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{int64(1), "a", map[string]interface{}{"k": []interface{}{true}}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Expected %v, got %v", expected, values)
+	}
+
+	if err := scanComplex(`{"a":1}`, &ints, nil); err == nil {
+		t.Fatal("Expected error for a map into a slice")
+	}
+	if err := scanComplex(`[300]`, new([]int8), nil); err == nil {
+		t.Fatal("Expected overflow error")
+	}
+	if isComplexDest(new([]byte)) || !isComplexDest(new([]string)) {
+		t.Fatal("Only slices other than []byte should be parsed")
+	}
+}
+
+// complexTypeDesc returns the description of a column with the type entries types
+func complexTypeDesc(types ...*hiveserver.TTypeEntry) *hiveserver.TColumnDesc {
+	return &hiveserver.TColumnDesc{ColumnName: "t.c", TypeDesc: &hiveserver.TTypeDesc{Types: types}}
+}
+
+func primitiveTypeEntry(typeId hiveserver.TTypeId) *hiveserver.TTypeEntry {
+	return &hiveserver.TTypeEntry{PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: typeId}}
+}
+
+func TestScanComplexTyped(t *testing.T) {
+	decimals := complexTypeDesc(
+		&hiveserver.TTypeEntry{MapEntry: &hiveserver.TMapTypeEntry{KeyTypePtr: 1, ValueTypePtr: 2}},
+		primitiveTypeEntry(hiveserver.TTypeId_STRING_TYPE),
+		&hiveserver.TTypeEntry{ArrayEntry: &hiveserver.TArrayTypeEntry{ObjectTypePtr: 3}},
+		primitiveTypeEntry(hiveserver.TTypeId_DECIMAL_TYPE),
+	)
+	var values map[string]interface{}
+	if err := scanComplex(`{"a":[1.10,2,null]}`, &values, columnComplexType(decimals)); err != nil {
+		t.Fatal(err)
+	}
+	// The decimals are kept as sent, with their scale
+	if expected := map[string]interface{}{"a": []interface{}{"1.10", "2", nil}}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Expected %v, got %v", expected, values)
+	}
+
+	doubles := complexTypeDesc(
+		&hiveserver.TTypeEntry{MapEntry: &hiveserver.TMapTypeEntry{KeyTypePtr: 1, ValueTypePtr: 2}},
+		primitiveTypeEntry(hiveserver.TTypeId_BIGINT_TYPE),
+		primitiveTypeEntry(hiveserver.TTypeId_DOUBLE_TYPE),
+	)
+	if err := scanComplex(`{1:2,3:1e300}`, &values, columnComplexType(doubles)); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]interface{}{"1": float64(2), "3": 1e300}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Expected %v, got %v", expected, values)
+	}
+	if err := scanComplex(`{1.5:2}`, &values, columnComplexType(doubles)); err == nil {
+		t.Fatal("Expected error for a BIGINT key that isn't an integer")
+	}
+
+	fields := complexTypeDesc(
+		&hiveserver.TTypeEntry{StructEntry: &hiveserver.TStructTypeEntry{NameToTypePtr: map[string]hiveserver.TTypeEntryPtr{"i": 1, "d": 2}}},
+		primitiveTypeEntry(hiveserver.TTypeId_INT_TYPE),
+		primitiveTypeEntry(hiveserver.TTypeId_DECIMAL_TYPE),
+	)
+	if err := scanComplex(`{"i":1,"d":2.50}`, &values, columnComplexType(fields)); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]interface{}{"i": int64(1), "d": "2.50"}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Expected %v, got %v", expected, values)
+	}
+
+	// FetchOne decodes with the description of the column
+	cursor := &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: [][]string{{"t.c", "MAP_TYPE"}},
+		columns:     []*hiveserver.TColumnDesc{decimals},
+		queue: []*hiveserver.TColumn{
+			{StringVal: &hiveserver.TStringColumn{Values: []string{`{"b":[0.50]}`}, Nulls: []byte{}}},
+		},
+		totalRows: 1,
+	}
+	cursor.FetchOne(context.Background(), &values)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if expected := map[string]interface{}{"b": []interface{}{"0.50"}}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Expected %v, got %v", expected, values)
+	}
+}
+
+func TestScanComplexUnion(t *testing.T) {
+	union, err := ParseUnion(`{1:"a"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if union != (Union{Tag: 1, Value: "a"}) {
+		t.Fatalf("Unexpected union %v", union)
+	}
+
+	var unions []Union
+	if err := scanComplex(`[{0:1},{2:[true]},{1:null}]`, &unions, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Union{{Tag: 0, Value: int64(1)}, {Tag: 2, Value: []interface{}{true}}, {Tag: 1}}
+	if !reflect.DeepEqual(unions, expected) {
+		t.Fatalf("Expected %v, got %v", expected, unions)
+	}
+
+	var nullable *Union
+	if err := scanComplex(`{0:{"a":1.5}}`, &nullable, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nullable, &Union{Tag: 0, Value: map[string]interface{}{"a": 1.5}}) {
+		t.Fatalf("Unexpected union %v", nullable)
+	}
+	if err := scanComplex(nil, &nullable, nil); err != nil || nullable != nil {
+		t.Fatalf("Expected a nil union, got %v, %v", nullable, err)
+	}
+
+	if _, err := ParseUnion(`{"a":1}`); err == nil {
+		t.Fatal("Expected error for a non numeric tag")
+	}
+	if _, err := ParseUnion(`{0:1,1:2}`); err == nil {
+		t.Fatal("Expected error for several tags")
+	}
+	if !isComplexDest(new(Union)) || !isComplexDest(new(*Union)) {
+		t.Fatal("Unions should be parsed")
+	}
+}
+
+func TestRowSliceUnion(t *testing.T) {
+	cursor := &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: [][]string{{"t.u", "UNION_TYPE"}},
+		columns:     []*hiveserver.TColumnDesc{parquetColumnDesc("t.u", hiveserver.TTypeId_UNION_TYPE)},
+		queue: []*hiveserver.TColumn{
+			{StringVal: &hiveserver.TStringColumn{Values: []string{`{1:"a"}`, `{0:1}`, "", "{"}, Nulls: []byte{4}}},
+		},
+		totalRows: 4,
+	}
+	if row := cursor.RowSlice(context.Background()); !reflect.DeepEqual(row, []interface{}{`{1:"a"}`}) {
+		t.Fatalf("Expected the text of the union without DecodeUnions, got %v", row)
+	}
+
+	cursor.conn.configuration.DecodeUnions = true
+	if goType := cursor.Describe()[0].GoType; goType != unionType {
+		t.Fatalf("Expected Union to be described, got %s", goType)
+	}
+	if row := cursor.RowMap(context.Background()); !reflect.DeepEqual(row, map[string]interface{}{"t.u": Union{Tag: 0, Value: int64(1)}}) {
+		t.Fatalf("Unexpected union %v", row)
+	}
+	if row := cursor.RowSlice(context.Background()); !reflect.DeepEqual(row, []interface{}{nil}) {
+		t.Fatalf("Expected NULL, got %v", row)
+	}
+	if row := cursor.RowSlice(context.Background()); row != nil || cursor.Err == nil {
+		t.Fatalf("Expected an error for an invalid union, got %v", row)
+	}
+
+	// The members described by the server decode the values
+	cursor.columns = []*hiveserver.TColumnDesc{complexTypeDesc(
+		&hiveserver.TTypeEntry{UnionEntry: &hiveserver.TUnionTypeEntry{NameToTypePtr: map[string]hiveserver.TTypeEntryPtr{"0": 1, "1": 2}}},
+		primitiveTypeEntry(hiveserver.TTypeId_DOUBLE_TYPE),
+		primitiveTypeEntry(hiveserver.TTypeId_DECIMAL_TYPE),
+	)}
+	cursor.queue[0].StringVal.Values = []string{`{0:1}`, `{1:1.50}`, `{1:null}`, `{0:b}`}
+	cursor.queue[0].StringVal.Nulls = []byte{}
+	cursor.columnIndex = 0
+	for _, expected := range []Union{{Tag: 0, Value: float64(1)}, {Tag: 1, Value: "1.50"}, {Tag: 1}} {
+		if row := cursor.RowSlice(context.Background()); !reflect.DeepEqual(row, []interface{}{expected}) {
+			t.Fatalf("Expected %v, got %v (%v)", expected, row, cursor.Err)
+		}
+	}
+	if row := cursor.RowSlice(context.Background()); row != nil || cursor.Err == nil {
+		t.Fatalf("Expected an error for a DOUBLE member that isn't a number, got %v", row)
+	}
+}
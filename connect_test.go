@@ -0,0 +1,717 @@
+package gohive
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestSessionConfiguration(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	if sessionConfiguration(configuration) != nil {
+		t.Fatal("Expected no configuration")
+	}
+	configuration.HiveConfiguration = map[string]string{"use:database": "sales", "set:hiveconf:a": "1"}
+	configuration.HiveConf = map[string]string{"a": "2"}
+	configuration.HiveVars = map[string]string{"b": "3"}
+	configuration.Catalog = "hive"
+	expected := map[string]string{
+		"use:database":                           "sales",
+		"set:hiveconf:a":                         "2",
+		"set:hivevar:b":                          "3",
+		"set:hiveconf:metastore.catalog.default": "hive",
+	}
+	if conf := sessionConfiguration(configuration); !reflect.DeepEqual(conf, expected) {
+		t.Fatalf("Expected %v, got %v", expected, conf)
+	}
+	if len(configuration.HiveConfiguration) != 2 {
+		t.Fatal("HiveConfiguration shouldn't be modified")
+	}
+}
+
+// sessionUserHiveServer records the usernames of the sessions opened
+type sessionUserHiveServer struct {
+	fakeHiveServer
+	usernames []string
+}
+
+func (s *sessionUserHiveServer) OpenSession(ctx context.Context, req *hiveserver.TOpenSessionReq) (*hiveserver.TOpenSessionResp, error) {
+	s.usernames = append(s.usernames, req.GetUsername())
+	return s.fakeHiveServer.OpenSession(ctx, req)
+}
+
+func TestTransportAndSessionUsername(t *testing.T) {
+	fake := &sessionUserHiveServer{}
+	thriftHandler := thrift.NewThriftHandlerFunc(hiveserver.NewTCLIServiceProcessor(fake), thrift.NewTBinaryProtocolFactoryConf(nil), thrift.NewTBinaryProtocolFactoryConf(nil))
+	var transportUsers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		transportUsers = append(transportUsers, user)
+		thriftHandler(w, r)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	configuration := NewConnectConfiguration()
+	configuration.TransportMode = "http"
+	configuration.Username = "gateway"
+	configuration.Password = "secret"
+	configuration.SessionUsername = "alice"
+	connection, err := Connect(serverURL.Hostname(), port, "NONE", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+	if len(transportUsers) == 0 || transportUsers[0] != "gateway" || !reflect.DeepEqual(fake.usernames, []string{"alice"}) {
+		t.Fatalf("Expected the transport as gateway and the session for alice, got %v and %v", transportUsers, fake.usernames)
+	}
+
+	// Both default to Username
+	transportUsers, fake.usernames = nil, nil
+	configuration.TransportUsername = "service"
+	configuration.SessionUsername = ""
+	connection, err = Connect(serverURL.Hostname(), port, "NONE", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+	if len(transportUsers) == 0 || transportUsers[0] != "service" || !reflect.DeepEqual(fake.usernames, []string{"gateway"}) {
+		t.Fatalf("Expected the transport as service and the session for gateway, got %v and %v", transportUsers, fake.usernames)
+	}
+}
+
+// startSilentServer accepts connections and never answers
+func startSilentServer(t *testing.T) (string, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make(chan net.Conn, 16)
+	t.Cleanup(func() {
+		listener.Close()
+		for len(conns) > 0 {
+			(<-conns).Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	address := listener.Addr().(*net.TCPAddr)
+	return address.IP.String(), address.Port
+}
+
+func TestConnectFirst(t *testing.T) {
+	silentHost, silentPort := startSilentServer(t)
+	host, port := startFakeHiveServer(t, &fakeHiveServer{})
+	nodes := []map[string]string{
+		{"host": silentHost, "port": strconv.Itoa(silentPort)},
+		{"host": host, "port": strconv.Itoa(port)},
+	}
+	configuration := NewConnectConfiguration()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	connection, err := connectFirst(ctx, nodes, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connection.host != host || connection.port != port {
+		t.Fatalf("Expected a connection to %s:%d, got %s:%d", host, port, connection.host, connection.port)
+	}
+	connection.Close()
+}
+
+// bufferConn records the buffer sizes set on the connection
+type bufferConn struct {
+	*net.TCPConn
+	sendBufferSize    int
+	receiveBufferSize int
+}
+
+func (c *bufferConn) SetWriteBuffer(bytes int) error {
+	c.sendBufferSize = bytes
+	return c.TCPConn.SetWriteBuffer(bytes)
+}
+
+func (c *bufferConn) SetReadBuffer(bytes int) error {
+	c.receiveBufferSize = bytes
+	return c.TCPConn.SetReadBuffer(bytes)
+}
+
+func TestAddressFamily(t *testing.T) {
+	host, port := startFakeHiveServer(t, &fakeHiveServer{})
+	configuration := NewConnectConfiguration()
+	configuration.AddressFamily = "tcp4"
+	var networks []string
+	configuration.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		networks = append(networks, network)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	connection, err := Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+	if !reflect.DeepEqual(networks, []string{"tcp4"}) {
+		t.Fatalf("Expected DialContext to be given tcp4, got %v", networks)
+	}
+
+	// Without DialContext the library dials with the family itself
+	configuration.DialContext = nil
+	connection, err = Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+	configuration.AddressFamily = "tcp6"
+	if _, err = Connect(host, port, "NOSASL", configuration); err == nil {
+		t.Fatalf("Expected the IPv4 address %s not to be dialed with tcp6", host)
+	}
+
+	configuration.AddressFamily = "udp"
+	if _, err = Connect(host, port, "NOSASL", configuration); err == nil || !strings.Contains(err.Error(), "AddressFamily") {
+		t.Fatalf("Expected an error for an unknown family, got %v", err)
+	}
+}
+
+func TestSocketBufferSizes(t *testing.T) {
+	host, port := startFakeHiveServer(t, &fakeHiveServer{})
+	configuration := NewConnectConfiguration()
+	configuration.SendBufferSize = 1 << 20
+	configuration.ReceiveBufferSize = 2 << 20
+	var conn *bufferConn
+	configuration.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		conn = &bufferConn{TCPConn: c.(*net.TCPConn)}
+		return conn, nil
+	}
+	connection, err := Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+	if conn.sendBufferSize != 1<<20 || conn.receiveBufferSize != 2<<20 {
+		t.Fatalf("Expected the buffer sizes to be set, got %d and %d", conn.sendBufferSize, conn.receiveBufferSize)
+	}
+
+	// Without DialContext the library dials the socket itself, doing the TLS handshake
+	configuration.DialContext = nil
+	connection, err = Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+
+	// The fake server behind a TLS proxy
+	httpsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	httpsServer.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		tlsListener := tls.NewListener(listener, httpsServer.TLS)
+		for {
+			conn, err := tlsListener.Accept()
+			if err != nil {
+				return
+			}
+			backend, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go func() {
+				io.Copy(backend, conn)
+				backend.Close()
+			}()
+			go func() {
+				io.Copy(conn, backend)
+				conn.Close()
+			}()
+		}
+	}()
+	address := listener.Addr().(*net.TCPAddr)
+	configuration.TLSConfig = httpsServer.Client().Transport.(*http.Transport).TLSClientConfig
+	connection, err = Connect(address.IP.String(), address.Port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+}
+
+// servePipe serves the handler over the server end of a net.Pipe until it's closed
+func servePipe(handler hiveserver.TCLIService, conn net.Conn) {
+	processor := hiveserver.NewTCLIServiceProcessor(handler)
+	protocol := thrift.NewTBinaryProtocolConf(thrift.NewTSocketFromConnConf(conn, nil), nil)
+	for {
+		if ok, err := processor.Process(context.Background(), protocol, protocol); !ok || err != nil {
+			conn.Close()
+			return
+		}
+	}
+}
+
+func TestConnectWithConn(t *testing.T) {
+	server := &operationHiveServer{}
+	clientConn, serverConn := net.Pipe()
+	go servePipe(server, serverConn)
+	connection, err := ConnectWithConn(context.Background(), clientConn, "", "NOSASL", NewConnectConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := connection.Cursor()
+	cursor.Exec(context.Background(), "SELECT 1")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	cursor.Close()
+	if server.executions != 1 {
+		t.Fatalf("Expected the statement to be run over the pipe, got %d executions", server.executions)
+	}
+	if err = connection.Reconnect(context.Background()); err == nil || !strings.Contains(err.Error(), "dialed again") {
+		t.Fatalf("Expected Reconnect to fail, got %v", err)
+	}
+	connection.Close()
+
+	// The connection is wrapped in TLS
+	httpsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	httpsServer.Close()
+	clientConn, serverConn = net.Pipe()
+	go servePipe(&fakeHiveServer{}, tls.Server(serverConn, httpsServer.TLS))
+	configuration := NewConnectConfiguration()
+	configuration.TLSConfig = httpsServer.Client().Transport.(*http.Transport).TLSClientConfig
+	connection, err = ConnectWithConn(context.Background(), clientConn, "127.0.0.1", "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+	if configuration.DialContext != nil {
+		t.Fatal("Expected the configuration not to be modified")
+	}
+}
+
+func TestBufferSize(t *testing.T) {
+	host, port := startFakeHiveServer(t, &fakeHiveServer{})
+	for _, bufferSize := range []int{0, 1 << 20} {
+		configuration := NewConnectConfiguration()
+		configuration.BufferSize = bufferSize
+		connection, err := Connect(host, port, "NOSASL", configuration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := bufferSize
+		if expected == 0 {
+			expected = DEFAULT_BUFFER_SIZE
+		}
+		if size := connection.transport.(*thrift.TBufferedTransport).Writer.Size(); size != expected {
+			t.Fatalf("Expected a buffer of %d bytes, got %d", expected, size)
+		}
+		connection.Close()
+	}
+}
+
+func TestTransportWrapper(t *testing.T) {
+	server := &operationHiveServer{}
+	host, port := startFakeHiveServerTransport(t, server, thrift.NewTFramedTransportFactoryConf(thrift.NewTTransportFactory(), nil))
+	configuration := NewConnectConfiguration()
+	configuration.TransportWrapper = "framed"
+	connection, err := Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "SELECT 1")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if _, ok := connection.transport.(*thrift.TFramedTransport); !ok {
+		t.Fatalf("Expected a framed transport, got %T", connection.transport)
+	}
+
+	configuration.TransportWrapper = "zlib"
+	if _, err = Connect(host, port, "NOSASL", configuration); err == nil || !strings.Contains(err.Error(), "zlib") {
+		t.Fatalf("Expected an error for an unknown transport wrapper, got %v", err)
+	}
+}
+
+// deniedHiveServer opens sessions but fails every statement
+type deniedHiveServer struct {
+	fakeHiveServer
+}
+
+func (s *deniedHiveServer) ExecuteStatement(ctx context.Context, req *hiveserver.TExecuteStatementReq) (*hiveserver.TExecuteStatementResp, error) {
+	return &hiveserver.TExecuteStatementResp{Status: &hiveserver.TStatus{
+		StatusCode:   hiveserver.TStatusCode_ERROR_STATUS,
+		ErrorMessage: thrift.StringPtr("Permission denied: user doesn't have USE privilege"),
+		ErrorCode:    thrift.Int32Ptr(40000),
+	}}, nil
+}
+
+func TestConnectionName(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.Name = "reporting"
+	connection := connectFakeHiveServer(t, &deniedHiveServer{}, configuration)
+	defer connection.Close()
+	if connection.Name() != "reporting" {
+		t.Fatalf("Unexpected name %s", connection.Name())
+	}
+	cursor := connection.Cursor()
+	cursor.Exec(context.Background(), "SELECT 1")
+	var hiveErr HiveError
+	if !errors.As(cursor.Err, &hiveErr) || hiveErr.Connection != "reporting" || !strings.HasPrefix(cursor.Err.Error(), "connection reporting: ") {
+		t.Fatalf("Expected the error to name the connection, got %v", cursor.Err)
+	}
+
+	server := &operationHiveServer{runningPolls: 1000}
+	configuration.PollIntervalInMillis = 10
+	connection = connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	cursor = connection.Cursor()
+	cursor.Exec(ctx, "SELECT 1")
+	if cursor.Err == nil || cursor.Err.Error() != "connection reporting: Context was done before the query was executed" {
+		t.Fatalf("Expected the error to name the connection, got %v", cursor.Err)
+	}
+
+	configuration.Name = ""
+	cursor.Exec(ctx, "SELECT 1")
+	if cursor.Err == nil || strings.Contains(cursor.Err.Error(), "connection") {
+		t.Fatalf("Expected the error to be left as is without a name, got %v", cursor.Err)
+	}
+
+	// Errors of the transport while fetching and closing
+	configuration = NewConnectConfiguration()
+	configuration.Name = "reporting"
+	configuration.FetchSize = 2
+	connection = connectFakeHiveServer(t, &operationHiveServer{rows: 5}, configuration)
+	defer connection.Close()
+	cursor = connection.Cursor()
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	connection.transport.Close()
+	if cursor.HasMore(context.Background()); cursor.Err == nil || !strings.HasPrefix(cursor.Err.Error(), "connection reporting: ") {
+		t.Fatalf("Expected the fetch error to name the connection, got %v", cursor.Err)
+	}
+	if cursor.Close(); cursor.Err == nil || !strings.HasPrefix(cursor.Err.Error(), "connection reporting: ") {
+		t.Fatalf("Expected the close error to name the connection, got %v", cursor.Err)
+	}
+}
+
+func TestValidateOnConnect(t *testing.T) {
+	server := &operationHiveServer{}
+	host, port := startFakeHiveServer(t, server)
+	configuration := NewConnectConfiguration()
+	configuration.ValidateOnConnect = true
+	connection, err := Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+	if server.executions != 1 || !server.closed {
+		t.Fatalf("Expected a statement to be run and closed, got %d executions", server.executions)
+	}
+
+	host, port = startFakeHiveServer(t, &deniedHiveServer{})
+	connection, err = Connect(host, port, "NOSASL", NewConnectConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.Close()
+	_, err = Connect(host, port, "NOSASL", configuration)
+	var hiveErr HiveError
+	if !errors.As(err, &hiveErr) || !strings.Contains(hiveErr.Message, "Permission denied") {
+		t.Fatalf("Expected the error of the statement, got %v", err)
+	}
+}
+
+func TestConnectContextCanceled(t *testing.T) {
+	host, port := startSilentServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := connectContext(ctx, host, port, "NOSASL", NewConnectConfiguration())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Connecting took %s after the context was done", elapsed)
+	}
+}
+
+func TestConnectionClone(t *testing.T) {
+	server := &fakeHiveServer{}
+	host, port := startFakeHiveServer(t, server)
+	connection, err := Connect(host, port, "NOSASL", NewConnectConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	clone, err := connection.Clone(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone == connection || clone.transport == connection.transport || clone.configuration == connection.configuration {
+		t.Fatal("Expected an independent connection")
+	}
+	if clone.host != connection.host || clone.port != connection.port || clone.auth != connection.auth {
+		t.Fatalf("Expected a connection to %s:%d with %s, got %s:%d with %s", connection.host, connection.port, connection.auth, clone.host, clone.port, clone.auth)
+	}
+	if err := clone.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if server.sessions.Load() != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", server.sessions.Load())
+	}
+}
+
+// warningHiveServer opens sessions with a SUCCESS_WITH_INFO status and an older protocol version
+type warningHiveServer struct {
+	fakeHiveServer
+}
+
+func (s *warningHiveServer) OpenSession(ctx context.Context, req *hiveserver.TOpenSessionReq) (*hiveserver.TOpenSessionResp, error) {
+	response, err := s.fakeHiveServer.OpenSession(ctx, req)
+	response.Status = &hiveserver.TStatus{
+		StatusCode:   hiveserver.TStatusCode_SUCCESS_WITH_INFO_STATUS,
+		InfoMessages: []string{"hive.foo is deprecated"},
+	}
+	response.ServerProtocolVersion = hiveserver.TProtocolVersion_HIVE_CLI_SERVICE_PROTOCOL_V1
+	return response, err
+}
+
+func TestSessionWarnings(t *testing.T) {
+	server := &warningHiveServer{}
+	host, port := startFakeHiveServer(t, server)
+	connection, err := Connect(host, port, "NOSASL", NewConnectConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"hive.foo is deprecated", "The server negotiated the protocol HIVE_CLI_SERVICE_PROTOCOL_V1 instead of HIVE_CLI_SERVICE_PROTOCOL_V6"}
+	if !reflect.DeepEqual(connection.Warnings(), expected) {
+		t.Fatalf("Expected %v, got %v", expected, connection.Warnings())
+	}
+	connection.Close()
+
+	configuration := NewConnectConfiguration()
+	protocolErr := errors.New("old protocol")
+	configuration.OnSessionWarning = func(warning string) error {
+		if strings.Contains(warning, "protocol") {
+			return protocolErr
+		}
+		return nil
+	}
+	_, err = Connect(host, port, "NOSASL", configuration)
+	if !errors.Is(err, protocolErr) {
+		t.Fatalf("Expected the error of OnSessionWarning, got %v", err)
+	}
+}
+
+// impalaHiveServer reports itself as Impala, or as the name set, and answers the extensions of Impala
+type impalaHiveServer struct {
+	operationHiveServer
+	name string
+}
+
+func (s *impalaHiveServer) GetInfo(ctx context.Context, req *hiveserver.TGetInfoReq) (*hiveserver.TGetInfoResp, error) {
+	return &hiveserver.TGetInfoResp{
+		Status:    &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		InfoValue: &hiveserver.TGetInfoValue{StringValue: thrift.StringPtr(s.name)},
+	}, nil
+}
+
+// impalaExtension answers a method of ImpalaHiveServer2Service, writing the fields of the response after its status
+type impalaExtension struct {
+	method string
+	write  func(ctx context.Context, out thrift.TProtocol)
+}
+
+func (e impalaExtension) Process(ctx context.Context, seqID int32, in, out thrift.TProtocol) (bool, thrift.TException) {
+	in.Skip(ctx, thrift.STRUCT)
+	in.ReadMessageEnd(ctx)
+	out.WriteMessageBegin(ctx, e.method, thrift.REPLY, seqID)
+	out.WriteStructBegin(ctx, e.method+"_result")
+	out.WriteFieldBegin(ctx, "success", thrift.STRUCT, 0)
+	out.WriteStructBegin(ctx, "T"+e.method+"Resp")
+	out.WriteFieldBegin(ctx, "status", thrift.STRUCT, 1)
+	(&hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS}).Write(ctx, out)
+	out.WriteFieldEnd(ctx)
+	e.write(ctx, out)
+	out.WriteFieldStop(ctx)
+	out.WriteStructEnd(ctx)
+	out.WriteFieldEnd(ctx)
+	out.WriteFieldStop(ctx)
+	out.WriteStructEnd(ctx)
+	out.WriteMessageEnd(ctx)
+	if err := out.Flush(ctx); err != nil {
+		return false, thrift.WrapTException(err)
+	}
+	return true, nil
+}
+
+func TestImpalaExtensions(t *testing.T) {
+	server := &impalaHiveServer{name: "Impala"}
+	processor := hiveserver.NewTCLIServiceProcessor(server)
+	processor.AddToProcessorMap("GetRuntimeProfile", impalaExtension{"GetRuntimeProfile", func(ctx context.Context, out thrift.TProtocol) {
+		out.WriteFieldBegin(ctx, "profile", thrift.STRING, 2)
+		out.WriteString(ctx, "Query (id=1:2):\n  Summary:")
+		out.WriteFieldEnd(ctx)
+	}})
+	processor.AddToProcessorMap("GetExecSummary", impalaExtension{"GetExecSummary", func(ctx context.Context, out thrift.TProtocol) {
+		i32 := func(id int16, value int32) {
+			out.WriteFieldBegin(ctx, "", thrift.I32, id)
+			out.WriteI32(ctx, value)
+			out.WriteFieldEnd(ctx)
+		}
+		i64 := func(id int16, value int64) {
+			out.WriteFieldBegin(ctx, "", thrift.I64, id)
+			out.WriteI64(ctx, value)
+			out.WriteFieldEnd(ctx)
+		}
+		str := func(id int16, value string) {
+			out.WriteFieldBegin(ctx, "", thrift.STRING, id)
+			out.WriteString(ctx, value)
+			out.WriteFieldEnd(ctx)
+		}
+		out.WriteFieldBegin(ctx, "summary", thrift.STRUCT, 2)
+		out.WriteStructBegin(ctx, "TExecSummary")
+		i32(1, 3)
+		out.WriteFieldBegin(ctx, "nodes", thrift.LIST, 3)
+		out.WriteListBegin(ctx, thrift.STRUCT, 1)
+		out.WriteStructBegin(ctx, "TPlanNodeExecSummary")
+		i32(1, 0)
+		i32(2, 1)
+		str(3, "00:SCAN HDFS")
+		str(4, "default.t")
+		i32(5, 0)
+		out.WriteFieldBegin(ctx, "estimated_stats", thrift.STRUCT, 6)
+		out.WriteStructBegin(ctx, "TExecStats")
+		i64(3, 100)
+		i64(4, 1024)
+		out.WriteFieldStop(ctx)
+		out.WriteStructEnd(ctx)
+		out.WriteFieldEnd(ctx)
+		out.WriteFieldBegin(ctx, "exec_stats", thrift.LIST, 7)
+		out.WriteListBegin(ctx, thrift.STRUCT, 1)
+		out.WriteStructBegin(ctx, "TExecStats")
+		i64(1, int64(time.Millisecond))
+		i64(2, int64(time.Microsecond))
+		i64(3, 42)
+		i64(4, 2048)
+		out.WriteFieldStop(ctx)
+		out.WriteStructEnd(ctx)
+		out.WriteListEnd(ctx)
+		out.WriteFieldEnd(ctx)
+		i32(9, 1)
+		out.WriteFieldStop(ctx)
+		out.WriteStructEnd(ctx)
+		out.WriteListEnd(ctx)
+		out.WriteFieldEnd(ctx)
+		out.WriteFieldBegin(ctx, "error_logs", thrift.LIST, 5)
+		out.WriteListBegin(ctx, thrift.STRING, 1)
+		out.WriteString(ctx, "Some warning")
+		out.WriteListEnd(ctx)
+		out.WriteFieldEnd(ctx)
+		out.WriteFieldBegin(ctx, "progress", thrift.STRUCT, 6)
+		out.WriteStructBegin(ctx, "TExecProgress")
+		i64(1, 4)
+		i64(2, 2)
+		out.WriteFieldStop(ctx)
+		out.WriteStructEnd(ctx)
+		out.WriteFieldEnd(ctx)
+		str(8, "Waiting for resources")
+		str(20, "Unknown field")
+		out.WriteFieldStop(ctx)
+		out.WriteStructEnd(ctx)
+		out.WriteFieldEnd(ctx)
+	}})
+	host, port := startFakeHiveServerProcessor(t, processor, thrift.NewTTransportFactory())
+	configuration := NewConnectConfiguration()
+	configuration.ImpalaExtensions = true
+	connection, err := Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	if _, err = cursor.RuntimeProfile(context.Background()); err == nil {
+		t.Fatal("Expected an error before executing a query")
+	}
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+
+	profile, err := cursor.RuntimeProfile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(profile, "Query (id=1:2)") {
+		t.Fatalf("Unexpected profile %q", profile)
+	}
+	summary, err := cursor.ExecSummary(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ImpalaExecSummary{
+		State: "RUNNING",
+		Nodes: []ImpalaPlanNodeSummary{{
+			FragmentIndex: 1,
+			Label:         "00:SCAN HDFS",
+			LabelDetail:   "default.t",
+			NumHosts:      1,
+			Estimated:     ImpalaExecStats{Rows: 100, Memory: 1024},
+			Instances:     []ImpalaExecStats{{Latency: time.Millisecond, CPUTime: time.Microsecond, Rows: 42, Memory: 2048}},
+		}},
+		ErrorLogs:           []string{"Some warning"},
+		CompletedScanRanges: 2,
+		TotalScanRanges:     4,
+		QueuedReason:        "Waiting for resources",
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, summary)
+	}
+
+	// The extensions aren't called against other servers
+	server.name = "Apache Hive"
+	other, err := Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	otherCursor := other.Cursor()
+	defer otherCursor.Close()
+	otherCursor.Exec(context.Background(), "SELECT * FROM t")
+	if _, err = otherCursor.ExecSummary(context.Background()); !errors.Is(err, ErrNotImpala) {
+		t.Fatalf("Expected ErrNotImpala, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package gohive
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// CSVOptions configures how WriteCSV and CSVReader write the rows
+type CSVOptions struct {
+	// Field delimiter, ',' if zero
+	Comma rune
+	// Write the names of the columns as the first record
+	Header bool
+	// Text written for NULL values, an empty field by default
+	Null string
+	// End the records with \r\n instead of \n
+	UseCRLF bool
+}
+
+// WriteCSV fetches all the remaining rows of the cursor and writes them to w as CSV, quoting the fields when needed.
+// BINARY values are written as they are and the other types as the text returned by RowMap.
+func (c *Cursor) WriteCSV(ctx context.Context, w io.Writer, opts *CSVOptions) error {
+	if opts == nil {
+		opts = &CSVOptions{}
+	}
+	schema := c.schema(ctx)
+	if c.Err != nil {
+		return c.Err
+	}
+	if schema == nil {
+		return errors.New("The result set doesn't have a schema")
+	}
+
+	writer := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		writer.Comma = opts.Comma
+	}
+	writer.UseCRLF = opts.UseCRLF
+	record := make([]string, len(schema))
+	if opts.Header {
+		for i, desc := range schema {
+			record[i] = desc.ColumnName
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	for c.HasMore(ctx) {
+		if c.Err != nil {
+			return c.Err
+		}
+		if len(c.queue) != len(schema) {
+			return errors.Errorf("%d columns were received but the schema has %d", len(c.queue), len(schema))
+		}
+		for c.columnIndex < c.totalRows {
+			for i, column := range c.queue {
+				record[i] = csvField(columnValue(column, c.columnIndex), opts.Null)
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+			c.consumeRows(c.columnIndex + 1)
+		}
+	}
+	if c.Err != nil {
+		return c.Err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvField(value interface{}, null string) string {
+	switch v := value.(type) {
+	case nil:
+		return null
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// CSVReader executes the query and returns a reader of its result as CSV, like WriteCSV writes it. The rows are
+// fetched as the reader is read, so the result is never kept in memory. An error fetching them is returned by Read.
+// The cursor can't be used until the reader is closed, Close stops fetching and waits for the fetch in progress.
+func (c *Cursor) CSVReader(ctx context.Context, query string, opts *CSVOptions) (io.ReadCloser, error) {
+	c.Exec(ctx, query)
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writer.CloseWithError(c.WriteCSV(ctx, writer, opts))
+	}()
+	return &csvReader{PipeReader: reader, cancel: cancel, done: done}, nil
+}
+
+type csvReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *csvReader) Close() error {
+	r.cancel()
+	err := r.PipeReader.Close()
+	<-r.done
+	return err
+}
@@ -0,0 +1,66 @@
+package gohive
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestCSVField(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "NULL"},
+		{true, "true"},
+		{int8(-1), "-1"},
+		{int64(1) << 40, "1099511627776"},
+		{0.5, "0.5"},
+		{"a,b", "a,b"},
+		{[]byte("raw"), "raw"},
+	}
+	for _, test := range tests {
+		if field := csvField(test.value, "NULL"); field != test.expected {
+			t.Fatalf("Expected %q for %v, got %q", test.expected, test.value, field)
+		}
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.FetchSize = 2
+	connection := connectFakeHiveServer(t, &operationHiveServer{rows: 5}, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+
+	reader, err := cursor.CSVReader(context.Background(), "SELECT * FROM t", &CSVOptions{Header: true, UseCRLF: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "t.n\r\n0\r\n1\r\n2\r\n3\r\n4\r\n"; string(data) != expected {
+		t.Fatalf("Expected %q, got %q", expected, data)
+	}
+
+	reader, err = cursor.CSVReader(context.Background(), "SELECT * FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := make([]byte, 2)
+	if _, err = io.ReadFull(reader, line); err != nil || string(line) != "0\n" {
+		t.Fatalf("Expected the first row, got %q (%v)", line, err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reader.Read(line); err == nil {
+		t.Fatal("Expected an error reading after closing")
+	}
+}
@@ -0,0 +1,63 @@
+package gohive
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var useStatement = regexp.MustCompile("(?is)^\\s*use\\s+(`(?:[^`]|``)+`|[a-z0-9_]+)\\s*;?\\s*$")
+
+// useStatementDatabase returns the database selected by query if it's a USE statement.
+// Hive database names are case insensitive and stored in lower case.
+func useStatementDatabase(query string) (string, bool) {
+	match := useStatement.FindStringSubmatch(query)
+	if match == nil {
+		return "", false
+	}
+	database := match[1]
+	if strings.HasPrefix(database, "`") {
+		database = strings.ReplaceAll(database[1:len(database)-1], "``", "`")
+	}
+	return strings.ToLower(database), true
+}
+
+// setDatabase records the database of the session, an empty one means it's unknown
+func (c *Connection) setDatabase(database string) {
+	c.databaseLock.Lock()
+	defer c.databaseLock.Unlock()
+	c.database = database
+}
+
+// CurrentDatabase returns the database the session is in.
+// It's tracked from the Database of the configuration and the USE statements executed synchronously,
+// otherwise it's asked to the server with SELECT current_database() and cached.
+func (c *Connection) CurrentDatabase(ctx context.Context) (string, error) {
+	c.databaseLock.Lock()
+	database := c.database
+	c.databaseLock.Unlock()
+	if database != "" {
+		return database, nil
+	}
+
+	cursor := c.Cursor()
+	defer cursor.Close()
+	cursor.Exec(ctx, "SELECT current_database()")
+	if cursor.Err != nil {
+		return "", cursor.Err
+	}
+	if !cursor.HasMore(ctx) {
+		if cursor.Err != nil {
+			return "", cursor.Err
+		}
+		return "", errors.New("current_database() didn't return any row")
+	}
+	cursor.FetchOne(ctx, &database)
+	if cursor.Err != nil {
+		return "", cursor.Err
+	}
+	c.setDatabase(database)
+	return database, nil
+}
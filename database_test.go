@@ -0,0 +1,51 @@
+package gohive
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUseStatementDatabase(t *testing.T) {
+	tests := []struct {
+		query    string
+		database string
+		ok       bool
+	}{
+		{"USE sales", "sales", true},
+		{"  use Sales;  ", "sales", true},
+		{"use `my``db`", "my`db", true},
+		{"USE\n\tdefault", "default", true},
+		{"SELECT 1", "", false},
+		{"USE a; SELECT 1", "", false},
+		{"useless", "", false},
+	}
+	for _, test := range tests {
+		database, ok := useStatementDatabase(test.query)
+		if database != test.database || ok != test.ok {
+			t.Errorf("%q: expected (%q, %v), got (%q, %v)", test.query, test.database, test.ok, database, ok)
+		}
+	}
+}
+
+func TestCurrentDatabaseTracksUse(t *testing.T) {
+	server := &operationHiveServer{}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+	database, err := connection.CurrentDatabase(context.Background())
+	if err != nil || database != "default" {
+		t.Fatalf("Expected default, got %q, %v", database, err)
+	}
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "USE `Sales`")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	database, err = connection.CurrentDatabase(context.Background())
+	if err != nil || database != "sales" {
+		t.Fatalf("Expected sales, got %q, %v", database, err)
+	}
+	if server.executions != 1 {
+		t.Fatalf("Expected only the USE statement to be executed, got %d executions", server.executions)
+	}
+}
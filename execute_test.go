@@ -0,0 +1,487 @@
+package gohive
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestHiveErrorCategory(t *testing.T) {
+	tests := []struct {
+		err      HiveError
+		category ErrorCategory
+	}{
+		{HiveError{ErrorCode: 10001}, ErrorCategorySemantic},
+		{HiveError{ErrorCode: 20003}, ErrorCategoryRuntime},
+		{HiveError{ErrorCode: 30041}, ErrorCategoryRetryable},
+		{HiveError{ErrorCode: 40000}, ErrorCategoryUnadvised},
+		{HiveError{ErrorCode: 40000, Message: "Error while compiling statement: FAILED: HiveAccessControlException Permission denied"}, ErrorCategoryAuthorization},
+		{HiveError{ErrorCode: -1}, ErrorCategoryUnknown},
+	}
+	for _, test := range tests {
+		if category := test.err.Category(); category != test.category {
+			t.Errorf("Expected %s for %d, got %s", test.category, test.err.ErrorCode, category)
+		}
+	}
+}
+
+func TestQueryTag(t *testing.T) {
+	server := &operationHiveServer{}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+
+	cursor.Execute(WithQueryTag(context.Background(), "etl-nightly"), "SELECT 1", true)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if tag := server.confOverlay["hive.query.tag"]; tag != "etl-nightly" {
+		t.Fatalf("Expected the tag to be sent with the statement, got %v", server.confOverlay)
+	}
+	cursor.Exec(context.Background(), "SELECT 1")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if server.confOverlay != nil {
+		t.Fatalf("Expected no tag without WithQueryTag, got %v", server.confOverlay)
+	}
+}
+
+func TestProducesResultSet(t *testing.T) {
+	server := &operationHiveServer{}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+	cursor := connection.Cursor()
+	if cursor.ProducesResultSet() {
+		t.Fatal("Expected no result set before executing a statement")
+	}
+	cursor.Exec(context.Background(), "INSERT INTO t VALUES (1)")
+	if cursor.Err != nil || cursor.ProducesResultSet() {
+		t.Fatalf("Expected no result set for the INSERT, got %v", cursor.Err)
+	}
+	server.resultSet = true
+	cursor.Exec(context.Background(), "SELECT 1")
+	if cursor.Err != nil || !cursor.ProducesResultSet() {
+		t.Fatalf("Expected a result set for the SELECT, got %v", cursor.Err)
+	}
+	cursor.Close()
+	if cursor.ProducesResultSet() {
+		t.Fatal("Expected no result set after closing the cursor")
+	}
+}
+
+func TestOnExecute(t *testing.T) {
+	server := &operationHiveServer{}
+	errDDL := errors.New("DDL isn't allowed")
+	var audit []string
+	configuration := NewConnectConfiguration()
+	configuration.OnExecute = func(ctx context.Context, query string) error {
+		audit = append(audit, "execute "+query)
+		if strings.HasPrefix(query, "DROP") {
+			return errDDL
+		}
+		return nil
+	}
+	configuration.OnResult = func(ctx context.Context, query string, result *ExecResult, err error) {
+		if err != nil || result == nil || result.OperationID == "" {
+			t.Errorf("Expected the result of %s with its operation id, got %+v and %v", query, result, err)
+		}
+		audit = append(audit, "result "+query)
+	}
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+
+	cursor.Exec(context.Background(), "SELECT 1")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	cursor.Exec(context.Background(), "DROP TABLE t")
+	if !errors.Is(cursor.Err, errDDL) {
+		t.Fatalf("Expected the statement to be rejected, got %v", cursor.Err)
+	}
+	if server.executions != 1 {
+		t.Fatalf("Expected the rejected statement not to be sent, got %d executions", server.executions)
+	}
+	expected := []string{"execute SELECT 1", "result SELECT 1", "execute DROP TABLE t"}
+	if !reflect.DeepEqual(audit, expected) {
+		t.Fatalf("Expected %v, got %v", expected, audit)
+	}
+}
+
+func TestOnResultWhenFinished(t *testing.T) {
+	server := &operationHiveServer{runningPolls: 3, preemptions: 1}
+	type report struct {
+		query  string
+		result ExecResult
+		err    error
+	}
+	var reports []report
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	configuration.OnResult = func(ctx context.Context, query string, result *ExecResult, err error) {
+		reports = append(reports, report{query: query, result: *result, err: err})
+	}
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+
+	// The failure of the operation, after it was submitted, reaches OnResult
+	cursor.Exec(context.Background(), "SELECT 1")
+	if !errors.Is(cursor.Err, ErrCanceledByServer) {
+		t.Fatalf("Expected ErrCanceledByServer, got %v", cursor.Err)
+	}
+	if len(reports) != 1 || !errors.Is(reports[0].err, ErrCanceledByServer) {
+		t.Fatalf("Expected the error of the operation to be reported, got %+v", reports)
+	}
+
+	// An async statement is reported when WaitForCompletion sees it end, with its duration
+	cursor.Execute(context.Background(), "SELECT 2", true)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("Expected the async statement not to be reported before it ends, got %+v", reports)
+	}
+	cursor.WaitForCompletion(context.Background())
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if len(reports) != 2 || reports[1].query != "SELECT 2" || reports[1].err != nil || reports[1].result.Duration <= 0 {
+		t.Fatalf("Expected the async statement to be reported once it finished, got %+v", reports)
+	}
+	cursor.WaitForCompletion(context.Background())
+	if len(reports) != 2 {
+		t.Fatalf("Expected the statement to be reported once, got %+v", reports)
+	}
+}
+
+func TestStreamLogs(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	connection := connectFakeHiveServer(t, &operationHiveServer{logLines: 3}, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	logs, err := cursor.StreamLogs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for len(lines) < 3 {
+		lines = append(lines, <-logs...)
+	}
+	if !reflect.DeepEqual(lines, []string{"log 0", "log 1", "log 2"}) {
+		t.Fatalf("Unexpected logs %v", lines)
+	}
+	cursor.Close()
+	for range logs {
+	}
+}
+
+func TestWaitForCompletionWithLogs(t *testing.T) {
+	// The operation runs for 3 polls and is canceled by the server
+	server := &operationHiveServer{logLines: 5, runningPolls: 3, preemptions: 1}
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+
+	cursor.Execute(context.Background(), "SELECT * FROM t", true)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	logs, err := cursor.WaitForCompletionWithLogs(context.Background(), 0)
+	if !errors.Is(err, ErrCanceledByServer) || cursor.Err != err {
+		t.Fatalf("Expected the error of the operation, got %v", err)
+	}
+	if !reflect.DeepEqual(logs, []string{"log 0", "log 1", "log 2", "log 3", "log 4"}) {
+		t.Fatalf("Expected the logs while running and the ones left after, got %v", logs)
+	}
+
+	// The wait times out with the logs fetched so far
+	server.runningPolls = 1 << 30
+	cursor.Execute(context.Background(), "SELECT * FROM t", true)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	logs, err = cursor.WaitForCompletionWithLogs(context.Background(), 50*time.Millisecond)
+	if err == nil {
+		t.Fatal("Expected the wait to time out")
+	}
+	if len(logs) != 5 {
+		t.Fatalf("Expected the logs, got %v", logs)
+	}
+}
+
+func TestQueryRow(t *testing.T) {
+	server := &operationHiveServer{}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+	cursor := connection.Cursor()
+
+	server.rows = 1
+	var value int32 = -1
+	if err := cursor.QueryRow(context.Background(), "SELECT count(*) FROM t", &value); err != nil {
+		t.Fatal(err)
+	}
+	if value != 0 {
+		t.Fatalf("Expected 0, got %d", value)
+	}
+	if !server.closed {
+		t.Fatal("Expected the operation to be closed")
+	}
+
+	server.rows = 0
+	if err := cursor.QueryRow(context.Background(), "SELECT 1 FROM t", &value); !errors.Is(err, ErrNoRows) {
+		t.Fatalf("Expected ErrNoRows, got %v", err)
+	}
+
+	server.rows = 2
+	if err := cursor.QueryRow(context.Background(), "SELECT 1 FROM t", &value); !errors.Is(err, ErrTooManyRows) {
+		t.Fatalf("Expected ErrTooManyRows, got %v", err)
+	}
+	if !errors.Is(cursor.Err, ErrTooManyRows) {
+		t.Fatalf("Expected the error to be kept in the cursor, got %v", cursor.Err)
+	}
+	if !server.closed {
+		t.Fatal("Expected the operation to be closed")
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	server := &operationHiveServer{rows: 10, pendingPolls: 2, runningPolls: 100}
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	columns, err := cursor.Prepare(context.Background(), "SELECT n FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ColumnType{{Name: "t.n", HiveType: "INT_TYPE", GoType: reflect.TypeOf(int32(0))}}
+	if !reflect.DeepEqual(columns, expected) {
+		t.Fatalf("Expected %v, got %v", expected, columns)
+	}
+	if server.polls != 3 {
+		t.Fatalf("Expected to wait until the operation was running, got %d polls", server.polls)
+	}
+	if !server.canceled || !server.closed || server.fetches != 0 {
+		t.Fatalf("Expected the operation to be canceled and closed without fetching, got canceled %v, closed %v and %d fetches", server.canceled, server.closed, server.fetches)
+	}
+}
+
+func TestAutoClose(t *testing.T) {
+	server := &operationHiveServer{rows: 3}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+	for _, autoClose := range []bool{false, true} {
+		var opts []CursorOption
+		if autoClose {
+			opts = append(opts, WithAutoClose())
+		}
+		cursor := connection.Cursor(opts...)
+		cursor.Exec(context.Background(), "SELECT * FROM t")
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		var value int32
+		for cursor.HasMore(context.Background()) {
+			cursor.FetchOne(context.Background(), &value)
+			if cursor.Err != nil {
+				t.Fatal(cursor.Err)
+			}
+		}
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		if server.closed != autoClose || value != 2 {
+			t.Fatalf("Expected the operation to be closed %v after reading the rows, got %v and %d", autoClose, server.closed, value)
+		}
+		if cursor.HasMore(context.Background()) || cursor.Err != nil {
+			t.Fatalf("Expected no more rows, got %v", cursor.Err)
+		}
+		cursor.Close()
+	}
+}
+
+func TestRetryPreemptedQuery(t *testing.T) {
+	server := &operationHiveServer{preemptions: 2}
+	var attempts []int
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	configuration.PreemptionRetries = 2
+	configuration.PreemptionBackoff = time.Millisecond
+	configuration.OnPreemption = func(query string, attempt int, err error) {
+		attempts = append(attempts, attempt)
+	}
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	cursor.Exec(context.Background(), "INSERT INTO t VALUES (1)")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if server.executions != 3 || !reflect.DeepEqual(attempts, []int{1, 2}) {
+		t.Fatalf("Expected 3 executions and 2 preemptions, got %d and %v", server.executions, attempts)
+	}
+
+	server.executions, server.preemptions = 0, 5
+	cursor.Exec(context.Background(), "INSERT INTO t VALUES (1)")
+	if !errors.Is(cursor.Err, ErrCanceledByServer) {
+		t.Fatalf("Expected ErrCanceledByServer, got %v", cursor.Err)
+	}
+	if server.executions != 3 {
+		t.Fatalf("Expected 3 executions, got %d", server.executions)
+	}
+	cursor.Close()
+}
+
+func TestSubmitAsync(t *testing.T) {
+	server := &operationHiveServer{runningPolls: 50, preemptions: 1, rows: 3, resultSet: true}
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	configuration.PreemptionRetries = 1
+	configuration.PreemptionBackoff = time.Millisecond
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	done, err := cursor.SubmitAsync(context.Background(), "SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+		t.Fatal("Expected SubmitAsync to return before the query finished")
+	default:
+	}
+	<-done
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if server.executions != 2 {
+		t.Fatalf("Expected the preempted query to run again, got %d executions", server.executions)
+	}
+	var rows int
+	for cursor.HasMore(context.Background()) {
+		var n int32
+		cursor.FetchOne(context.Background(), &n)
+		rows++
+	}
+	if cursor.Err != nil || rows != 3 {
+		t.Fatalf("Expected 3 rows, got %d and %v", rows, cursor.Err)
+	}
+	cursor.Close()
+
+	configuration.OnExecute = func(ctx context.Context, query string) error {
+		return errors.New("denied")
+	}
+	cursor = connection.Cursor()
+	if done, err = cursor.SubmitAsync(context.Background(), "SELECT * FROM t"); err == nil || done != nil {
+		t.Fatalf("Expected the rejected query to fail on submission, got %v", err)
+	}
+	cursor.Close()
+}
+
+func TestMaxStatementBytes(t *testing.T) {
+	server := &operationHiveServer{}
+	configuration := NewConnectConfiguration()
+	configuration.MaxStatementBytes = 60
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+
+	cursor.Exec(context.Background(), "SELECT * FROM t WHERE s = '"+strings.Repeat("x", 64)+"'")
+	if !errors.Is(cursor.Err, ErrStatementTooLong) || !strings.Contains(cursor.Err.Error(), "smaller batches") {
+		t.Fatalf("Expected ErrStatementTooLong, got %v", cursor.Err)
+	}
+	if server.executions != 0 {
+		t.Fatal("The statement shouldn't have been sent")
+	}
+
+	rows := [][]interface{}{{1, "a"}, {2, "b"}, {3, nil}, {4, "d"}}
+	inserted, err := cursor.InsertRows(context.Background(), "db.t", []string{"n", "s"}, rows)
+	if err != nil || inserted != 4 {
+		t.Fatalf("Expected 4 rows inserted, got %d and %v", inserted, err)
+	}
+	expected := []string{
+		"INSERT INTO db.t (`n`, `s`) VALUES (1, 'a'), (2, 'b')",
+		"INSERT INTO db.t (`n`, `s`) VALUES (3, NULL), (4, 'd')",
+	}
+	if !reflect.DeepEqual(server.statements, expected) {
+		t.Fatalf("Expected %q, got %q", expected, server.statements)
+	}
+
+	server.statements = nil
+	inserted, err = cursor.InsertRows(context.Background(), "db.t", nil, [][]interface{}{{1, "a"}, {2, strings.Repeat("x", 64)}})
+	if !errors.Is(err, ErrStatementTooLong) || inserted != 0 || len(server.statements) != 0 {
+		t.Fatalf("Expected ErrStatementTooLong for a row too long before inserting, got %d rows and %v", inserted, err)
+	}
+
+	configuration.MaxStatementBytes = 0
+	if inserted, err = cursor.InsertRows(context.Background(), "t", nil, rows); err != nil || inserted != 4 || len(server.statements) != 1 {
+		t.Fatalf("Expected a single statement without a limit, got %q and %v", server.statements, err)
+	}
+}
+
+func TestOperationStates(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	connection := connectFakeHiveServer(t, &operationHiveServer{runningPolls: 3}, configuration)
+	defer connection.Close()
+	states := make(chan hiveserver.TOperationState, 10)
+	cursor := connection.Cursor()
+	cursor.States = states
+	cursor.Exec(context.Background(), "INSERT INTO t VALUES (1)")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	close(states)
+	var received []hiveserver.TOperationState
+	for state := range states {
+		received = append(received, state)
+	}
+	expected := []hiveserver.TOperationState{hiveserver.TOperationState_RUNNING_STATE, hiveserver.TOperationState_FINISHED_STATE}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Expected %v, got %v", expected, received)
+	}
+	cursor.Close()
+}
+
+func TestNextResultSet(t *testing.T) {
+	cursor := memoryCursor(2)
+	if cursor.NextResultSet(context.Background()) {
+		t.Fatal("Expected a single result set")
+	}
+	if cursor.Buffered() != 2 || cursor.Err != nil {
+		t.Fatalf("Expected the current result set to be kept, got %d rows and %v", cursor.Buffered(), cursor.Err)
+	}
+}
+
+func TestCursorOptions(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	connection := &Connection{configuration: configuration}
+	cursor := connection.Cursor()
+	if cursor.getFetchSize() != DEFAULT_FETCH_SIZE || cursor.getPollInterval() != 200*time.Millisecond {
+		t.Fatalf("Expected the connection settings, got %d and %s", cursor.getFetchSize(), cursor.getPollInterval())
+	}
+	cursor = connection.Cursor(WithFetchSize(10), WithPollInterval(time.Second))
+	if cursor.getFetchSize() != 10 || cursor.getPollInterval() != time.Second {
+		t.Fatalf("Expected the cursor settings, got %d and %s", cursor.getFetchSize(), cursor.getPollInterval())
+	}
+}
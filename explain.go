@@ -0,0 +1,199 @@
+package gohive
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PlanNode is a node of the plan of a query returned by EXPLAIN FORMATTED: a stage, a vertex, an operator or a
+// section of them
+type PlanNode struct {
+	// Name of the node, for example "Stage-1", "Map 1", "Map Operator Tree" or "TableScan". The root is unnamed.
+	Name string
+	// Properties of the node by name without the trailing colon, for example "alias" or "OperatorId". The values are
+	// strings, numbers, booleans, or slices and maps of them.
+	Attributes map[string]interface{}
+	// Nodes in the order of the plan. The operators that follow an operator are its children.
+	Children []*PlanNode
+}
+
+// Walk calls fn with the node and its descendants in depth-first order, the children of a node are skipped if it
+// returns false
+func (n *PlanNode) Walk(fn func(node *PlanNode) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, child := range n.Children {
+		child.Walk(fn)
+	}
+}
+
+// Find returns the nodes of the tree with the name, for example all the "TableScan" operators
+func (n *PlanNode) Find(name string) []*PlanNode {
+	var nodes []*PlanNode
+	n.Walk(func(node *PlanNode) bool {
+		if node.Name == name {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
+}
+
+// ExplainTree runs EXPLAIN FORMATTED for the query and parses the plan with ParsePlan
+func (c *Cursor) ExplainTree(ctx context.Context, query string) (*PlanNode, error) {
+	plan, err := c.Explain(ctx, query, ExplainFormatted)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePlan(plan)
+}
+
+// ParsePlan parses the JSON plan of EXPLAIN FORMATTED into a tree. The objects of the plan are nodes named by their
+// keys, except the ones of the properties, whose keys end with a colon and only have simple values, which become
+// attributes. Each object of a list is a node named by the key of the list, and the operators under "children" are
+// children of their operator.
+func ParsePlan(plan string) (*PlanNode, error) {
+	decoder := json.NewDecoder(strings.NewReader(plan))
+	value, err := readPlanValue(decoder)
+	if err != nil {
+		return nil, errors.Wrap(err, "The plan isn't valid JSON")
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return nil, errors.New("The plan isn't valid JSON: unexpected data after the plan")
+	}
+	object, ok := value.(*planObject)
+	if !ok {
+		return nil, errors.New("The plan isn't a JSON object")
+	}
+	return newPlanNode("", object), nil
+}
+
+// planObject is a JSON object keeping the order of its keys, which is the order of the plan
+type planObject struct {
+	keys   []string
+	values []interface{}
+}
+
+// simple returns whether the values of the object are neither objects nor lists of objects
+func (o *planObject) simple() bool {
+	for _, value := range o.values {
+		if _, ok := value.(*planObject); ok || hasPlanObjects(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasPlanObjects(value interface{}) bool {
+	values, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, value := range values {
+		if _, ok := value.(*planObject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func readPlanValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		object := &planObject{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readPlanValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object.keys = append(object.keys, key.(string))
+			object.values = append(object.values, value)
+		}
+		_, err = decoder.Token()
+		return object, err
+	case json.Delim('['):
+		values := []interface{}{}
+		for decoder.More() {
+			value, err := readPlanValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		_, err = decoder.Token()
+		return values, err
+	}
+	return token, nil
+}
+
+func newPlanNode(name string, object *planObject) *PlanNode {
+	node := &PlanNode{Name: name, Attributes: make(map[string]interface{})}
+	node.add(object)
+	return node
+}
+
+// add adds the entries of the object to the node
+func (n *PlanNode) add(object *planObject) {
+	for i, key := range object.keys {
+		name := strings.TrimSuffix(key, ":")
+		switch value := object.values[i].(type) {
+		case *planObject:
+			if key == "children" {
+				n.add(value)
+			} else if strings.HasSuffix(key, ":") && value.simple() {
+				n.Attributes[name] = planAttribute(value)
+			} else {
+				n.Children = append(n.Children, newPlanNode(name, value))
+			}
+		case []interface{}:
+			if !hasPlanObjects(value) {
+				n.Attributes[name] = planAttribute(value)
+				continue
+			}
+			for _, element := range value {
+				element, ok := element.(*planObject)
+				if !ok {
+					continue
+				}
+				if key == "children" {
+					n.add(element)
+				} else {
+					n.Children = append(n.Children, newPlanNode(name, element))
+				}
+			}
+		default:
+			n.Attributes[name] = value
+		}
+	}
+}
+
+// planAttribute converts the objects of a simple value to maps
+func planAttribute(value interface{}) interface{} {
+	switch value := value.(type) {
+	case *planObject:
+		attribute := make(map[string]interface{}, len(value.keys))
+		for i, key := range value.keys {
+			attribute[key] = planAttribute(value.values[i])
+		}
+		return attribute
+	case []interface{}:
+		for i, element := range value {
+			value[i] = planAttribute(element)
+		}
+		return value
+	}
+	return value
+}
@@ -0,0 +1,69 @@
+package gohive
+
+import (
+	"reflect"
+	"testing"
+)
+
+const formattedPlan = `{"optimizedSQL":"SELECT ` + "`a`" + ` FROM ` + "`default`.`t`" + `",
+"STAGE DEPENDENCIES":{"Stage-1":{"ROOT STAGE":"TRUE"},"Stage-0":{"DEPENDENT STAGES":"Stage-1"}},
+"STAGE PLANS":{
+	"Stage-1":{"Tez":{"DagId:":"hive_1","Edges:":{"Reducer 2":[{"parent":"Map 1","type":"SIMPLE_EDGE"},{"parent":"Map 3","type":"SIMPLE_EDGE"}]},
+		"Vertices:":{"Map 1":{"Map Operator Tree:":[{"TableScan":{"alias:":"t","columns:":["a"],"database:":"default","table:":"t","OperatorId:":"TS_0",
+			"children":{"Select Operator":{"expressions:":"a (type: int)","columnExprMap:":{"_col0":"a"},"outputColumnNames:":["_col0"],"OperatorId:":"SEL_1",
+				"children":{"File Output Operator":{"compressed:":"false","OperatorId:":"FS_2"}}}}}}],
+			"Execution mode:":"vectorized"}}}},
+	"Stage-0":{"Fetch Operator":{"limit:":"-1","Processor Tree:":{"ListSink":{"OperatorId:":"LIST_SINK_3"}}}}}}`
+
+func TestParsePlan(t *testing.T) {
+	root, err := ParsePlan(formattedPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Children) != 2 || root.Children[0].Name != "STAGE DEPENDENCIES" || root.Children[1].Name != "STAGE PLANS" {
+		t.Fatalf("Unexpected children of the root %+v", root.Children)
+	}
+	if stages := root.Children[1].Children; len(stages) != 2 || stages[0].Name != "Stage-1" || stages[1].Name != "Stage-0" {
+		t.Fatalf("Expected the stages in the order of the plan, got %+v", stages)
+	}
+
+	scans := root.Find("TableScan")
+	if len(scans) != 1 {
+		t.Fatalf("Expected a TableScan, got %d", len(scans))
+	}
+	scan := scans[0]
+	if scan.Attributes["alias"] != "t" || scan.Attributes["OperatorId"] != "TS_0" || !reflect.DeepEqual(scan.Attributes["columns"], []interface{}{"a"}) {
+		t.Fatalf("Unexpected attributes %v", scan.Attributes)
+	}
+	if len(scan.Children) != 1 || scan.Children[0].Name != "Select Operator" {
+		t.Fatalf("Expected the Select Operator to be a child of the TableScan, got %+v", scan.Children)
+	}
+	selectOperator := scan.Children[0]
+	if !reflect.DeepEqual(selectOperator.Attributes["columnExprMap"], map[string]interface{}{"_col0": "a"}) {
+		t.Fatalf("Expected columnExprMap as an attribute, got %v", selectOperator.Attributes)
+	}
+	if len(selectOperator.Children) != 1 || selectOperator.Children[0].Name != "File Output Operator" {
+		t.Fatalf("Unexpected children of the Select Operator %+v", selectOperator.Children)
+	}
+	if edges := root.Find("Reducer 2"); len(edges) != 2 || edges[1].Attributes["parent"] != "Map 3" {
+		t.Fatalf("Expected a node per edge, got %+v", edges)
+	}
+	if sinks := root.Find("ListSink"); len(sinks) != 1 || sinks[0].Attributes["OperatorId"] != "LIST_SINK_3" {
+		t.Fatalf("Unexpected ListSink %+v", sinks)
+	}
+
+	visited := 0
+	root.Walk(func(node *PlanNode) bool {
+		visited++
+		return node.Name != "STAGE PLANS"
+	})
+	if visited != 5 {
+		t.Fatalf("Expected the stage plans to be skipped, visited %d nodes", visited)
+	}
+
+	for _, plan := range []string{"STAGE DEPENDENCIES:", `["a"]`, `{"a":1} {}`, `{"a":`} {
+		if _, err := ParsePlan(plan); err == nil {
+			t.Errorf("Expected an error for %q", plan)
+		}
+	}
+}
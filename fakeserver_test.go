@@ -0,0 +1,206 @@
+package gohive
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+// fakeHiveServer answers the RPCs needed for opening and closing sessions, any other RPC panics
+type fakeHiveServer struct {
+	hiveserver.TCLIService
+	sessions atomic.Int32
+}
+
+func (s *fakeHiveServer) OpenSession(ctx context.Context, req *hiveserver.TOpenSessionReq) (*hiveserver.TOpenSessionResp, error) {
+	s.sessions.Add(1)
+	return &hiveserver.TOpenSessionResp{
+		Status:                &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		ServerProtocolVersion: req.ClientProtocol,
+		SessionHandle: &hiveserver.TSessionHandle{
+			SessionId: &hiveserver.THandleIdentifier{GUID: make([]byte, 16), Secret: make([]byte, 16)},
+		},
+	}, nil
+}
+
+func (s *fakeHiveServer) CloseSession(ctx context.Context, req *hiveserver.TCloseSessionReq) (*hiveserver.TCloseSessionResp, error) {
+	return &hiveserver.TCloseSessionResp{Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS}}, nil
+}
+
+func (s *fakeHiveServer) GetInfo(ctx context.Context, req *hiveserver.TGetInfoReq) (*hiveserver.TGetInfoResp, error) {
+	return &hiveserver.TGetInfoResp{
+		Status:    &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		InfoValue: &hiveserver.TGetInfoValue{StringValue: thrift.StringPtr("Hive")},
+	}, nil
+}
+
+// startFakeHiveServer serves the handler in the binary transport without authentication (NOSASL)
+func startFakeHiveServer(t *testing.T, handler hiveserver.TCLIService) (string, int) {
+	return startFakeHiveServerTransport(t, handler, thrift.NewTTransportFactory())
+}
+
+// connectFakeHiveServer starts a fake server with the handler and connects to it without SASL
+func connectFakeHiveServer(t *testing.T, handler hiveserver.TCLIService, configuration *ConnectConfiguration) *Connection {
+	host, port := startFakeHiveServer(t, handler)
+	connection, err := Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return connection
+}
+
+// startFakeHiveServerTransport starts the server with the transports of the factory, for example framed ones
+func startFakeHiveServerTransport(t *testing.T, handler hiveserver.TCLIService, transportFactory thrift.TTransportFactory) (string, int) {
+	return startFakeHiveServerProcessor(t, hiveserver.NewTCLIServiceProcessor(handler), transportFactory)
+}
+
+// startFakeHiveServerProcessor serves the processor, which can have methods other than the ones of TCLIService
+func startFakeHiveServerProcessor(t *testing.T, processor thrift.TProcessor, transportFactory thrift.TTransportFactory) (string, int) {
+	serverSocket, err := thrift.NewTServerSocket("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = serverSocket.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	server := thrift.NewTSimpleServer4(processor, serverSocket, transportFactory, thrift.NewTBinaryProtocolFactoryConf(nil))
+	go server.Serve()
+	t.Cleanup(func() {
+		server.Stop()
+	})
+	address := serverSocket.Addr().(*net.TCPAddr)
+	return address.IP.String(), address.Port
+}
+
+// operationHiveServer runs every statement for the given number of polls, reporting the first preemptions
+// operations as canceled and the next ones as finished
+type operationHiveServer struct {
+	fakeHiveServer
+	preemptions  int
+	executions   int
+	runningPolls int
+	polls        int
+	rows         int32
+	fetched      int32
+	logLines     int
+	logsFetched  int
+	closed       bool
+	noColumns    bool
+	pendingPolls int
+	canceled     bool
+	fetches      int
+	orientation  hiveserver.TFetchOrientation
+	logFormat    string
+	confOverlay  map[string]string
+	resultSet    bool
+	metadata     int
+	statements   []string
+}
+
+func (s *operationHiveServer) ExecuteStatement(ctx context.Context, req *hiveserver.TExecuteStatementReq) (*hiveserver.TExecuteStatementResp, error) {
+	s.executions++
+	s.statements = append(s.statements, req.Statement)
+	s.polls = 0
+	s.fetched = 0
+	s.logsFetched = 0
+	s.closed = false
+	s.confOverlay = req.ConfOverlay
+	return &hiveserver.TExecuteStatementResp{
+		Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		OperationHandle: &hiveserver.TOperationHandle{
+			OperationId:  &hiveserver.THandleIdentifier{GUID: make([]byte, 16), Secret: make([]byte, 16)},
+			HasResultSet: s.resultSet,
+		},
+	}, nil
+}
+
+func (s *operationHiveServer) GetOperationStatus(ctx context.Context, req *hiveserver.TGetOperationStatusReq) (*hiveserver.TGetOperationStatusResp, error) {
+	s.polls++
+	state := hiveserver.TOperationState_FINISHED_STATE
+	var message *string
+	if s.polls <= s.pendingPolls {
+		state = hiveserver.TOperationState_PENDING_STATE
+	} else if s.polls <= s.runningPolls {
+		state = hiveserver.TOperationState_RUNNING_STATE
+	} else if s.executions <= s.preemptions {
+		state = hiveserver.TOperationState_CANCELED_STATE
+		message = thrift.StringPtr("Query preempted")
+	}
+	return &hiveserver.TGetOperationStatusResp{
+		Status:         &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		OperationState: &state,
+		ErrorMessage:   message,
+	}, nil
+}
+
+func (s *operationHiveServer) CloseOperation(ctx context.Context, req *hiveserver.TCloseOperationReq) (*hiveserver.TCloseOperationResp, error) {
+	s.closed = true
+	return &hiveserver.TCloseOperationResp{Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS}}, nil
+}
+
+// FetchResults returns the numbers from 0 to rows in batches of MaxRows,
+// the logs of the operation are one line per request until logLines are sent and no columns are sent with noColumns
+func (s *operationHiveServer) CancelOperation(ctx context.Context, req *hiveserver.TCancelOperationReq) (*hiveserver.TCancelOperationResp, error) {
+	s.canceled = true
+	return &hiveserver.TCancelOperationResp{Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS}}, nil
+}
+
+func (s *operationHiveServer) GetResultSetMetadata(ctx context.Context, req *hiveserver.TGetResultSetMetadataReq) (*hiveserver.TGetResultSetMetadataResp, error) {
+	s.metadata++
+	return &hiveserver.TGetResultSetMetadataResp{
+		Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		Schema: &hiveserver.TTableSchema{Columns: []*hiveserver.TColumnDesc{{
+			ColumnName: "t.n",
+			TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{{
+				PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: hiveserver.TTypeId_INT_TYPE},
+			}}},
+		}}},
+	}, nil
+}
+
+func (s *operationHiveServer) FetchResults(ctx context.Context, req *hiveserver.TFetchResultsReq) (*hiveserver.TFetchResultsResp, error) {
+	s.fetches++
+	s.orientation = req.Orientation
+	if req.FetchType == 1 {
+		if s.closed {
+			return &hiveserver.TFetchResultsResp{Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_ERROR_STATUS}}, nil
+		}
+		lines := []string{}
+		if s.logsFetched < s.logLines {
+			format := "log %d"
+			if s.logFormat != "" {
+				format = s.logFormat
+			}
+			lines = append(lines, fmt.Sprintf(format, s.logsFetched))
+			s.logsFetched++
+		}
+		return &hiveserver.TFetchResultsResp{
+			Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+			Results: &hiveserver.TRowSet{
+				Columns: []*hiveserver.TColumn{{StringVal: &hiveserver.TStringColumn{Values: lines, Nulls: []byte{}}}},
+			},
+		}, nil
+	}
+	if s.noColumns {
+		return &hiveserver.TFetchResultsResp{
+			Status:  &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+			Results: &hiveserver.TRowSet{Columns: []*hiveserver.TColumn{}},
+		}, nil
+	}
+	values := []int32{}
+	for len(values) < int(req.MaxRows) && s.fetched < s.rows {
+		values = append(values, s.fetched)
+		s.fetched++
+	}
+	return &hiveserver.TFetchResultsResp{
+		Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		Results: &hiveserver.TRowSet{
+			Columns: []*hiveserver.TColumn{{I32Val: &hiveserver.TI32Column{Values: values, Nulls: []byte{}}}},
+		},
+	}, nil
+}
@@ -0,0 +1,468 @@
+package gohive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestHasMoreErrClosedConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	socket := thrift.NewTSocketConf(listener.Addr().String(), &thrift.TConfiguration{})
+	if err = socket.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	protocol := thrift.NewTBinaryProtocolConf(socket, &thrift.TConfiguration{})
+	cursor := &Cursor{
+		conn: &Connection{
+			client:        hiveserver.NewTCLIServiceClient(thrift.NewTStandardClient(protocol, protocol)),
+			configuration: NewConnectConfiguration(),
+		},
+		operationHandle: hiveserver.NewTOperationHandle(),
+	}
+	more, err := cursor.HasMoreErr(context.Background())
+	if err == nil || more {
+		t.Fatalf("Expected an error and no more rows, got %v and %v", more, err)
+	}
+}
+
+func TestFetchSizeUnlimited(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.FetchSize = FETCH_SIZE_UNLIMITED
+	connection := connectFakeHiveServer(t, &operationHiveServer{rows: 5000}, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	if cursor.getFetchSize() != math.MaxInt32 {
+		t.Fatalf("Expected the maximum fetch size, got %d", cursor.getFetchSize())
+	}
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	rows := 0
+	var value int32
+	for cursor.HasMore(context.Background()) {
+		cursor.FetchOne(context.Background(), &value)
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		rows++
+	}
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if rows != 5000 {
+		t.Fatalf("Expected 5000 rows, got %d", rows)
+	}
+	// The batch with the rows and the empty one telling there are no more
+	if roundTrips := connection.Stats().FetchRoundTrips; roundTrips != 2 {
+		t.Fatalf("Expected 2 round trips, got %d", roundTrips)
+	}
+	if WithFetchSize(FETCH_SIZE_UNLIMITED)(cursor); cursor.getFetchSize() != math.MaxInt32 {
+		t.Fatalf("Expected the maximum fetch size for the cursor, got %d", cursor.getFetchSize())
+	}
+}
+
+func TestRowsFetched(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.FetchSize = 2
+	connection := connectFakeHiveServer(t, &operationHiveServer{rows: 3}, configuration)
+	defer connection.Close()
+	h := sha256.New()
+	cursor := connection.Cursor(WithRowHash(h))
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	var value int32
+	for cursor.HasMore(context.Background()) {
+		cursor.FetchOne(context.Background(), &value)
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+	}
+	cursor.Close()
+	if cursor.RowsFetched() != 3 {
+		t.Fatalf("Expected 3 rows, got %d", cursor.RowsFetched())
+	}
+	if expected := sha256.Sum256([]byte("0\n1\n2\n")); !bytes.Equal(h.Sum(nil), expected[:]) {
+		t.Fatal("Unexpected hash of the rows")
+	}
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if cursor.RowsFetched() != 0 {
+		t.Fatalf("Expected the count to be reset, got %d", cursor.RowsFetched())
+	}
+	cursor.Close()
+}
+
+func TestWriteRowText(t *testing.T) {
+	columns := []*hiveserver.TColumn{
+		{StringVal: &hiveserver.TStringColumn{Values: []string{"a", ""}, Nulls: []byte{2}}},
+		{DoubleVal: &hiveserver.TDoubleColumn{Values: []float64{1.5, 0}, Nulls: []byte{}}},
+		{BinaryVal: &hiveserver.TBinaryColumn{Values: [][]byte{[]byte("x"), nil}, Nulls: []byte{}}},
+	}
+	var buffer bytes.Buffer
+	writeRowText(&buffer, columns, 0)
+	writeRowText(&buffer, columns, 1)
+	if buffer.String() != "a\t1.5\tx\n\\N\t0\t\n" {
+		t.Fatalf("Unexpected rows %q", buffer.String())
+	}
+}
+
+// fetchSizeHiveServer returns the setting of hive.server2.thrift.resultset.max.fetch.size, or fails the statement if
+// setting is empty
+type fetchSizeHiveServer struct {
+	operationHiveServer
+	setting string
+}
+
+func (s *fetchSizeHiveServer) ExecuteStatement(ctx context.Context, req *hiveserver.TExecuteStatementReq) (*hiveserver.TExecuteStatementResp, error) {
+	if s.setting == "" {
+		s.statements = append(s.statements, req.Statement)
+		return &hiveserver.TExecuteStatementResp{Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_ERROR_STATUS}}, nil
+	}
+	return s.operationHiveServer.ExecuteStatement(ctx, req)
+}
+
+func (s *fetchSizeHiveServer) GetResultSetMetadata(ctx context.Context, req *hiveserver.TGetResultSetMetadataReq) (*hiveserver.TGetResultSetMetadataResp, error) {
+	return &hiveserver.TGetResultSetMetadataResp{
+		Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		Schema: &hiveserver.TTableSchema{Columns: []*hiveserver.TColumnDesc{{
+			ColumnName: "set",
+			TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{{
+				PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: hiveserver.TTypeId_STRING_TYPE},
+			}}},
+		}}},
+	}, nil
+}
+
+func (s *fetchSizeHiveServer) FetchResults(ctx context.Context, req *hiveserver.TFetchResultsReq) (*hiveserver.TFetchResultsResp, error) {
+	values := []string{}
+	if s.fetched == 0 {
+		values = append(values, s.setting)
+		s.fetched++
+	}
+	return &hiveserver.TFetchResultsResp{
+		Status:  &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		Results: &hiveserver.TRowSet{Columns: []*hiveserver.TColumn{{StringVal: &hiveserver.TStringColumn{Values: values, Nulls: []byte{}}}}},
+	}, nil
+}
+
+func TestDiscoverMaxFetchSize(t *testing.T) {
+	server := &fetchSizeHiveServer{operationHiveServer: operationHiveServer{resultSet: true}, setting: "hive.server2.thrift.resultset.max.fetch.size=500"}
+	host, port := startFakeHiveServer(t, server)
+	configuration := NewConnectConfiguration()
+	configuration.DiscoverMaxFetchSize = true
+	var warnings []string
+	configuration.OnSessionWarning = func(warning string) error {
+		warnings = append(warnings, warning)
+		return nil
+	}
+	connection, err := Connect(host, port, "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	if !reflect.DeepEqual(server.statements, []string{"SET hive.server2.thrift.resultset.max.fetch.size"}) {
+		t.Fatalf("Unexpected statements %v", server.statements)
+	}
+	if connection.MaxFetchSize() != 500 {
+		t.Fatalf("Expected a MaxFetchSize of 500, got %d", connection.MaxFetchSize())
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "FetchSize 1000") {
+		t.Fatalf("Expected a warning about FetchSize, got %v", warnings)
+	}
+	for _, fetchSize := range []int64{FETCH_SIZE_UNLIMITED, 600} {
+		if size := connection.Cursor(WithFetchSize(fetchSize)).getFetchSize(); size != 500 {
+			t.Fatalf("Expected the fetch size %d to be capped at 500, got %d", fetchSize, size)
+		}
+	}
+	if size := connection.Cursor(WithFetchSize(100)).getFetchSize(); size != 100 {
+		t.Fatalf("Expected a fetch size of 100, got %d", size)
+	}
+
+	// Without the setting the fetch size isn't capped
+	for _, setting := range []string{"", "hive.server2.thrift.resultset.max.fetch.size is undefined"} {
+		server.setting = setting
+		warnings = nil
+		connection, err := Connect(host, port, "NOSASL", configuration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if connection.MaxFetchSize() != 0 || len(warnings) != 0 || connection.Cursor().getFetchSize() != 1000 {
+			t.Fatalf("Expected no MaxFetchSize for %q, got %d and the warnings %v", setting, connection.MaxFetchSize(), warnings)
+		}
+		connection.Close()
+	}
+}
+
+func TestSetFetchOrientation(t *testing.T) {
+	server := &operationHiveServer{rows: 3}
+	configuration := NewConnectConfiguration()
+	configuration.PrefetchBatches = 2
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.SetFetchOrientation(hiveserver.TFetchOrientation_FETCH_FIRST)
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if !cursor.HasMore(context.Background()) || cursor.Err != nil {
+		t.Fatalf("Expected rows, got %v", cursor.Err)
+	}
+	if server.orientation != hiveserver.TFetchOrientation_FETCH_FIRST || server.fetches != 1 {
+		t.Fatalf("Expected a single FETCH_FIRST, got %d fetches and %s", server.fetches, server.orientation)
+	}
+}
+
+// scrollHiveServer rejects the fetches with another orientation than FETCH_NEXT with status
+type scrollHiveServer struct {
+	operationHiveServer
+	status *hiveserver.TStatus
+}
+
+func (s *scrollHiveServer) FetchResults(ctx context.Context, req *hiveserver.TFetchResultsReq) (*hiveserver.TFetchResultsResp, error) {
+	if req.Orientation != hiveserver.TFetchOrientation_FETCH_NEXT {
+		return &hiveserver.TFetchResultsResp{Status: s.status}, nil
+	}
+	return s.operationHiveServer.FetchResults(ctx, req)
+}
+
+func TestFetchPriorStatus(t *testing.T) {
+	server := &scrollHiveServer{operationHiveServer: operationHiveServer{rows: 3, resultSet: true}}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+
+	server.status = &hiveserver.TStatus{
+		StatusCode:   hiveserver.TStatusCode_ERROR_STATUS,
+		SqlState:     thrift.StringPtr("HY106"),
+		ErrorMessage: thrift.StringPtr("The fetch type FETCH_PRIOR is not supported for this resultset"),
+	}
+	cursor.FetchPrior(context.Background())
+	if !errors.Is(cursor.Err, ErrScrollNotSupported) {
+		t.Fatalf("Expected ErrScrollNotSupported, got %v", cursor.Err)
+	}
+
+	server.status = &hiveserver.TStatus{
+		StatusCode:   hiveserver.TStatusCode_ERROR_STATUS,
+		ErrorMessage: thrift.StringPtr("Invalid OperationHandle"),
+	}
+	cursor.FetchPrior(context.Background())
+	var hiveErr HiveError
+	if errors.Is(cursor.Err, ErrScrollNotSupported) || !errors.As(cursor.Err, &hiveErr) || hiveErr.Message != "Invalid OperationHandle" {
+		t.Fatalf("Expected the error of the server, got %v", cursor.Err)
+	}
+}
+
+func TestFetchPriorDefaultTimeout(t *testing.T) {
+	server := &scrollHiveServer{operationHiveServer: operationHiveServer{rows: 3, resultSet: true}}
+	server.status = &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_ERROR_STATUS, SqlState: thrift.StringPtr("HY106")}
+	configuration := NewConnectConfiguration()
+	configuration.DefaultTimeout = time.Minute
+	var bounded []bool
+	configuration.RPCHook = func(ctx context.Context, rpc string) (context.Context, func(err error)) {
+		if rpc == "FetchResults" {
+			_, ok := ctx.Deadline()
+			bounded = append(bounded, ok)
+		}
+		return ctx, func(err error) {}
+	}
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	cursor.FetchPrior(context.Background())
+	if !errors.Is(cursor.Err, ErrScrollNotSupported) {
+		t.Fatalf("Expected ErrScrollNotSupported, got %v", cursor.Err)
+	}
+	if !reflect.DeepEqual(bounded, []bool{true}) {
+		t.Fatalf("Expected the fetch to be bounded by DefaultTimeout, got %v", bounded)
+	}
+}
+
+func TestReconnectResumesFetching(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.FetchSize = 2
+	connection := connectFakeHiveServer(t, &operationHiveServer{rows: 5}, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	var values []int32
+	var value int32
+	for len(values) < 2 && cursor.HasMore(context.Background()) {
+		cursor.FetchOne(context.Background(), &value)
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		values = append(values, value)
+	}
+
+	connection.transport.Close()
+	if cursor.HasMore(context.Background()); cursor.Err == nil {
+		t.Fatal("Expected the fetch to fail without a transport")
+	}
+	if err := connection.Reconnect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if cursor.HasMore(context.Background()); !errors.Is(cursor.Err, ErrBatchMayBeLost) {
+		t.Fatalf("Expected the first fetch after reconnecting to fail with ErrBatchMayBeLost, got %v", cursor.Err)
+	}
+	for cursor.HasMore(context.Background()) {
+		cursor.FetchOne(context.Background(), &value)
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		values = append(values, value)
+	}
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if !reflect.DeepEqual(values, []int32{0, 1, 2, 3, 4}) {
+		t.Fatalf("Expected the rows to continue after reconnecting, got %v", values)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	server := &operationHiveServer{rows: 3, resultSet: true}
+	configuration := NewConnectConfiguration()
+	configuration.FetchSize = 2
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "SELECT n FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	for n := int32(0); n < 3; n++ {
+		for i := 0; i < 2; i++ {
+			row, err := cursor.Peek(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row["t.n"] != n {
+				t.Fatalf("Expected to peek %d, got %v", n, row)
+			}
+		}
+		if row := cursor.RowMap(context.Background()); cursor.Err != nil || row["t.n"] != n {
+			t.Fatalf("Expected to read the peeked row %d, got %v (%v)", n, row, cursor.Err)
+		}
+	}
+	if _, err := cursor.Peek(context.Background()); err != io.EOF {
+		t.Fatalf("Expected io.EOF after the last row, got %v", err)
+	}
+	// The two batches and the empty one of the end
+	if server.fetches != 3 {
+		t.Fatalf("Expected each batch to be fetched once, got %d fetches", server.fetches)
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	cursor := memoryCursor(3)
+	dest := make([]interface{}, 2)
+	for expected := 3; expected > 0; expected-- {
+		if buffered := cursor.Buffered(); buffered != expected {
+			t.Fatalf("Expected %d buffered rows, got %d", expected, buffered)
+		}
+		if !cursor.FetchInto(context.Background(), dest) {
+			t.Fatal(cursor.Err)
+		}
+	}
+	if buffered := cursor.Buffered(); buffered != 0 {
+		t.Fatalf("Expected no buffered rows after reading them all, got %d", buffered)
+	}
+}
+
+func TestGetTotalRows(t *testing.T) {
+	columns := map[string]func(rows int) *hiveserver.TColumn{
+		"binary": func(rows int) *hiveserver.TColumn {
+			return &hiveserver.TColumn{BinaryVal: &hiveserver.TBinaryColumn{Values: make([][]byte, rows), Nulls: []byte{}}}
+		},
+		"byte": func(rows int) *hiveserver.TColumn {
+			return &hiveserver.TColumn{ByteVal: &hiveserver.TByteColumn{Values: make([]int8, rows), Nulls: []byte{}}}
+		},
+		"i16": func(rows int) *hiveserver.TColumn {
+			return &hiveserver.TColumn{I16Val: &hiveserver.TI16Column{Values: make([]int16, rows), Nulls: []byte{}}}
+		},
+		"i32": func(rows int) *hiveserver.TColumn {
+			return &hiveserver.TColumn{I32Val: &hiveserver.TI32Column{Values: make([]int32, rows), Nulls: []byte{}}}
+		},
+		"i64": func(rows int) *hiveserver.TColumn {
+			return &hiveserver.TColumn{I64Val: &hiveserver.TI64Column{Values: make([]int64, rows), Nulls: []byte{}}}
+		},
+		"bool": func(rows int) *hiveserver.TColumn {
+			return &hiveserver.TColumn{BoolVal: &hiveserver.TBoolColumn{Values: make([]bool, rows), Nulls: []byte{}}}
+		},
+		"double": func(rows int) *hiveserver.TColumn {
+			return &hiveserver.TColumn{DoubleVal: &hiveserver.TDoubleColumn{Values: make([]float64, rows), Nulls: []byte{}}}
+		},
+		"string": func(rows int) *hiveserver.TColumn {
+			return &hiveserver.TColumn{StringVal: &hiveserver.TStringColumn{Values: make([]string, rows), Nulls: []byte{}}}
+		},
+	}
+	for name, column := range columns {
+		for _, rows := range []int{0, 1, 3} {
+			total, err := getTotalRows([]*hiveserver.TColumn{column(rows)})
+			if err != nil || total != rows {
+				t.Fatalf("Expected %d rows for a %s column, got %d (%v)", rows, name, total, err)
+			}
+			total, err = getTotalRows([]*hiveserver.TColumn{column(rows), column(rows)})
+			if err != nil || total != rows {
+				t.Fatalf("Expected %d rows for two %s columns, got %d (%v)", rows, name, total, err)
+			}
+		}
+	}
+
+	if _, err := getTotalRows([]*hiveserver.TColumn{columns["binary"](0), columns["string"](1)}); err == nil {
+		t.Fatal("Expected an error for columns with different number of rows")
+	}
+	if _, err := getTotalRows([]*hiveserver.TColumn{columns["i32"](1), {}}); err == nil {
+		t.Fatal("Expected an error for a column without values")
+	}
+	if _, err := getTotalRows(nil); err == nil {
+		t.Fatal("Expected an error without columns")
+	}
+}
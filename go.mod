@@ -8,6 +8,7 @@ require (
 	github.com/go-zookeeper/zk v1.0.4
 	github.com/pkg/errors v0.9.1
 	golang.org/x/net v0.41.0
+	golang.org/x/text v0.26.0
 )
 
 require github.com/beltran/gssapi v0.0.0-20200324152954-d86554db4bab // indirect
@@ -3,42 +3,67 @@ package gohive
 import (
 	"context"
 	"crypto/tls"
+	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"hash"
+	"io"
 	"log"
+	"math"
 	"math/rand"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os/user"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
-	"github.com/go-data-exporter/gohive/hiveserver"
 	"github.com/beltran/gosasl"
+	"github.com/go-data-exporter/gohive/hiveserver"
 	"github.com/go-zookeeper/zk"
 	"github.com/pkg/errors"
 	"golang.org/x/net/publicsuffix"
+	"golang.org/x/text/encoding"
 )
 
 const (
 	DEFAULT_FETCH_SIZE          int64 = 1000
 	ZOOKEEPER_DEFAULT_NAMESPACE       = "hiveserver2"
 	DEFAULT_MAX_LENGTH                = 16384000
+	DEFAULT_BUFFER_SIZE               = 4096
+	// FETCH_SIZE_UNLIMITED as FetchSize asks the server for all the rows it can send in a single round trip.
+	// HiveServer2 caps the batches at hive.server2.thrift.resultset.max.fetch.size, 10000 rows by default,
+	// so bigger results still take several round trips.
+	FETCH_SIZE_UNLIMITED int64 = -1
+	// DEFAULT_MAX_EMPTY_POLLS is the MaxEmptyPolls of NewConnectConfiguration, 10 seconds of polls with the default
+	// PollIntervalInMillis
+	DEFAULT_MAX_EMPTY_POLLS = 50
 )
 
 type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
 
+// RPCHook is called before each RPC to HiveServer2 with its name, for example "FetchResults".
+// The returned context is used for the RPC and the returned function, if not nil, is called
+// with the error of the RPC once it finishes. This can be used for creating tracing spans.
+type RPCHook func(ctx context.Context, rpc string) (context.Context, func(err error))
+
 // Connection holds the information for getting a cursor to hive.
+// Its cursors can be used from different goroutines at the same time, each cursor by one goroutine. They share
+// the transport, so their RPCs are sent one after the other: a long fetch delays the polls of the other cursors.
+// With the binary transport and InterruptOnCancel, a fetch whose context is done closes the socket to return early,
+// so the calls of the connection and all its cursors fail with ErrConnectionInterrupted after it.
 type Connection struct {
 	host                string
 	port                int
 	username            string
 	database            string
+	databaseLock        sync.Mutex
 	auth                string
 	kerberosServiceName string
 	password            string
@@ -46,11 +71,32 @@ type Connection struct {
 	client              *hiveserver.TCLIServiceClient
 	configuration       *ConnectConfiguration
 	transport           thrift.TTransport
+	stats               connectionStats
+	cookieJar           http.CookieJar
+	cookieURL           string
+	warnings            []string
+	idle                *idleMonitor
+	metadataCache       *metadataCache
+	resultCache         *resultCache
+	// Whether the server is Impala, nil until it's requested
+	impala     *bool
+	impalaLock sync.Mutex
+	// Maximum number of rows the server sends per batch, zero if unknown
+	maxFetchSize int64
+	// Guards client, transport, cookieJar and cookieURL, replaced by Reconnect while the idle monitor may use them
+	clientLock sync.RWMutex
 }
 
 // ConnectConfiguration is the configuration for the connection
 // The fields have to be filled manually but not all of them are required
 // Depends on the auth and kind of connection.
+// TLSConfig isn't cloned by the library, so sharing it with a ClientSessionCache between
+// connections lets them resume TLS sessions instead of doing a full handshake each time.
+// HiveConfiguration is sent as is in the OpenSession request, where HiveServer2 understands the keys
+// "set:hiveconf:<name>" for configuration properties, "set:hivevar:<name>" for variables referenced
+// as ${hivevar:<name>}, "set:system:<name>" for system properties and "use:database" for the database.
+// Other keys only override the configuration of the session without being validated, so a misspelled
+// prefix is silently ignored. HiveConf and HiveVars add the prefixes themselves.
 type ConnectConfiguration struct {
 	Username             string
 	Principal            string
@@ -69,7 +115,168 @@ type ConnectConfiguration struct {
 	HttpTimeout          time.Duration
 	DialContext          DialContextFunc
 	DisableKeepAlives    bool
-	// Maximum length of the data in bytes. Used for SASL.
+	// HTTPClient is used as the base client for the http transport mode. When set, HttpTimeout,
+	// DialContext, DisableKeepAlives and the TLS settings of TLSConfig are not applied to it,
+	// TLSConfig being non nil only selects https. The client is copied so it isn't modified.
+	HTTPClient *http.Client
+	// CookieJar is used by the http transport instead of a new jar per connection. Sharing it
+	// between connections lets them reuse the session cookie issued by HiveServer2 after authenticating.
+	CookieJar http.CookieJar
+	// RPCHook, if set, is called around every RPC made in the connection
+	RPCHook RPCHook
+	// SASL mechanism used with the CUSTOM auth in the binary transport, PLAIN by default
+	SASLMechanism string
+	// Extra properties passed to the SASL mechanism with the CUSTOM auth
+	SASLProperties map[string]string
+	// NewSASLMechanism, if set, returns the SASL mechanism used with the CUSTOM auth in the binary transport instead
+	// of the one named by SASLMechanism, for mechanisms not supported by the library. It's called with the host for
+	// every connection, the mechanism is disposed when the connection is closed.
+	NewSASLMechanism func(host string) (SASLMechanism, error)
+	// Catalog for the session and the metadata operations, the default catalog of the server if empty
+	Catalog string
+	// DefaultTimeout bounds Execute, HasMore and the fetch methods when they are given a context
+	// without a deadline, for example context.Background(). A deadline set by the caller takes precedence.
+	// With the binary transport it doesn't interrupt a fetch waiting for the server, SocketTimeout bounds the reads.
+	DefaultTimeout time.Duration
+	// If true, with the binary transport a FetchResults or GetResultSetMetadata whose context is done closes the socket
+	// to return at once, as reads on the socket don't observe the context. The response may be half read then, so the
+	// connection and all its cursors fail with ErrConnectionInterrupted after it. The deadlines of DefaultTimeout don't
+	// interrupt the calls.
+	InterruptOnCancel bool
+	// ZookeeperConcurrentConnect makes ConnectZookeeper try all the registered servers at the same time
+	// instead of one after the other
+	ZookeeperConcurrentConnect bool
+	// Number of times Exec and synchronous Execute run again a query canceled by the server, for example
+	// when it's preempted by the resource pool. Network errors are never retried. Zero disables the retries.
+	PreemptionRetries int
+	// Wait before the first retry of a canceled query, the n-th retry waits n times this
+	PreemptionBackoff time.Duration
+	// OnPreemption, if set, is called with the error every time a query canceled by the server is going to be retried
+	OnPreemption func(query string, attempt int, err error)
+	// Number of batches fetched in the background ahead of the one being read, overlapping the
+	// network round trips with the decoding of the rows. Zero fetches every batch when it's needed.
+	// The fetches are bounded by DefaultTimeout. Closing the cursor stops the prefetching, a fetch already
+	// sent is left to finish and the next calls of the connection wait for it.
+	PrefetchBatches int
+	// Maximum number of consecutive batches without columns before giving up waiting for the rows with
+	// ErrTooManyEmptyPolls, guarding against servers that never send them when the context has no deadline. Such
+	// batches are fetched again after PollIntervalInMillis, with or without prefetching. DEFAULT_MAX_EMPTY_POLLS with
+	// NewConnectConfiguration. Zero or a negative value disables the guard: the batches are fetched again until the
+	// context is done.
+	MaxEmptyPolls int
+	// Configuration properties of the session, sent as set:hiveconf:<name>
+	HiveConf map[string]string
+	// Variables of the session, sent as set:hivevar:<name> and available in the queries as ${hivevar:<name>} or ${<name>}
+	HiveVars map[string]string
+	// SHA-256 fingerprints in hex of the certificates accepted from the server, which are trusted without
+	// verifying their chain. Several can be given to rotate the certificate. It enables TLS if TLSConfig is nil.
+	// Not supported with HTTPClient.
+	PinnedCertSHA256 []string
+	// Authorization identity sent with the SASL PLAIN credentials of the NONE, LDAP and CUSTOM auths in the binary
+	// transport, to run as this user after authenticating as Username if the server allows it. Empty acts as Username.
+	AuthorizationID string
+	// Query parameters added to the URL of the http transport, for example to select the backend pool of a gateway.
+	// HTTPPath can also have a query, like "cliservice?workload=analytics".
+	HTTPQueryParameters url.Values
+	// OnSessionWarning, if set, is called with every warning of Connection.Warnings when connecting.
+	// Returning an error closes the session and makes the connection fail with it.
+	OnSessionWarning func(warning string) error
+	// Sizes in bytes of the send and receive buffers of the sockets, set with SetWriteBuffer and SetReadBuffer
+	// after connecting. Zero keeps the ones of the operating system. They apply to the connections dialed by
+	// the library and to the ones returned by DialContext that are TCP sockets, in both transports. The kernel
+	// may cap them, at net.core.wmem_max and net.core.rmem_max on Linux, which also doubles them and stops
+	// tuning them automatically. The TCP window scale is negotiated before, so a receive buffer larger than the
+	// default one may not be fully used on some platforms.
+	SendBufferSize    int
+	ReceiveBufferSize int
+	// Format of the username sent with the LDAP auth in the binary transport, with %s where the configured one goes,
+	// for example "uid=%s,ou=people,dc=example,dc=com". The username is escaped as a value of a distinguished name.
+	LDAPUserPattern string
+	// Domain appended as user@domain to the username sent with the LDAP auth in the binary transport,
+	// unless it already has one. It can't be used with LDAPUserPattern.
+	LDAPDomain string
+	// Size in bytes of the read and write buffers of the binary transport with the NOSASL auth, DEFAULT_BUFFER_SIZE
+	// if zero. A bigger one makes fewer system calls when sending large statements, like a long INSERT ... VALUES.
+	BufferSize int
+	// Run SELECT 1 when connecting, so a session that can't run queries, for example because of the authorization,
+	// makes the connection fail instead of the first query
+	ValidateOnConnect bool
+	// Thrift transport of the binary transport mode with the NOSASL auth, "buffered" by default or "framed" for the
+	// servers with hive.server2.thrift.framed.transport.enabled. BufferSize doesn't apply to the framed one.
+	TransportWrapper string
+	// Encoding of the values of the STRING, VARCHAR and CHAR columns, for example charmap.ISO8859_1 for tables with
+	// Latin-1 data, which are converted to UTF-8 when they are received. Nil returns them as they are sent by the server.
+	// BINARY values are never converted.
+	Charset encoding.Encoding
+	// InvalidUTF8 selects what is done with the values of the string columns that aren't valid UTF-8 after Charset
+	// decoded them, which are kept by default. It applies to every way of reading the rows.
+	InvalidUTF8 InvalidUTF8
+	// Close the session after this long without calls, so a pool can discard the connection, see Expired, before the
+	// server closes the session and the next query fails. The calls made afterwards fail with ErrIdleTimeout.
+	IdleTimeout time.Duration
+	// Send a GetInfo request after this long without calls to keep the session alive in the server, which closes it
+	// after hive.server2.idle.session.timeout. The keep-alives don't count as uses for IdleTimeout.
+	KeepAliveInterval time.Duration
+	// Number of result set descriptions kept by query text, so running the same query again doesn't request its
+	// metadata. With ExecNamed the key is the query before replacing the parameters and their types. The cache is
+	// cleared when the connection runs a statement other than SELECT, WITH, VALUES, SHOW, DESCRIBE or EXPLAIN, and
+	// a description is requested again if the types of the columns received don't match it, but tables altered from
+	// other sessions keep their previous description until then. Zero disables the cache.
+	MetadataCacheSize int
+	// OnExecute, if set, is called with every statement before sending it to the server, also the ones run again after
+	// a preemption. Returning an error rejects the statement, which isn't sent and fails with it.
+	OnExecute func(ctx context.Context, query string) error
+	// OnResult, if set, is called once a statement that OnExecute didn't reject ends, with the summary of the statement,
+	// which has the id of the operation, and with the error if it failed. That's when the statement fails to be
+	// submitted, or when its operation ends while Exec, SubmitAsync or WaitForCompletion wait for it, after which the
+	// summary has RowsAffected and Duration. It isn't called for an async statement whose cursor is closed or runs
+	// another statement before waiting for it.
+	OnResult func(ctx context.Context, query string, result *ExecResult, err error)
+	// If true, RowMap, RowSlice and FetchInto return the values of FLOAT columns as float32 instead of float64, and
+	// Describe gives float32 as their GoType. The server sends them as doubles, widened from the float32 stored, so
+	// the float64 values print with more digits.
+	FloatAsFloat32 bool
+	// If true, RowMap, RowSlice and FetchInto return the values of UNIONTYPE columns as Union instead of the text sent
+	// by the server, like "{0:1}". A value that can't be parsed is an error in Err, and the row isn't consumed.
+	DecodeUnions bool
+	// Maximum number of queries whose rows QueryMaps keeps, for ResultCacheTTL. The cache is used when both are set,
+	// see QueryMaps.
+	ResultCacheSize int
+	ResultCacheTTL  time.Duration
+	// ZookeeperNodeParser reads the address of the servers registered in ZookeeperNamespace by ConnectZookeeper. It's
+	// ParseZookeeperServerURI, for the names of the znodes of HiveServer2, if nil. ParseZookeeperConfigs and
+	// ParseZookeeperJSON read the data of the znodes instead, and other formats can be parsed with a function.
+	ZookeeperNodeParser ZookeeperNodeParser
+	// ImpalaExtensions enables RuntimeProfile and ExecSummary, which call the extensions of the HiveServer2 service
+	// of Impala. They are only called once the server reports itself as Impala.
+	ImpalaExtensions bool
+	// Statements longer than this many bytes fail with ErrStatementTooLong before being sent, InsertRows splits the
+	// rows in statements under it. Zero disables the limit.
+	MaxStatementBytes int
+	// AddressFamily is the network the sockets to the server are dialed with, "tcp4" or "tcp6" to only connect to the
+	// IPv4 or IPv6 addresses of the host, and "tcp" or empty for both, the IPv6 ones being tried first where they are
+	// routable. It's given to DialContext as its network, and applies to both transports except with HTTPClient.
+	AddressFamily string
+	// If true, hive.server2.thrift.resultset.max.fetch.size is read from the session when connecting and the batches
+	// fetched are capped at it, see MaxFetchSize. The server truncates the bigger ones, a warning is added to
+	// Connection.Warnings if FetchSize is above it. It's best effort, the setting is skipped if the server doesn't
+	// return it, and it's a statement of its own, passed to OnExecute.
+	DiscoverMaxFetchSize bool
+	// DecimalFormat selects how RowMap, RowSlice and FetchInto write the values of DECIMAL columns, DecimalTrim by
+	// default
+	DecimalFormat DecimalFormat
+	// TransportUsername is the identity authenticated by the transport, with SASL or the basic auth of the http
+	// transport, and SessionUsername the user the session is opened for, for example a service account of a gateway
+	// and the user it acts for. Empty ones are Username.
+	TransportUsername string
+	SessionUsername   string
+	// Name identifies the connection in the errors of its cursors coming from the server or the transport, and in
+	// the messages they log, for services connected to several servers. The errors of a wrong use of a cursor, like
+	// passing a wrong number of destinations, don't name it. They are left as is when it's empty.
+	Name string
+	// Maximum length of the data in bytes. Used as the maximum size of the SASL frames received, which hold a whole
+	// batch of FetchSize rows, and of the frames of the framed transport. The frames sent with SASL are also limited
+	// by the maximum advertised by the server.
 	MaxSize uint32
 }
 
@@ -87,7 +294,25 @@ func NewConnectConfiguration() *ConnectConfiguration {
 		TLSConfig:            nil,
 		ZookeeperNamespace:   ZOOKEEPER_DEFAULT_NAMESPACE,
 		MaxSize:              DEFAULT_MAX_LENGTH,
+		BufferSize:           DEFAULT_BUFFER_SIZE,
+		MaxEmptyPolls:        DEFAULT_MAX_EMPTY_POLLS,
+	}
+}
+
+// transportUsername returns the identity authenticated by the transport
+func (c *ConnectConfiguration) transportUsername() string {
+	if c.TransportUsername != "" {
+		return c.TransportUsername
+	}
+	return c.Username
+}
+
+// sessionUsername returns the user the session is opened for
+func (c *ConnectConfiguration) sessionUsername() string {
+	if c.SessionUsername != "" {
+		return c.SessionUsername
 	}
+	return c.Username
 }
 
 // HiveError represents an error surfaced from Hive. We attach the specific Error code along with the usual message.
@@ -98,12 +323,84 @@ type HiveError struct {
 	Message string
 	// See https://github.com/apache/hive/blob/master/common/src/java/org/apache/hadoop/hive/ql/ErrorMsg.java for info about error codes
 	ErrorCode int
+	// Name of the connection the error was received on, see ConnectConfiguration.Name
+	Connection string
+}
+
+// Error returns the message of the error, prefixed with the name of the connection if it has one
+func (e HiveError) Error() string {
+	if e.Connection == "" {
+		return e.error.Error()
+	}
+	return "connection " + e.Connection + ": " + e.error.Error()
+}
+
+// ErrorCategory is the kind of a HiveError, given by the range of its code in Hive's ErrorMsg.java
+type ErrorCategory int
+
+const (
+	// The code is outside of the documented ranges, for example errors from the metastore or the server itself
+	ErrorCategoryUnknown ErrorCategory = iota
+	// 10000 to 19999: errors in the semantic analysis and compilation of the query
+	ErrorCategorySemantic
+	// The user isn't allowed to run the query, reported with a HiveAccessControlException
+	ErrorCategoryAuthorization
+	// 20000 to 29999: runtime errors where retries are unlikely to succeed
+	ErrorCategoryRuntime
+	// 30000 to 39999: runtime errors where retries may succeed
+	ErrorCategoryRetryable
+	// 40000 to 49999: errors where Hive can't tell if retries may succeed
+	ErrorCategoryUnadvised
+)
+
+func (e ErrorCategory) String() string {
+	switch e {
+	case ErrorCategorySemantic:
+		return "Semantic"
+	case ErrorCategoryAuthorization:
+		return "Authorization"
+	case ErrorCategoryRuntime:
+		return "Runtime"
+	case ErrorCategoryRetryable:
+		return "Retryable"
+	case ErrorCategoryUnadvised:
+		return "Unadvised"
+	}
+	return "Unknown"
+}
+
+// Category returns the kind of the error. Authorization errors are recognized by their message, as they are sent
+// with the generic code 40000, the rest by the range of their code.
+func (e HiveError) Category() ErrorCategory {
+	if strings.Contains(e.Message, "HiveAccessControlException") {
+		return ErrorCategoryAuthorization
+	}
+	switch {
+	case e.ErrorCode >= 10000 && e.ErrorCode < 20000:
+		return ErrorCategorySemantic
+	case e.ErrorCode >= 20000 && e.ErrorCode < 30000:
+		return ErrorCategoryRuntime
+	case e.ErrorCode >= 30000 && e.ErrorCode < 40000:
+		return ErrorCategoryRetryable
+	case e.ErrorCode >= 40000 && e.ErrorCode < 50000:
+		return ErrorCategoryUnadvised
+	}
+	return ErrorCategoryUnknown
 }
 
 // Connect to zookeper to get hive hosts and then connect to hive.
 // hosts is in format host1:port1,host2:port2,host3:port3 (zookeeper hosts).
 func ConnectZookeeper(hosts string, auth string,
 	configuration *ConnectConfiguration,
+) (conn *Connection, err error) {
+	return ConnectZookeeperContext(context.Background(), hosts, auth, configuration)
+}
+
+// ConnectZookeeperContext is like ConnectZookeeper but stops trying to connect when ctx is done.
+// If ZookeeperConcurrentConnect is set all the registered servers are tried at the same time,
+// the first successful connection is returned and the others are closed.
+func ConnectZookeeperContext(ctx context.Context, hosts string, auth string,
+	configuration *ConnectConfiguration,
 ) (conn *Connection, err error) {
 	// consider host as zookeeper quorum
 	zkHosts := strings.Split(hosts, ",")
@@ -118,21 +415,38 @@ func ConnectZookeeper(hosts string, auth string,
 		return nil, err
 	}
 	if len(hsInfos) > 0 {
-		nodes := parseHiveServer2Info(hsInfos)
+		nodes := zookeeperNodes(hsInfos, func(name string) ([]byte, error) {
+			data, _, err := zkConn.Get("/" + configuration.ZookeeperNamespace + "/" + name)
+			return data, err
+		}, configuration.ZookeeperNodeParser)
+		if len(nodes) == 0 {
+			return nil, errors.Errorf("none of the %d znodes of the Zookeeper namespace %s has the format of ZookeeperNodeParser",
+				len(hsInfos), configuration.ZookeeperNamespace)
+		}
 		rand.Shuffle(len(nodes), func(i, j int) {
 			nodes[i], nodes[j] = nodes[j], nodes[i]
 		})
-		for _, node := range nodes {
-			port, err := strconv.Atoi(node["port"])
-			if err != nil {
-				continue
+		if configuration.ZookeeperConcurrentConnect {
+			conn, err = connectFirst(ctx, nodes, auth, configuration)
+			if conn != nil || ctx.Err() != nil {
+				return conn, err
 			}
-			conn, err := innerConnect(context.TODO(), node["host"], port, auth, configuration)
-			if err != nil {
-				// Let's try to connect to the next one
-				continue
+		} else {
+			for _, node := range nodes {
+				port, err := strconv.Atoi(node["port"])
+				if err != nil {
+					continue
+				}
+				conn, err := connectContext(ctx, node["host"], port, auth, configuration)
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					// Let's try to connect to the next one
+					continue
+				}
+				return conn, nil
 			}
-			return conn, nil
 		}
 		return nil, errors.Errorf("all Hive servers of the specified Zookeeper namespace %s are unavailable",
 			configuration.ZookeeperNamespace)
@@ -142,6 +456,69 @@ func ConnectZookeeper(hosts string, auth string,
 	}
 }
 
+// connectContext connects to the server and stops waiting when ctx is done.
+// A connection opened after that is closed.
+func connectContext(ctx context.Context, host string, port int, auth string,
+	configuration *ConnectConfiguration,
+) (*Connection, error) {
+	type result struct {
+		conn *Connection
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		conn, err := innerConnect(ctx, host, port, auth, configuration)
+		results <- result{conn, err}
+	}()
+	select {
+	case r := <-results:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-results; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// connectFirst connects to all the nodes at the same time and returns the first successful connection
+func connectFirst(ctx context.Context, nodes []map[string]string, auth string,
+	configuration *ConnectConfiguration,
+) (*Connection, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan *Connection, len(nodes))
+	attempts := 0
+	for _, node := range nodes {
+		port, err := strconv.Atoi(node["port"])
+		if err != nil {
+			continue
+		}
+		attempts++
+		// innerConnect fills the missing settings of the configuration, so each attempt gets its own copy
+		attemptConfiguration := *configuration
+		go func(host string) {
+			conn, _ := connectContext(ctx, host, port, auth, &attemptConfiguration)
+			results <- conn
+		}(node["host"])
+	}
+	for i := 0; i < attempts; i++ {
+		if conn := <-results; conn != nil {
+			go func(remaining int) {
+				for ; remaining > 0; remaining-- {
+					if conn := <-results; conn != nil {
+						conn.Close()
+					}
+				}
+			}(attempts - i - 1)
+			return conn, nil
+		}
+	}
+	return nil, ctx.Err()
+}
+
 // Connect to hive server
 func Connect(host string, port int, auth string,
 	configuration *ConnectConfiguration,
@@ -149,6 +526,33 @@ func Connect(host string, port int, auth string,
 	return innerConnect(context.TODO(), host, port, auth, configuration)
 }
 
+// ConnectWithConn opens a session over conn instead of dialing the server, for example a unix socket or one end
+// of a net.Pipe in tests. It's wrapped in TLS like the dialed connections if TLSConfig or PinnedCertSHA256 is set,
+// unless it's already a *tls.Conn. host is only used as the server name of TLS and for the Kerberos principal.
+// Only the binary transport is supported, and Reconnect fails as conn can't be dialed again.
+func ConnectWithConn(ctx context.Context, conn net.Conn, host string, auth string,
+	configuration *ConnectConfiguration,
+) (*Connection, error) {
+	if configuration == nil {
+		configuration = NewConnectConfiguration()
+	}
+	if configuration.TransportMode != "binary" {
+		return nil, errors.Errorf("ConnectWithConn doesn't support the %s transport mode", configuration.TransportMode)
+	}
+	conns := make(chan net.Conn, 1)
+	conns <- conn
+	connConfiguration := *configuration
+	connConfiguration.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		select {
+		case conn := <-conns:
+			return conn, nil
+		default:
+			return nil, errors.New("The connection given to ConnectWithConn can't be dialed again")
+		}
+	}
+	return innerConnect(ctx, host, 0, auth, &connConfiguration)
+}
+
 func parseHiveServer2Info(hsInfos []string) []map[string]string {
 	results := make([]map[string]string, len(hsInfos))
 	actualCount := 0
@@ -193,22 +597,96 @@ func dial(ctx context.Context, addr string, dialFn DialContextFunc, timeout time
 	return dialFn(dctx, "tcp", addr)
 }
 
-func innerConnect(ctx context.Context, host string, port int, auth string,
+// socketDialContext returns the function dialing the sockets to the server, nil to let thrift dial them.
+// The sockets are dialed with the AddressFamily of the configuration and the buffer sizes are set on the TCP
+// sockets it returns.
+func socketDialContext(configuration *ConnectConfiguration) DialContextFunc {
+	dialContext := configuration.DialContext
+	family := configuration.AddressFamily
+	if family == "tcp" {
+		family = ""
+	}
+	if family == "" && configuration.SendBufferSize <= 0 && configuration.ReceiveBufferSize <= 0 {
+		return dialContext
+	}
+	if dialContext == nil {
+		dialContext = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if family != "" && network == "tcp" {
+			network = family
+		}
+		conn, err := dialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err = setSocketBuffers(conn, configuration.SendBufferSize, configuration.ReceiveBufferSize); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// setSocketBuffers sets the sizes greater than zero on conn if it's a socket, like *net.TCPConn
+func setSocketBuffers(conn net.Conn, sendBufferSize int, receiveBufferSize int) error {
+	socket, ok := conn.(interface {
+		SetWriteBuffer(bytes int) error
+		SetReadBuffer(bytes int) error
+	})
+	if !ok {
+		return nil
+	}
+	if sendBufferSize > 0 {
+		if err := socket.SetWriteBuffer(sendBufferSize); err != nil {
+			return errors.Wrap(err, "Can't set the send buffer size")
+		}
+	}
+	if receiveBufferSize > 0 {
+		if err := socket.SetReadBuffer(receiveBufferSize); err != nil {
+			return errors.Wrap(err, "Can't set the receive buffer size")
+		}
+	}
+	return nil
+}
+
+// openClient opens a transport to the server and returns a client using it, without opening a session.
+// The defaults of Username and Password are set in the configuration.
+func openClient(ctx context.Context, host string, port int, auth string,
 	configuration *ConnectConfiguration,
-) (conn *Connection, err error) {
+) (client *hiveserver.TCLIServiceClient, transport thrift.TTransport, cookieJar http.CookieJar, cookieURL string, err error) {
 	var socket thrift.TTransport
 	addr := fmt.Sprintf("%s:%d", host, port)
-	if configuration.DialContext != nil {
+	switch configuration.AddressFamily {
+	case "", "tcp", "tcp4", "tcp6":
+	default:
+		err = errors.Errorf("Unknown AddressFamily %q, it must be tcp4, tcp6 or tcp", configuration.AddressFamily)
+		return
+	}
+	tlsConfig, err := connectionTLSConfig(configuration)
+	if err != nil {
+		return
+	}
+	if dialContext := socketDialContext(configuration); dialContext != nil {
 		var netConn net.Conn
-		netConn, err = dial(ctx, addr, configuration.DialContext, configuration.ConnectTimeout)
+		netConn, err = dial(ctx, addr, dialContext, configuration.ConnectTimeout)
 		if err != nil {
 			return
 		}
-		if configuration.TLSConfig != nil {
+		if tlsConfig != nil {
+			// TSSLSocket only does the handshake when it dials the connection itself
+			if _, ok := netConn.(*tls.Conn); !ok {
+				clientConfig := tlsConfig
+				if clientConfig.ServerName == "" {
+					clientConfig = tlsConfig.Clone()
+					clientConfig.ServerName = host
+				}
+				netConn = tls.Client(netConn, clientConfig)
+			}
 			socket = thrift.NewTSSLSocketFromConnConf(netConn, &thrift.TConfiguration{
 				ConnectTimeout: configuration.ConnectTimeout,
 				SocketTimeout:  configuration.SocketTimeout,
-				TLSConfig:      configuration.TLSConfig,
+				TLSConfig:      tlsConfig,
 			})
 		} else {
 			socket = thrift.NewTSocketFromConnConf(netConn, &thrift.TConfiguration{
@@ -217,11 +695,11 @@ func innerConnect(ctx context.Context, host string, port int, auth string,
 			})
 		}
 	} else {
-		if configuration.TLSConfig != nil {
+		if tlsConfig != nil {
 			socket = thrift.NewTSSLSocketConf(addr, &thrift.TConfiguration{
 				ConnectTimeout: configuration.ConnectTimeout,
 				SocketTimeout:  configuration.SocketTimeout,
-				TLSConfig:      configuration.TLSConfig,
+				TLSConfig:      tlsConfig,
 			})
 		} else {
 			socket = thrift.NewTSocketConf(addr, &thrift.TConfiguration{
@@ -234,15 +712,11 @@ func innerConnect(ctx context.Context, host string, port int, auth string,
 		}
 	}
 
-	var transport thrift.TTransport
-
-	if configuration == nil {
-		configuration = NewConnectConfiguration()
-	}
 	if configuration.Username == "" {
-		_user, err := user.Current()
-		if err != nil {
-			return nil, errors.New("Can't determine the username")
+		_user, userErr := user.Current()
+		if userErr != nil {
+			err = errors.New("Can't determine the username")
+			return
 		}
 		configuration.Username = strings.Replace(_user.Name, " ", "", -1)
 	}
@@ -253,67 +727,109 @@ func innerConnect(ctx context.Context, host string, port int, auth string,
 
 	if configuration.TransportMode == "http" {
 		if auth == "NONE" {
-			httpClient, protocol, err := getHTTPClient(configuration)
-			if err != nil {
-				return nil, err
-			}
-
-			httpClient.Jar, err = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+			var httpClient *http.Client
+			var protocol string
+			httpClient, protocol, err = getHTTPClient(configuration)
 			if err != nil {
-				return nil, err
+				return
 			}
+			cookieJar = httpClient.Jar
+			cookieURL = httpEndpoint(protocol, host, port, configuration, nil)
 
 			httpOptions := thrift.THttpClientOptions{Client: httpClient}
-			transport, err = thrift.NewTHttpClientTransportFactoryWithOptions(fmt.Sprintf(protocol+"://%s:%s@%s:%d/"+configuration.HTTPPath, url.QueryEscape(configuration.Username), url.QueryEscape(configuration.Password), host, port), httpOptions).GetTransport(socket)
+			transport, err = thrift.NewTHttpClientTransportFactoryWithOptions(httpEndpoint(protocol, host, port, configuration, url.UserPassword(configuration.transportUsername(), configuration.Password)), httpOptions).GetTransport(socket)
 			if err != nil {
-				return nil, err
+				return
 			}
 		} else if auth == "KERBEROS" {
-			mechanism, err := gosasl.NewGSSAPIMechanism(configuration.Service)
+			var mechanism *gosasl.GSSAPIMechanism
+			mechanism, err = gosasl.NewGSSAPIMechanism(configuration.Service)
 			if err != nil {
-				return nil, err
+				return
 			}
 			saslClient := gosasl.NewSaslClient(host, mechanism)
-			token, err := saslClient.Start()
+			var token []byte
+			token, err = saslClient.Start()
 			if err != nil {
-				return nil, err
+				return
 			}
 			if len(token) == 0 {
-				return nil, errors.New("Gssapi init context returned an empty token. Probably the service is empty in the configuration")
+				err = errors.New("Gssapi init context returned an empty token. Probably the service is empty in the configuration")
+				return
 			}
 
-			httpClient, protocol, err := getHTTPClient(configuration)
-			if err != nil {
-				return nil, err
-			}
-			httpClient.Jar, err = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+			var httpClient *http.Client
+			var protocol string
+			httpClient, protocol, err = getHTTPClient(configuration)
 			if err != nil {
-				return nil, err
+				return
 			}
+			cookieJar = httpClient.Jar
+			cookieURL = httpEndpoint(protocol, host, port, configuration, nil)
 
 			httpOptions := thrift.THttpClientOptions{
 				Client: httpClient,
 			}
-			transport, err = thrift.NewTHttpClientTransportFactoryWithOptions(fmt.Sprintf(protocol+"://%s:%d/"+configuration.HTTPPath, host, port), httpOptions).GetTransport(socket)
+			transport, err = thrift.NewTHttpClientTransportFactoryWithOptions(httpEndpoint(protocol, host, port, configuration, nil), httpOptions).GetTransport(socket)
 			httpTransport, ok := transport.(*thrift.THttpClient)
 			if ok {
 				httpTransport.SetHeader("Authorization", "Negotiate "+base64.StdEncoding.EncodeToString(token))
 			}
 			if err != nil {
-				return nil, err
+				return
 			}
 		} else {
 			panic("Unrecognized auth")
 		}
 	} else if configuration.TransportMode == "binary" {
 		if auth == "NOSASL" {
-			transport = thrift.NewTBufferedTransport(socket, 4096)
-			if transport == nil {
-				return nil, errors.New("BufferedTransport was nil")
+			switch configuration.TransportWrapper {
+			case "", "buffered":
+				bufferSize := configuration.BufferSize
+				if bufferSize <= 0 {
+					bufferSize = DEFAULT_BUFFER_SIZE
+				}
+				transport = thrift.NewTBufferedTransport(socket, bufferSize)
+				if transport == nil {
+					err = errors.New("BufferedTransport was nil")
+					return
+				}
+			case "framed":
+				transport = thrift.NewTFramedTransportConf(socket, &thrift.TConfiguration{MaxFrameSize: int32(configuration.MaxSize)})
+			default:
+				socket.Close()
+				err = errors.Errorf("Unrecognized transport wrapper %q, it must be buffered or framed", configuration.TransportWrapper)
+				return
+			}
+		} else if auth == "CUSTOM" && configuration.NewSASLMechanism != nil {
+			var mechanism SASLMechanism
+			if mechanism, err = configuration.NewSASLMechanism(host); err != nil {
+				socket.Close()
+				return
 			}
+			transport = NewTSaslTransportMechanism(socket, mechanism, configuration.MaxSize)
 		} else if auth == "NONE" || auth == "LDAP" || auth == "CUSTOM" {
-			saslConfiguration := map[string]string{"username": configuration.Username, "password": configuration.Password}
-			transport, err = NewTSaslTransport(socket, host, "PLAIN", saslConfiguration, configuration.MaxSize)
+			mechanism := "PLAIN"
+			username := configuration.transportUsername()
+			if auth == "LDAP" {
+				if username, err = ldapBindUser(configuration); err != nil {
+					socket.Close()
+					return
+				}
+			}
+			saslConfiguration := map[string]string{"username": username, "password": configuration.Password}
+			if configuration.AuthorizationID != "" {
+				saslConfiguration["authzid"] = configuration.AuthorizationID
+			}
+			if auth == "CUSTOM" {
+				if configuration.SASLMechanism != "" {
+					mechanism = configuration.SASLMechanism
+				}
+				for key, value := range configuration.SASLProperties {
+					saslConfiguration[key] = value
+				}
+			}
+			transport, err = NewTSaslTransport(socket, host, mechanism, saslConfiguration, configuration.MaxSize)
 			if err != nil {
 				return
 			}
@@ -324,7 +840,7 @@ func innerConnect(ctx context.Context, host string, port int, auth string,
 				return
 			}
 		} else if auth == "DIGEST-MD5" {
-			saslConfiguration := map[string]string{"username": configuration.Username, "password": configuration.Password, "service": configuration.Service}
+			saslConfiguration := map[string]string{"username": configuration.transportUsername(), "password": configuration.Password, "service": configuration.Service}
 			transport, err = NewTSaslTransport(socket, host, "DIGEST-MD5", saslConfiguration, configuration.MaxSize)
 			if err != nil {
 				return
@@ -342,18 +858,48 @@ func innerConnect(ctx context.Context, host string, port int, auth string,
 	}
 
 	protocolFactory := thrift.NewTBinaryProtocolFactoryDefault()
-	client := hiveserver.NewTCLIServiceClientFactory(transport, protocolFactory)
+	var tClient thrift.TClient = thrift.NewTStandardClient(protocolFactory.GetProtocol(transport), protocolFactory.GetProtocol(transport))
+	if configuration.RPCHook != nil {
+		tClient = thrift.WrapClient(tClient, rpcHookMiddleware(configuration.RPCHook))
+	}
+	if interrupter, ok := socket.(interface{ Interrupt() error }); ok && configuration.TransportMode == "binary" && configuration.InterruptOnCancel {
+		tClient = thrift.WrapClient(tClient, interruptMiddleware(interrupter))
+	}
+	if timeoutSetter, ok := socket.(interface{ SetSocketTimeout(time.Duration) error }); ok && configuration.TransportMode == "binary" {
+		tClient = thrift.WrapClient(tClient, socketTimeoutMiddleware(timeoutSetter, configuration.SocketTimeout))
+	}
+	// Cursors fetching in the background share the client with the rest of the connection
+	tClient = thrift.WrapClient(tClient, serializeMiddleware())
+	client = hiveserver.NewTCLIServiceClient(tClient)
+	return
+}
+
+func innerConnect(ctx context.Context, host string, port int, auth string,
+	configuration *ConnectConfiguration,
+) (conn *Connection, err error) {
+	if configuration == nil {
+		configuration = NewConnectConfiguration()
+	}
+	client, transport, cookieJar, cookieURL, err := openClient(ctx, host, port, auth, configuration)
+	if err != nil {
+		return
+	}
 
 	openSession := hiveserver.NewTOpenSessionReq()
 	openSession.ClientProtocol = hiveserver.TProtocolVersion_HIVE_CLI_SERVICE_PROTOCOL_V6
-	openSession.Configuration = configuration.HiveConfiguration
-	openSession.Username = &configuration.Username
+	openSession.Configuration = sessionConfiguration(configuration)
+	sessionUsername := configuration.sessionUsername()
+	openSession.Username = &sessionUsername
 	openSession.Password = &configuration.Password
 	// Context is ignored
-	response, err := client.OpenSession(context.Background(), openSession)
+	response, err := client.OpenSession(ctx, openSession)
 	if err != nil {
 		return
 	}
+	if !success(safeStatus(response.GetStatus())) {
+		transport.Close()
+		return nil, errors.New("Error opening the session: " + safeStatus(response.GetStatus()).String())
+	}
 
 	database := configuration.Database
 	if database == "" {
@@ -369,6 +915,26 @@ func innerConnect(ctx context.Context, host string, port int, auth string,
 		client:              client,
 		configuration:       configuration,
 		transport:           transport,
+		cookieJar:           cookieJar,
+		cookieURL:           cookieURL,
+		warnings:            sessionWarnings(openSession.ClientProtocol, response),
+	}
+	if configuration.MetadataCacheSize > 0 {
+		connection.metadataCache = newMetadataCache(configuration.MetadataCacheSize)
+	}
+	if configuration.ResultCacheSize > 0 && configuration.ResultCacheTTL > 0 {
+		connection.resultCache = newResultCache(configuration.ResultCacheSize, configuration.ResultCacheTTL)
+	}
+	if configuration.DiscoverMaxFetchSize {
+		connection.discoverMaxFetchSize(ctx)
+	}
+	if configuration.OnSessionWarning != nil {
+		for _, warning := range connection.warnings {
+			if err = configuration.OnSessionWarning(warning); err != nil {
+				connection.Close()
+				return nil, err
+			}
+		}
 	}
 
 	if configuration.Database != "" {
@@ -380,9 +946,172 @@ func innerConnect(ctx context.Context, host string, port int, auth string,
 		}
 	}
 
+	if configuration.ValidateOnConnect {
+		cursor := connection.Cursor()
+		cursor.Exec(ctx, "SELECT 1")
+		err = cursor.Err
+		cursor.Close()
+		if err != nil {
+			connection.Close()
+			return nil, errors.Wrap(err, "The session can't run queries")
+		}
+	}
+
+	connection.startIdleMonitor()
 	return connection, nil
 }
 
+// sessionConfiguration returns the configuration of the OpenSession request, HiveConfiguration with the
+// prefixed entries of HiveConf, HiveVars and Catalog, which take precedence
+func sessionConfiguration(configuration *ConnectConfiguration) map[string]string {
+	if len(configuration.HiveConf) == 0 && len(configuration.HiveVars) == 0 && configuration.Catalog == "" {
+		return configuration.HiveConfiguration
+	}
+	sessionConf := make(map[string]string, len(configuration.HiveConfiguration)+len(configuration.HiveConf)+len(configuration.HiveVars)+1)
+	for key, value := range configuration.HiveConfiguration {
+		sessionConf[key] = value
+	}
+	for key, value := range configuration.HiveConf {
+		sessionConf["set:hiveconf:"+key] = value
+	}
+	for key, value := range configuration.HiveVars {
+		sessionConf["set:hivevar:"+key] = value
+	}
+	if configuration.Catalog != "" {
+		sessionConf["set:hiveconf:metastore.catalog.default"] = configuration.Catalog
+	}
+	return sessionConf
+}
+
+func rpcHookMiddleware(hook RPCHook) thrift.ClientMiddleware {
+	return func(next thrift.TClient) thrift.TClient {
+		return thrift.WrappedTClient{
+			Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+				ctx, end := hook(ctx, method)
+				meta, err := next.Call(ctx, method, args, result)
+				if end != nil {
+					end(err)
+				}
+				return meta, err
+			},
+		}
+	}
+}
+
+// ErrConnectionInterrupted is the cause of the errors of the calls of a connection whose socket was closed because
+// the context of a fetch was done, with InterruptOnCancel. The socket is shared by the connection and its cursors, so
+// they all fail after it and the connection has to be discarded, or replaced with Reconnect if the server keeps the
+// session.
+var ErrConnectionInterrupted = errors.New("gohive: the connection was interrupted by a canceled call")
+
+// interruptMiddleware closes the socket when the context of an in-flight FetchResults or GetResultSetMetadata is done,
+// for InterruptOnCancel. Reads on a raw socket don't observe the context, so otherwise the call would block until the
+// server responds. The response may be half read then, so the calls after it fail with ErrConnectionInterrupted. The
+// fetches of a stopped prefetcher and the ones reaching DefaultTimeout are left to finish instead.
+func interruptMiddleware(socket interface{ Interrupt() error }) thrift.ClientMiddleware {
+	var interrupted atomic.Bool
+	return func(next thrift.TClient) thrift.TClient {
+		return thrift.WrappedTClient{
+			Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+				if interrupted.Load() {
+					return thrift.ResponseMeta{}, ErrConnectionInterrupted
+				}
+				if (method != "FetchResults" && method != "GetResultSetMetadata") || ctx.Done() == nil {
+					return next.Call(ctx, method, args, result)
+				}
+				var lock sync.Mutex
+				finished := false
+				stop := context.AfterFunc(ctx, func() {
+					lock.Lock()
+					defer lock.Unlock()
+					// The call may have returned meanwhile, the socket is only closed while it's in flight
+					if finished || context.Cause(ctx) == errPrefetchStopped || context.Cause(ctx) == errDefaultTimeout {
+						return
+					}
+					interrupted.Store(true)
+					socket.Interrupt()
+				})
+				meta, err := next.Call(ctx, method, args, result)
+				lock.Lock()
+				finished = true
+				lock.Unlock()
+				stop()
+				if err != nil && interrupted.Load() {
+					err = errors.Wrapf(ErrConnectionInterrupted, "%s was canceled", method)
+				}
+				return meta, err
+			},
+		}
+	}
+}
+
+type socketTimeoutKey struct{}
+
+// WithSocketTimeout returns a context that makes the RPCs done with it use timeout for the socket reads
+// and writes instead of ConnectConfiguration.SocketTimeout, for example a short one for metadata calls
+// and a long one for big fetches. It applies to the binary transport, in the http transport the
+// deadline of the context already bounds every request.
+func WithSocketTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, socketTimeoutKey{}, timeout)
+}
+
+type queryTagKey struct{}
+
+// WithQueryTag returns a context that makes the statements executed with it carry tag as hive.query.tag, sent with
+// the statement instead of as a SET of the session so it also applies to async queries. The workload management of
+// Hive can map the tag to a resource pool, and the tag identifies the query in its UI and with KILL QUERY.
+func WithQueryTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, queryTagKey{}, tag)
+}
+
+// socketTimeoutMiddleware sets the socket timeout of the context for the duration of the call
+func socketTimeoutMiddleware(socket interface{ SetSocketTimeout(time.Duration) error }, defaultTimeout time.Duration) thrift.ClientMiddleware {
+	return func(next thrift.TClient) thrift.TClient {
+		return thrift.WrappedTClient{
+			Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+				if timeout, ok := ctx.Value(socketTimeoutKey{}).(time.Duration); ok {
+					socket.SetSocketTimeout(timeout)
+					defer socket.SetSocketTimeout(defaultTimeout)
+				}
+				return next.Call(ctx, method, args, result)
+			},
+		}
+	}
+}
+
+// rpcClient returns a client for the RPCs of one caller over the transport of the connection. The generated client
+// records the metadata of the last response, so sharing it between concurrent cursors would be a data race.
+// The calls are serialized by the client of the transport, see serializeMiddleware.
+func (c *Connection) rpcClient() *hiveserver.TCLIServiceClient {
+	c.clientLock.RLock()
+	client := c.client.Client_()
+	c.clientLock.RUnlock()
+	if c.idle != nil {
+		return hiveserver.NewTCLIServiceClient(thrift.WrapClient(client, c.idle.middleware()))
+	}
+	return hiveserver.NewTCLIServiceClient(client)
+}
+
+// serializeMiddleware makes the calls wait for the one in progress, as the protocol doesn't support concurrent calls
+func serializeMiddleware() thrift.ClientMiddleware {
+	inUse := make(chan struct{}, 1)
+	return func(next thrift.TClient) thrift.TClient {
+		return thrift.WrappedTClient{
+			Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+				select {
+				case inUse <- struct{}{}:
+				case <-ctx.Done():
+					return thrift.ResponseMeta{}, ctx.Err()
+				}
+				defer func() {
+					<-inUse
+				}()
+				return next.Call(ctx, method, args, result)
+			},
+		}
+	}
+}
+
 type CookieDedupTransport struct {
 	http.RoundTripper
 }
@@ -406,13 +1135,50 @@ func (d *CookieDedupTransport) RoundTrip(req *http.Request) (*http.Response, err
 	return resp, err
 }
 
+// httpEndpoint returns the URL of HiveServer2 for the http transport. HTTPPath can have a query, which is kept
+// and followed by HTTPQueryParameters.
+func httpEndpoint(protocol string, host string, port int, configuration *ConnectConfiguration, user *url.Userinfo) string {
+	path, query, _ := strings.Cut(configuration.HTTPPath, "?")
+	if len(configuration.HTTPQueryParameters) > 0 {
+		if query != "" {
+			query += "&"
+		}
+		query += configuration.HTTPQueryParameters.Encode()
+	}
+	endpoint := url.URL{
+		Scheme:   protocol,
+		User:     user,
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/" + strings.TrimPrefix(path, "/"),
+		RawQuery: query,
+	}
+	return endpoint.String()
+}
+
 func getHTTPClient(configuration *ConnectConfiguration) (httpClient *http.Client, protocol string, err error) {
-	if configuration.TLSConfig != nil {
+	tlsConfig, err := connectionTLSConfig(configuration)
+	if err != nil {
+		return
+	}
+	if configuration.HTTPClient != nil {
+		if len(configuration.PinnedCertSHA256) > 0 {
+			return nil, "", errors.New("PinnedCertSHA256 can't be enforced on a custom HTTPClient")
+		}
+		client := *configuration.HTTPClient
+		httpClient = &client
+		if httpClient.Transport == nil {
+			httpClient.Transport = http.DefaultTransport
+		}
+		protocol = "http"
+		if configuration.TLSConfig != nil {
+			protocol = "https"
+		}
+	} else if tlsConfig != nil {
 		httpClient = &http.Client{
 			Timeout: configuration.HttpTimeout,
 			Transport: &http.Transport{
-				TLSClientConfig:   configuration.TLSConfig,
-				DialContext:       configuration.DialContext,
+				TLSClientConfig:   tlsConfig,
+				DialContext:       socketDialContext(configuration),
 				DisableKeepAlives: configuration.DisableKeepAlives,
 			},
 		}
@@ -421,7 +1187,7 @@ func getHTTPClient(configuration *ConnectConfiguration) (httpClient *http.Client
 		httpClient = &http.Client{
 			Timeout: configuration.HttpTimeout,
 			Transport: &http.Transport{
-				DialContext:       configuration.DialContext,
+				DialContext:       socketDialContext(configuration),
 				DisableKeepAlives: configuration.DisableKeepAlives,
 			},
 		}
@@ -430,49 +1196,276 @@ func getHTTPClient(configuration *ConnectConfiguration) (httpClient *http.Client
 
 	httpClient.Transport = &CookieDedupTransport{httpClient.Transport}
 
+	if configuration.CookieJar != nil {
+		httpClient.Jar = configuration.CookieJar
+	} else if httpClient.Jar == nil {
+		httpClient.Jar, err = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	}
 	return
 }
 
-// Cursor creates a cursor from a connection
-func (c *Connection) Cursor() *Cursor {
-	return &Cursor{
-		conn:  c,
-		queue: make([]*hiveserver.TColumn, 0),
+// SessionCookies returns the cookies stored for the HiveServer2 endpoint when using the http transport.
+// They can be added to the CookieJar of another connection configuration to reuse the session.
+func (c *Connection) SessionCookies() []*http.Cookie {
+	c.clientLock.RLock()
+	defer c.clientLock.RUnlock()
+	if c.cookieJar == nil {
+		return nil
+	}
+	u, err := url.Parse(c.cookieURL)
+	if err != nil {
+		return nil
 	}
+	return c.cookieJar.Cookies(u)
 }
 
-// Close closes a session
-func (c *Connection) Close() error {
-	closeRequest := hiveserver.NewTCloseSessionReq()
-	closeRequest.SessionHandle = c.sessionHandle
-	// This context is ignored
-	responseClose, err := c.client.CloseSession(context.Background(), closeRequest)
+// Clone opens a new session, over a new transport, to the server of the connection with the same auth and configuration.
+// The returned connection is independent and has to be closed on its own. The database of the session is
+// the Database of the configuration, not the one selected in this connection with a USE statement.
+func (c *Connection) Clone(ctx context.Context) (*Connection, error) {
+	// Connecting sets the defaults in the configuration, so it's copied as with the concurrent connections
+	configuration := *c.configuration
+	return connectContext(ctx, c.host, c.port, c.auth, &configuration)
+}
 
+// ErrSessionLost is the cause of the error of Reconnect when the server doesn't know the session anymore
+var ErrSessionLost = errors.New("gohive: the session doesn't exist in the server")
+
+// ErrBatchMayBeLost is the cause of the error of the first fetch of a cursor after one that failed in the transport.
+// The server may have sent the rows of the failed fetch before the transport failed, and then they are skipped.
+var ErrBatchMayBeLost = errors.New("gohive: the rows of the fetch that failed may have been skipped")
+
+// Reconnect replaces the transport of the connection with a new one to the same server, keeping the session and
+// its operations. A cursor whose fetch failed because of the transport continues fetching from the position kept by
+// the server, which has moved past the failed batch if the server had already sent it. As that can't be known, the
+// next HasMore or Fetch call of the cursor returns an error wrapping ErrBatchMayBeLost, and the calls after it continue
+// with the next rows. This only works if the server keeps the session after losing the
+// connection: it does with the http transport, but with the binary one HiveServer2 closes the sessions of a lost
+// connection unless hive.server2.close.session.on.disconnect is false. Otherwise the error wraps ErrSessionLost.
+// It must not be called concurrently with other calls of the connection or its cursors, the keep-alives and the
+// closing after IdleTimeout wait for it.
+func (c *Connection) Reconnect(ctx context.Context) error {
+	c.clientLock.Lock()
+	if c.Expired() {
+		// The session was closed after IdleTimeout, Close wouldn't close the new transport
+		c.clientLock.Unlock()
+		return ErrIdleTimeout
+	}
 	if c.transport != nil {
-		errTransport := c.transport.Close()
-		if errTransport != nil {
-			return errTransport
-		}
+		c.transport.Close()
 	}
+	client, transport, cookieJar, cookieURL, err := openClient(ctx, c.host, c.port, c.auth, c.configuration)
 	if err != nil {
+		c.clientLock.Unlock()
 		return err
 	}
-	if !success(safeStatus(responseClose.GetStatus())) {
-		return errors.New("Error closing the session: " + safeStatus(responseClose.GetStatus()).String())
+	c.client = client
+	c.transport = transport
+	c.cookieJar = cookieJar
+	c.cookieURL = cookieURL
+	c.clientLock.Unlock()
+
+	infoRequest := hiveserver.NewTGetInfoReq()
+	infoRequest.SessionHandle = c.sessionHandle
+	infoRequest.InfoType = hiveserver.TGetInfoType_CLI_SERVER_NAME
+	response, err := client.GetInfo(ctx, infoRequest)
+	if err != nil {
+		return err
+	}
+	if !success(safeStatus(response.GetStatus())) {
+		return errors.Wrap(ErrSessionLost, safeStatus(response.GetStatus()).GetErrorMessage())
 	}
 	return nil
 }
 
-const (
-	_RUNNING      = 0
-	_FINISHED     = 1
-	_NONE         = 2
-	_CONTEXT_DONE = 3
-	_ERROR        = 4
-	_ASYNC_ENDED  = 5
-)
+// Warnings returns the messages sent by the server with a SUCCESS_WITH_INFO status when opening the session,
+// and a message if the protocol version of the session is lower than the one requested by the client
+func (c *Connection) Warnings() []string {
+	return append([]string(nil), c.warnings...)
+}
 
-// Cursor is used for fetching the rows after a query
+// maxFetchSizeProperty is the setting of HiveServer2 capping the rows of each batch
+const maxFetchSizeProperty = "hive.server2.thrift.resultset.max.fetch.size"
+
+// MaxFetchSize returns the maximum number of rows the server sends per batch, read when connecting with
+// DiscoverMaxFetchSize. It returns 0 if it's unknown.
+func (c *Connection) MaxFetchSize() int64 {
+	return c.maxFetchSize
+}
+
+// Name returns the name of the connection given by ConnectConfiguration.Name
+func (c *Connection) Name() string {
+	return c.configuration.Name
+}
+
+// nameError prefixes the message of err with the name of the connection, if it has one. HiveErrors naming the
+// connection are left as is.
+func (c *Connection) nameError(err error) error {
+	var hiveErr HiveError
+	if err == nil || c.configuration.Name == "" || (errors.As(err, &hiveErr) && hiveErr.Connection != "") {
+		return err
+	}
+	return errors.WithMessage(err, "connection "+c.configuration.Name)
+}
+
+// discoverMaxFetchSize reads the maxFetchSizeProperty of the session, leaving maxFetchSize unknown if the server
+// doesn't return it, and warns if FetchSize is above it
+func (c *Connection) discoverMaxFetchSize(ctx context.Context) {
+	cursor := c.Cursor()
+	defer cursor.Close()
+	cursor.Exec(ctx, "SET "+maxFetchSizeProperty)
+	if cursor.Err != nil {
+		return
+	}
+	row := cursor.RowSlice(ctx)
+	if cursor.Err != nil {
+		return
+	}
+	// HiveServer2 returns a row "property=value", the Spark Thrift server the property and the value in two columns
+	var value string
+	switch len(row) {
+	case 1:
+		setting, _ := row[0].(string)
+		value, _ = strings.CutPrefix(setting, maxFetchSizeProperty+"=")
+	case 2:
+		value, _ = row[1].(string)
+	}
+	maxFetchSize, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || maxFetchSize <= 0 {
+		return
+	}
+	c.maxFetchSize = maxFetchSize
+	if c.configuration.FetchSize > maxFetchSize {
+		c.warnings = append(c.warnings, fmt.Sprintf("FetchSize %d is above %s, the batches have up to %d rows",
+			c.configuration.FetchSize, maxFetchSizeProperty, maxFetchSize))
+	}
+}
+
+// sessionWarnings returns the warnings of the response to an OpenSession request for the client protocol
+func sessionWarnings(clientProtocol hiveserver.TProtocolVersion, response *hiveserver.TOpenSessionResp) []string {
+	var warnings []string
+	if status := safeStatus(response.GetStatus()); status.GetStatusCode() == hiveserver.TStatusCode_SUCCESS_WITH_INFO_STATUS {
+		warnings = append(warnings, status.InfoMessages...)
+		if status.ErrorMessage != nil {
+			warnings = append(warnings, status.GetErrorMessage())
+		}
+	}
+	if response.ServerProtocolVersion < clientProtocol {
+		warnings = append(warnings, fmt.Sprintf("The server negotiated the protocol %s instead of %s", response.ServerProtocolVersion, clientProtocol))
+	}
+	return warnings
+}
+
+// errDefaultTimeout is the cause of the contexts done because of DefaultTimeout, which don't interrupt the calls
+var errDefaultTimeout = errors.New("gohive: DefaultTimeout passed")
+
+// withDefaultTimeout derives a context bounded by DefaultTimeout if ctx doesn't have a deadline
+func (c *Connection) withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.configuration == nil || c.configuration.DefaultTimeout <= 0 {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, c.configuration.DefaultTimeout, errDefaultTimeout)
+}
+
+// CursorOption overrides a setting of the connection configuration for a single cursor
+type CursorOption func(*Cursor)
+
+// WithFetchSize sets the number of rows the cursor fetches per round trip, FETCH_SIZE_UNLIMITED for as many as possible
+func WithFetchSize(fetchSize int64) CursorOption {
+	return func(c *Cursor) {
+		c.fetchSize = fetchSize
+	}
+}
+
+// WithPollInterval sets the time the cursor waits between polls of the operation status
+func WithPollInterval(interval time.Duration) CursorOption {
+	return func(c *Cursor) {
+		c.pollInterval = interval
+	}
+}
+
+// WithRowHash makes the cursor write every row it reads to h, in the text format of Hive: the values separated by tabs,
+// NULL as \N and the row ended by a new line. Comparing the sum with the one of another export verifies the data.
+// h isn't reset between queries.
+func WithRowHash(h hash.Hash) CursorOption {
+	return func(c *Cursor) {
+		c.rowHash = h
+	}
+}
+
+// WithAutoClose makes the cursor close the operation as soon as HasMore returns false at the end of the data,
+// instead of keeping it open until Close or the next query. It's meant for loops that may not call Close,
+// the operation can't be fetched again afterwards, for example with SetFetchOrientation(FETCH_FIRST).
+func WithAutoClose() CursorOption {
+	return func(c *Cursor) {
+		c.autoClose = true
+	}
+}
+
+// Cursor creates a cursor from a connection
+func (c *Connection) Cursor(opts ...CursorOption) *Cursor {
+	cursor := &Cursor{
+		conn:  c,
+		queue: make([]*hiveserver.TColumn, 0),
+	}
+	for _, opt := range opts {
+		opt(cursor)
+	}
+	return cursor
+}
+
+// Close closes a session
+func (c *Connection) Close() error {
+	if c.idle != nil && !c.idle.close() {
+		// The session was already closed after IdleTimeout
+		return nil
+	}
+	return c.closeSession()
+}
+
+// closeSession closes the session and the transport. Reconnect waits for it, the idle monitor may call it.
+func (c *Connection) closeSession() error {
+	c.clientLock.RLock()
+	defer c.clientLock.RUnlock()
+	closeRequest := hiveserver.NewTCloseSessionReq()
+	closeRequest.SessionHandle = c.sessionHandle
+	// This context is ignored
+	responseClose, err := hiveserver.NewTCLIServiceClient(c.client.Client_()).CloseSession(context.Background(), closeRequest)
+	if errors.Is(err, ErrConnectionInterrupted) {
+		// The socket is already closed, HiveServer2 closes the session when it notices it unless
+		// hive.server2.close.session.on.disconnect is false
+		c.transport.Close()
+		return err
+	}
+
+	if c.transport != nil {
+		errTransport := c.transport.Close()
+		if errTransport != nil {
+			return errTransport
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !success(safeStatus(responseClose.GetStatus())) {
+		return errors.New("Error closing the session: " + safeStatus(responseClose.GetStatus()).String())
+	}
+	return nil
+}
+
+const (
+	_RUNNING      = 0
+	_FINISHED     = 1
+	_NONE         = 2
+	_CONTEXT_DONE = 3
+	_ERROR        = 4
+	_ASYNC_ENDED  = 5
+)
+
+// Cursor is used for fetching the rows after a query
 type Cursor struct {
 	conn            *Connection
 	operationHandle *hiveserver.TOperationHandle
@@ -484,13 +1477,93 @@ type Cursor struct {
 	newData         bool
 	Err             error
 	description     [][]string
+	columns         []*hiveserver.TColumnDesc
+	result          *ExecResult
+	executeStart    time.Time
+	canceled        bool
+	fetchSize       int64
+	pollInterval    time.Duration
+	prefetch        *prefetcher
+	rowsFetched     int64
+	rowHash         hash.Hash
+	orientation     hiveserver.TFetchOrientation
+	autoClose       bool
+	// Whether the last fetch failed in the transport, see ErrBatchMayBeLost
+	fetchFailed bool
+	// Calls OnResult for the statement executed last, nil once it was called
+	pendingResult func(err error)
+	// Key of the query in the metadata cache of the connection, and whether the description was taken from it
+	metadataKey       string
+	cachedDescription bool
+	// Types set with Bind, the buffers FetchInto reads into, and whether the types were checked against the result
+	boundTypes   []reflect.Type
+	bound        []interface{}
+	boundChecked bool
+	// YARN applications found in the logs, which StreamLogs reads in the background
+	applicationIDs     []string
+	applicationIDsLock sync.Mutex
 
 	// Caller is responsible for managing this channel
 	Logs chan<- []string
+	// WaitForCompletion sends the state of the operation every time it changes.
+	// Caller is responsible for managing this channel
+	States chan<- hiveserver.TOperationState
+}
+
+// ExecResult summarizes the last statement executed by a cursor
+type ExecResult struct {
+	// Leading keyword of the statement, for example INSERT or CREATE
+	StatementType string
+	// Identifier of the operation in the server
+	OperationID string
+	// Whether the statement produced a result set that can be fetched
+	HasResultSet bool
+	// Number of rows modified as reported by the server, -1 if unknown
+	RowsAffected int64
+	// Time since the statement was submitted until it finished, zero while still running
+	Duration time.Duration
 }
 
+// ErrStatementTooLong is the cause of the error of the statements longer than MaxStatementBytes, which aren't sent
+var ErrStatementTooLong = errors.New("gohive: the statement is longer than MaxStatementBytes")
+
+// ErrCanceledByServer is the cause of the cursor error when the server cancels an operation that wasn't canceled by the client
+var ErrCanceledByServer = errors.New("gohive: the operation was canceled by the server")
+
 // WaitForCompletion waits for an async operation to finish
 func (c *Cursor) WaitForCompletion(ctx context.Context) {
+	c.waitForCompletion(ctx, nil)
+}
+
+// WaitForCompletionWithLogs is like WaitForCompletion but also fetches the logs of the operation while waiting, and
+// returns them with the error of the operation, which is also left in Err, for example to find why a Tez task
+// failed. The wait is bounded by timeout if it's greater than zero, the operation keeps running after it, Cancel
+// stops it. The logs written when the operation finishes are fetched after it, the ones sent to Logs are included.
+func (c *Cursor) WaitForCompletionWithLogs(ctx context.Context, timeout time.Duration) ([]string, error) {
+	waitCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var logs []string
+	c.waitForCompletion(waitCtx, func(batch []string) {
+		logs = append(logs, batch...)
+	})
+	err := c.Err
+	for ctx.Err() == nil {
+		batch, fetchErr := c.fetchLogs(ctx)
+		if fetchErr != nil || len(batch) == 0 {
+			break
+		}
+		logs = append(logs, batch...)
+	}
+	return logs, err
+}
+
+// waitForCompletion waits for the operation to finish, calling onLogs with the logs fetched between the polls if it
+// isn't nil
+func (c *Cursor) waitForCompletion(ctx context.Context, onLogs func(logs []string)) {
 	done := make(chan interface{}, 1)
 	defer close(done)
 
@@ -507,12 +1580,17 @@ func (c *Cursor) WaitForCompletion(ctx context.Context) {
 		}
 	}()
 
+	var lastState *hiveserver.TOperationState
 	for true {
-		operationStatus := c.Poll(true)
+		operationStatus := c.poll(ctx, true)
 		if c.Err != nil {
 			return
 		}
 		status := operationStatus.OperationState
+		if c.States != nil && status != nil && (lastState == nil || *lastState != *status) {
+			c.States <- *status
+			lastState = status
+		}
 		finished := !(*status == hiveserver.TOperationState_INITIALIZED_STATE || *status == hiveserver.TOperationState_RUNNING_STATE || *status == hiveserver.TOperationState_PENDING_STATE)
 		if finished {
 			if *operationStatus.OperationState != hiveserver.TOperationState_FINISHED_STATE {
@@ -527,8 +1605,18 @@ func (c *Cursor) WaitForCompletion(ctx context.Context) {
 					errormsg := fmt.Sprintf("gohive: operation in state (%v) without task status or error message", operationStatus.OperationState)
 					msg = &errormsg
 				}
-				c.Err = errors.New(*msg)
+				if *status == hiveserver.TOperationState_CANCELED_STATE && !c.canceled {
+					c.Err = c.conn.nameError(errors.Wrap(ErrCanceledByServer, *msg))
+				} else {
+					c.Err = c.conn.nameError(errors.New(*msg))
+				}
+			} else if c.result != nil {
+				c.result.Duration = time.Since(c.executeStart)
+				if operationStatus.IsSetNumModifiedRows() {
+					c.result.RowsAffected = operationStatus.GetNumModifiedRows()
+				}
 			}
+			c.reportResult(c.Err)
 			break
 		}
 
@@ -536,18 +1624,23 @@ func (c *Cursor) WaitForCompletion(ctx context.Context) {
 			return
 		}
 
-		if c.Logs != nil {
+		if c.Logs != nil || onLogs != nil {
 			logs := c.FetchLogs()
 			if c.Error() != nil {
 				return
 			}
-			c.Logs <- logs
+			if onLogs != nil {
+				onLogs(logs)
+			}
+			if c.Logs != nil {
+				c.Logs <- logs
+			}
 		}
 
-		time.Sleep(time.Duration(time.Duration(c.conn.configuration.PollIntervalInMillis)) * time.Millisecond)
+		time.Sleep(c.getPollInterval())
 		mux.Lock()
 		if contextDone {
-			c.Err = errors.New("Context was done before the query was executed")
+			c.Err = c.conn.nameError(errors.New("Context was done before the query was executed"))
 			c.state = _CONTEXT_DONE
 			mux.Unlock()
 			return
@@ -562,10 +1655,154 @@ func (c *Cursor) Exec(ctx context.Context, query string) {
 	c.Execute(ctx, query, false)
 }
 
+// ExplainMode selects the kind of plan returned by Explain
+type ExplainMode string
+
+const (
+	ExplainFormatted     ExplainMode = "FORMATTED"
+	ExplainExtended      ExplainMode = "EXTENDED"
+	ExplainCBO           ExplainMode = "CBO"
+	ExplainDependency    ExplainMode = "DEPENDENCY"
+	ExplainAuthorization ExplainMode = "AUTHORIZATION"
+	ExplainVectorization ExplainMode = "VECTORIZATION"
+	ExplainAnalyze       ExplainMode = "ANALYZE"
+)
+
+// Explain runs EXPLAIN for the query, with the given modes if any, and returns the plan.
+// The rows of the plan are joined with new lines.
+func (c *Cursor) Explain(ctx context.Context, query string, modes ...ExplainMode) (string, error) {
+	statement := "EXPLAIN "
+	for _, mode := range modes {
+		statement += string(mode) + " "
+	}
+	c.Exec(ctx, statement+query)
+	if c.Err != nil {
+		return "", c.Err
+	}
+	var plan []string
+	for c.HasMore(ctx) {
+		if c.Err != nil {
+			return "", c.Err
+		}
+		var line *string
+		c.FetchOne(ctx, &line)
+		if c.Err != nil {
+			return "", c.Err
+		}
+		if line != nil {
+			plan = append(plan, *line)
+		}
+	}
+	if c.Err != nil {
+		return "", c.Err
+	}
+	return strings.Join(plan, "\n"), nil
+}
+
+// ErrNoRows is returned by QueryRow when the query doesn't return any row
+var ErrNoRows = errors.New("gohive: no rows in result set")
+
+// ErrTooManyRows is returned by QueryRow when the query returns more than one row
+var ErrTooManyRows = errors.New("gohive: more than one row in result set")
+
+// QueryRow executes a query that returns a single row, fetches it into dests like FetchOne and closes the operation.
+// It returns ErrNoRows if there are no rows and ErrTooManyRows if there is more than one.
+func (c *Cursor) QueryRow(ctx context.Context, query string, dests ...interface{}) error {
+	err := c.queryRow(ctx, query, dests...)
+	c.Close()
+	if err == nil {
+		err = c.Err
+	}
+	c.Err = err
+	return err
+}
+
+func (c *Cursor) queryRow(ctx context.Context, query string, dests ...interface{}) error {
+	c.Exec(ctx, query)
+	if c.Err != nil {
+		return c.Err
+	}
+	if !c.HasMore(ctx) {
+		if c.Err != nil {
+			return c.Err
+		}
+		return ErrNoRows
+	}
+	if c.Err != nil {
+		return c.Err
+	}
+	c.FetchOne(ctx, dests...)
+	if c.Err != nil {
+		return c.Err
+	}
+	more := c.HasMore(ctx)
+	if c.Err != nil {
+		return c.Err
+	}
+	if more {
+		return ErrTooManyRows
+	}
+	return nil
+}
+
 // Execute sends a query to hive for execution with a context
 func (c *Cursor) Execute(ctx context.Context, query string, async bool) {
-	c.executeAsync(ctx, query)
+	ctx, cancel := c.conn.withDefaultTimeout(ctx)
+	defer cancel()
+	c.execute(ctx, query, async)
 	if !async {
+		c.retryPreempted(ctx, query)
+	}
+}
+
+// SubmitAsync sends a query and returns as soon as the server accepted it, with the error if it didn't. The status
+// of the operation is tracked in the background as Exec does, and the returned channel is closed once it finished.
+// Then Err has the error of the query, the rows can be fetched and the statements preempted were run again.
+//
+// The cursor must not be used until the channel is closed, the query is canceled by canceling ctx.
+func (c *Cursor) SubmitAsync(ctx context.Context, query string) (<-chan struct{}, error) {
+	ctx, cancel := c.conn.withDefaultTimeout(ctx)
+	c.executeAsync(ctx, query)
+	if c.Err != nil {
+		defer cancel()
+		if c.state == _CONTEXT_DONE {
+			c.handleDoneContext()
+		}
+		return nil, c.Err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		c.complete(ctx, query)
+		c.retryPreempted(ctx, query)
+	}()
+	return done, nil
+}
+
+// retryPreempted runs again a statement canceled by the server, up to PreemptionRetries times
+func (c *Cursor) retryPreempted(ctx context.Context, query string) {
+	for attempt := 1; errors.Is(c.Err, ErrCanceledByServer) && attempt <= c.conn.configuration.PreemptionRetries; attempt++ {
+		if c.conn.configuration.OnPreemption != nil {
+			c.conn.configuration.OnPreemption(query, attempt, c.Err)
+		}
+		select {
+		case <-time.After(c.conn.configuration.PreemptionBackoff * time.Duration(attempt)):
+		case <-ctx.Done():
+			return
+		}
+		c.execute(ctx, query, false)
+	}
+}
+
+func (c *Cursor) execute(ctx context.Context, query string, async bool) {
+	c.executeAsync(ctx, query)
+	if async {
+		// The database changes when the statement completes, until then it's unknown
+		if _, ok := useStatementDatabase(query); ok && c.Err == nil {
+			c.conn.setDatabase("")
+		}
+	} else {
 		// We cannot trust in setting executeReq.RunAsync = true
 		// because if the context ends the operation can't be cancelled cleanly
 		if c.Err != nil {
@@ -574,28 +1811,40 @@ func (c *Cursor) Execute(ctx context.Context, query string, async bool) {
 			}
 			return
 		}
-		c.WaitForCompletion(ctx)
-		if c.Err != nil {
-			if c.state == _CONTEXT_DONE {
-				c.handleDoneContext()
-			} else if c.state == _ERROR {
-				c.Err = errors.New("Probably the context was over when passed to execute. This probably resulted in the message being sent but we didn't get an operation handle so it's most likely a bug in thrift")
-			}
-			return
+		c.complete(ctx, query)
+	}
+}
+
+// complete waits for a statement submitted to finish
+func (c *Cursor) complete(ctx context.Context, query string) {
+	c.WaitForCompletion(ctx)
+	if c.Err != nil {
+		if c.state == _ERROR {
+			c.Err = c.conn.nameError(errors.New("Probably the context was over when passed to execute. This probably resulted in the message being sent but we didn't get an operation handle so it's most likely a bug in thrift"))
 		}
+		// The wait failed before the operation ended, which ends the statement for Exec and SubmitAsync. It's reported
+		// before handleDoneContext resets the cursor.
+		c.reportResult(c.Err)
+		if c.state == _CONTEXT_DONE {
+			c.handleDoneContext()
+		}
+		return
+	}
 
-		// Flush logs after execution is finished
-		if c.Logs != nil {
-			logs := c.FetchLogs()
-			if c.Error() != nil {
-				c.state = _ASYNC_ENDED
-				return
-			}
-			c.Logs <- logs
+	// Flush logs after execution is finished
+	if c.Logs != nil {
+		logs := c.FetchLogs()
+		if c.Error() != nil {
+			c.state = _ASYNC_ENDED
+			return
 		}
+		c.Logs <- logs
+	}
 
-		c.state = _ASYNC_ENDED
+	if database, ok := useStatementDatabase(query); ok {
+		c.conn.setDatabase(database)
 	}
+	c.state = _ASYNC_ENDED
 }
 
 func (c *Cursor) handleDoneContext() {
@@ -613,18 +1862,57 @@ func (c *Cursor) handleDoneContext() {
 
 func (c *Cursor) executeAsync(ctx context.Context, query string) {
 	c.resetState()
+	c.rowsFetched = 0
+	c.resetApplicationIDs()
+
+	if onExecute := c.conn.configuration.OnExecute; onExecute != nil {
+		if err := onExecute(ctx, query); err != nil {
+			c.Err = errors.Wrap(err, "The statement was rejected by OnExecute")
+			return
+		}
+	}
+	if onResult := c.conn.configuration.OnResult; onResult != nil {
+		c.pendingResult = func(err error) {
+			onResult(ctx, query, c.result, err)
+		}
+		defer func() {
+			// The statements submitted are reported when they end, see waitForCompletion
+			if c.Err != nil {
+				c.reportResult(c.Err)
+			}
+		}()
+	}
+	if limit := c.conn.configuration.MaxStatementBytes; limit > 0 && len(query) > limit {
+		c.Err = errors.Wrapf(ErrStatementTooLong, "The statement has %d bytes, more than MaxStatementBytes (%d), split it in smaller batches", len(query), limit)
+		return
+	}
 
 	c.state = _RUNNING
+	c.canceled = false
+	c.executeStart = time.Now()
+	if cache := c.conn.metadataCache; cache != nil {
+		if readStatements[statementType(query)] {
+			c.metadataKey = query
+		} else {
+			cache.clear()
+		}
+	}
+	if cache := c.conn.resultCache; cache != nil && !readStatements[statementType(query)] {
+		cache.clear()
+	}
 	executeReq := hiveserver.NewTExecuteStatementReq()
 	executeReq.SessionHandle = c.conn.sessionHandle
 	executeReq.Statement = query
 	executeReq.RunAsync = true
+	if tag, ok := ctx.Value(queryTagKey{}).(string); ok {
+		executeReq.ConfOverlay = map[string]string{"hive.query.tag": tag}
+	}
 	var responseExecute *hiveserver.TExecuteStatementResp = nil
 
-	responseExecute, c.Err = c.conn.client.ExecuteStatement(ctx, executeReq)
+	responseExecute, c.Err = c.conn.rpcClient().ExecuteStatement(ctx, executeReq)
 
 	if c.Err != nil {
-		if strings.Contains(c.Err.Error(), "context deadline exceeded") {
+		if ctx.Err() != nil || strings.Contains(c.Err.Error(), "context deadline exceeded") {
 			c.state = _CONTEXT_DONE
 			if responseExecute == nil {
 				c.state = _ERROR
@@ -633,39 +1921,99 @@ func (c *Cursor) executeAsync(ctx context.Context, query string) {
 				c.operationHandle = responseExecute.OperationHandle
 			}
 		}
+		c.Err = c.conn.nameError(c.Err)
 		return
 	}
 	if !success(safeStatus(responseExecute.GetStatus())) {
 		status := safeStatus(responseExecute.GetStatus())
 		c.Err = HiveError{
-			error:     errors.New("Error while executing query: " + status.String()),
-			Message:   status.GetErrorMessage(),
-			ErrorCode: int(status.GetErrorCode()),
+			error:      errors.New("Error while executing query: " + status.String()),
+			Message:    status.GetErrorMessage(),
+			ErrorCode:  int(status.GetErrorCode()),
+			Connection: c.conn.configuration.Name,
 		}
 		return
 	}
 
+	c.conn.stats.queriesExecuted.Add(1)
 	c.operationHandle = responseExecute.OperationHandle
+	c.result = &ExecResult{
+		StatementType: statementType(query),
+		OperationID:   operationID(c.operationHandle),
+		HasResultSet:  c.operationHandle.HasResultSet,
+		RowsAffected:  -1,
+	}
+	if c.operationHandle.IsSetModifiedRowCount() {
+		c.result.RowsAffected = int64(c.operationHandle.GetModifiedRowCount())
+	}
 	if !responseExecute.OperationHandle.HasResultSet {
 		c.state = _FINISHED
 	}
 }
 
+// reportResult calls OnResult for the statement executed last with err, if it wasn't called yet
+func (c *Cursor) reportResult(err error) {
+	if report := c.pendingResult; report != nil {
+		c.pendingResult = nil
+		report(err)
+	}
+}
+
+// Result returns a summary of the last statement executed, nil if there isn't one.
+// For async statements RowsAffected and Duration are filled once WaitForCompletion returns.
+func (c *Cursor) Result() *ExecResult {
+	return c.result
+}
+
+// ProducesResultSet returns whether the last statement or metadata operation has rows to fetch, as told by the
+// server when it's executed, so a runner can tell a query from a statement like INSERT or CREATE before fetching.
+// It's false until a statement is executed and after closing the cursor.
+func (c *Cursor) ProducesResultSet() bool {
+	if c.result != nil {
+		return c.result.HasResultSet
+	}
+	return c.operationHandle != nil && c.operationHandle.HasResultSet
+}
+
+func statementType(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimRight(fields[0], ";("))
+}
+
+func operationID(handle *hiveserver.TOperationHandle) string {
+	if handle == nil || handle.OperationId == nil {
+		return ""
+	}
+	guid := handle.OperationId.GUID
+	if len(guid) != 16 {
+		return fmt.Sprintf("%x", guid)
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", guid[0:4], guid[4:6], guid[6:8], guid[8:10], guid[10:16])
+}
+
 // Poll returns the current status of the last operation
 func (c *Cursor) Poll(getProgress bool) (status *hiveserver.TGetOperationStatusResp) {
+	return c.poll(context.Background(), getProgress)
+}
+
+func (c *Cursor) poll(ctx context.Context, getProgress bool) (status *hiveserver.TGetOperationStatusResp) {
 	c.Err = nil
 	progressGet := getProgress
 	pollRequest := hiveserver.NewTGetOperationStatusReq()
 	pollRequest.OperationHandle = c.operationHandle
 	pollRequest.GetProgressUpdate = &progressGet
 	var responsePoll *hiveserver.TGetOperationStatusResp
-	// Context ignored
-	responsePoll, c.Err = c.conn.client.GetOperationStatus(context.Background(), pollRequest)
-	if c.Err != nil {
+	// The context isn't used for cancelling, WaitForCompletion checks it between polls
+	responsePoll, err := c.conn.rpcClient().GetOperationStatus(context.WithoutCancel(ctx), pollRequest)
+	if err != nil {
+		c.Err = c.conn.nameError(err)
 		return nil
 	}
 	if !success(safeStatus(responsePoll.GetStatus())) {
-		c.Err = errors.New("Error closing the operation: " + safeStatus(responsePoll.GetStatus()).String())
+		c.Err = c.conn.nameError(errors.New("Error closing the operation: " + safeStatus(responsePoll.GetStatus()).String()))
 		return nil
 	}
 	return responsePoll
@@ -673,17 +2021,22 @@ func (c *Cursor) Poll(getProgress bool) (status *hiveserver.TGetOperationStatusR
 
 // FetchLogs returns all the Hive execution logs for the latest query up to the current point
 func (c *Cursor) FetchLogs() []string {
+	logs, err := c.fetchLogs(context.Background())
+	c.Err = c.conn.nameError(err)
+	return logs
+}
+
+func (c *Cursor) fetchLogs(ctx context.Context) ([]string, error) {
 	logRequest := hiveserver.NewTFetchResultsReq()
 	logRequest.OperationHandle = c.operationHandle
 	logRequest.Orientation = hiveserver.TFetchOrientation_FETCH_NEXT
-	logRequest.MaxRows = c.conn.configuration.FetchSize
+	logRequest.MaxRows = c.getFetchSize()
 	// FetchType 1 is "logs"
 	logRequest.FetchType = 1
 
-	resp, err := c.conn.client.FetchResults(context.Background(), logRequest)
+	resp, err := c.conn.rpcClient().FetchResults(ctx, logRequest)
 	if err != nil || resp == nil || resp.Results == nil {
-		c.Err = err
-		return nil
+		return nil, err
 	}
 
 	// resp contains 1 row, with a column for each line in the log
@@ -693,8 +2046,59 @@ func (c *Cursor) FetchLogs() []string {
 	for _, col := range cols {
 		logs = append(logs, col.StringVal.Values...)
 	}
+	c.recordApplicationIDs(logs)
 
-	return logs
+	return logs, nil
+}
+
+// StreamLogs fetches the logs of the latest operation in the background and sends every new batch to the
+// returned channel, until the operation is closed or ctx is done. The channel is closed then.
+// Unlike the Logs channel it keeps working after the operation finishes, and it's independent of the fetch of the rows.
+func (c *Cursor) StreamLogs(ctx context.Context) (<-chan []string, error) {
+	if c.operationHandle == nil {
+		return nil, errors.New("StreamLogs can only be called after executing a query")
+	}
+	logRequest := hiveserver.NewTFetchResultsReq()
+	logRequest.OperationHandle = c.operationHandle
+	logRequest.Orientation = hiveserver.TFetchOrientation_FETCH_NEXT
+	logRequest.MaxRows = c.getFetchSize()
+	// FetchType 1 is "logs"
+	logRequest.FetchType = 1
+	client := c.conn.rpcClient()
+	pollInterval := c.getPollInterval()
+
+	logs := make(chan []string)
+	go func() {
+		defer close(logs)
+		for {
+			resp, err := client.FetchResults(ctx, logRequest)
+			// The server fails once the operation is closed
+			if err != nil || !success(safeStatus(resp.GetStatus())) {
+				return
+			}
+			var batch []string
+			for _, col := range resp.GetResults().GetColumns() {
+				if col.IsSetStringVal() {
+					batch = append(batch, col.StringVal.Values...)
+				}
+			}
+			if len(batch) > 0 {
+				c.recordApplicationIDs(batch)
+				select {
+				case logs <- batch:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			select {
+			case <-time.After(pollInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return logs, nil
 }
 
 // Finished returns true if the last async operation has finished
@@ -727,7 +2131,7 @@ func (c *Cursor) fetchIfEmpty(ctx context.Context) {
 	}
 }
 
-// RowMap returns one row as a map. Advances the cursor one
+// RowMap returns one row as a map from the column names to the values RowSlice returns. Advances the cursor one
 func (c *Cursor) RowMap(ctx context.Context) map[string]interface{} {
 	c.Err = nil
 	c.fetchIfEmpty(ctx)
@@ -735,242 +2139,267 @@ func (c *Cursor) RowMap(ctx context.Context) map[string]interface{} {
 		return nil
 	}
 
-	d := c.Description()
+	d := c.DescriptionContext(ctx)
 	if c.Err != nil || len(d) != len(c.queue) {
 		return nil
 	}
+	m, err := c.rowMap(d)
+	if err != nil {
+		c.Err = err
+		return nil
+	}
+	c.consumeRows(c.columnIndex + 1)
+	return m
+}
+
+// Peek returns the next row as RowMap does without advancing the cursor, so the next RowMap, RowSlice, FetchOne or
+// Peek returns it again. The next batch is fetched if the rows of the current one were read. It returns io.EOF
+// when there are no more rows.
+func (c *Cursor) Peek(ctx context.Context) (map[string]interface{}, error) {
+	more := c.HasMore(ctx)
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	if !more || c.columnIndex >= c.totalRows {
+		return nil, io.EOF
+	}
+	d := c.DescriptionContext(ctx)
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	if len(d) != len(c.queue) {
+		return nil, errors.Errorf("The description has %d columns but the number of columns is %d", len(d), len(c.queue))
+	}
+	return c.rowMap(d)
+}
+
+// logPrefix returns the prefix of the messages logged for the cursor, naming its connection if it has a name
+func (c *Cursor) logPrefix() string {
+	if c.conn.configuration.Name == "" {
+		return ""
+	}
+	return "gohive: connection " + c.conn.configuration.Name + ": "
+}
+
+// rowMap returns the current row as a map without advancing the cursor
+func (c *Cursor) rowMap(d [][]string) (map[string]interface{}, error) {
 	m := make(map[string]interface{}, len(c.queue))
 	for i := 0; i < len(c.queue); i++ {
-		columnName := d[i][0]
-		columnType := d[i][1]
-		if columnType == "BOOLEAN_TYPE" {
-			if isNull(c.queue[i].BoolVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].BoolVal.Values[c.columnIndex]
-			}
-		} else if columnType == "TINYINT_TYPE" {
-			if isNull(c.queue[i].ByteVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].ByteVal.Values[c.columnIndex]
-			}
-		} else if columnType == "SMALLINT_TYPE" {
-			if isNull(c.queue[i].I16Val.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].I16Val.Values[c.columnIndex]
-			}
-		} else if columnType == "INT_TYPE" {
-			if isNull(c.queue[i].I32Val.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].I32Val.Values[c.columnIndex]
-			}
-		} else if columnType == "BIGINT_TYPE" {
-			if isNull(c.queue[i].I64Val.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].I64Val.Values[c.columnIndex]
-			}
-		} else if columnType == "FLOAT_TYPE" {
-			if isNull(c.queue[i].DoubleVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].DoubleVal.Values[c.columnIndex]
-			}
-		} else if columnType == "DOUBLE_TYPE" {
-			if isNull(c.queue[i].DoubleVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].DoubleVal.Values[c.columnIndex]
-			}
-		} else if columnType == "STRING_TYPE" || columnType == "VARCHAR_TYPE" || columnType == "CHAR_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "TIMESTAMP_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "DATE_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "BINARY_TYPE" {
-			if isNull(c.queue[i].BinaryVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].BinaryVal.Values[c.columnIndex]
-			}
-		} else if columnType == "ARRAY_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "MAP_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "STRUCT_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "UNION_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].StringVal.Values[c.columnIndex]
+		value, err := c.rowValue(d[i][1], i)
+		if err != nil {
+			return nil, err
+		}
+		m[d[i][0]] = value
+	}
+	if len(m) != len(d) {
+		log.Printf("%sSome columns have the same name as per the description: %v, this makes it impossible to get the values using the RowMap API, please use the FetchOne API", c.logPrefix(), d)
+	}
+	return m, nil
+}
+
+// RowSlice returns one row as a slice. Advances the cursor one
+func (c *Cursor) RowSlice(ctx context.Context) []any {
+	c.Err = nil
+	c.fetchIfEmpty(ctx)
+	if c.Err != nil {
+		return nil
+	}
+
+	d := c.DescriptionContext(ctx)
+	if c.Err != nil || len(d) != len(c.queue) {
+		return nil
+	}
+	m := make([]any, len(c.queue))
+	if c.Err = c.fillRow(d, m); c.Err != nil {
+		return nil
+	}
+	return m
+}
+
+// FetchInto reads one row into dest and advances the cursor one. The values are the ones RowSlice returns, but dest
+// is reused instead of allocating a slice per row. Storing a value in an interface can still allocate, as with RowSlice,
+// except for booleans, TINYINT and the NULL values, or for none of them after Bind.
+// dest must have one element per column. It returns false when there are no more rows or on an error, left in Err.
+func (c *Cursor) FetchInto(ctx context.Context, dest []interface{}) bool {
+	if !c.HasMore(ctx) || c.Err != nil {
+		return false
+	}
+	d := c.DescriptionContext(ctx)
+	if c.Err != nil {
+		return false
+	}
+	if len(dest) != len(c.queue) || len(d) != len(c.queue) {
+		c.Err = errors.Errorf("%d values where passed for filling but the number of columns is %d", len(dest), len(c.queue))
+		return false
+	}
+	if c.bound != nil {
+		return c.fetchBound(d, dest)
+	}
+	c.Err = c.fillRow(d, dest)
+	return c.Err == nil
+}
+
+// fillRow sets the values of the current row in m and advances the cursor one. The cursor isn't advanced on an error.
+func (c *Cursor) fillRow(d [][]string, m []any) error {
+	for i := 0; i < len(c.queue); i++ {
+		value, err := c.rowValue(d[i][1], i)
+		if err != nil {
+			return err
+		}
+		m[i] = value
+	}
+	c.consumeRows(c.columnIndex + 1)
+	return nil
+}
+
+// rowValue returns the value of the column i in the current row as RowMap and RowSlice return it, nil if it's NULL.
+// Complex types, DATE, TIMESTAMP and INTERVAL columns are returned as the text sent by the server, except the
+// UNIONTYPE ones with DecodeUnions, whose text that can't be parsed is an error.
+func (c *Cursor) rowValue(columnType string, i int) (interface{}, error) {
+	value := columnValue(c.queue[i], c.columnIndex)
+	switch columnType {
+	case "FLOAT_TYPE":
+		if f, ok := value.(float64); ok && c.conn.configuration.FloatAsFloat32 {
+			return float32(f), nil
+		}
+	case "DECIMAL_TYPE":
+		if s, ok := value.(string); ok {
+			return c.formatDecimal(i, s), nil
+		}
+	case "UNION_TYPE":
+		if s, ok := value.(string); ok && c.conn.configuration.DecodeUnions {
+			var column *hiveserver.TColumnDesc
+			if i < len(c.columns) {
+				column = c.columns[i]
 			}
-		} else if columnType == "DECIMAL_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[columnName] = nil
-			} else {
-				m[columnName] = c.queue[i].StringVal.Values[c.columnIndex]
+			union, err := parseUnion(s, columnComplexType(column))
+			if err != nil {
+				return nil, errors.Wrapf(err, "index is %v", i)
 			}
+			return union, nil
 		}
 	}
-	if len(m) != len(d) {
-		log.Printf("Some columns have the same name as per the description: %v, this makes it impossible to get the values using the RowMap API, please use the FetchOne API", d)
+	return value, nil
+}
+
+// DecimalFormat is the text of the DECIMAL values returned by RowMap, RowSlice and FetchInto. Depending on the
+// version, servers send them with the trailing zeros of the scale of the column or without them, so the same value
+// can be written differently by two servers.
+type DecimalFormat int
+
+const (
+	// Without the trailing zeros of the fractional part, and without the point if no digit is left after it: "0.10"
+	// is returned as "0.1" and "1.00" as "1"
+	DecimalTrim DecimalFormat = iota
+	// As sent by the server
+	DecimalAsIs
+	// With as many fractional digits as the scale of the column, "0.1" is returned as "0.100" for a DECIMAL(10,3)
+	DecimalFixedScale
+)
+
+// formatDecimal returns the DECIMAL value of the column i in the DecimalFormat of the configuration
+func (c *Cursor) formatDecimal(i int, v string) string {
+	switch c.conn.configuration.DecimalFormat {
+	case DecimalAsIs:
+		return v
+	case DecimalFixedScale:
+		// The scale is only known once the columns are described
+		if i >= len(c.columns) {
+			return v
+		}
+		_, scale := decimalPrecisionScale(primitiveEntry(c.columns[i]))
+		return scaleDecimal(v, int(scale))
 	}
-	c.columnIndex++
-	return m
+	return trimDecimal(v)
 }
 
-// RowSlice returns one row as a slice. Advances the cursor one
-func (c *Cursor) RowSlice(ctx context.Context) []any {
+// scaleDecimal pads or truncates the fractional part of a DECIMAL value to scale digits
+func scaleDecimal(v string, scale int) string {
+	integer, fraction, _ := strings.Cut(v, ".")
+	if len(fraction) > scale {
+		fraction = fraction[:scale]
+	}
+	if scale == 0 {
+		return integer
+	}
+	return integer + "." + fraction + strings.Repeat("0", scale-len(fraction))
+}
+
+// trimDecimal removes the trailing zeros of the fractional part of a DECIMAL value, and the point if it's left alone
+func trimDecimal(v string) string {
+	if strings.Contains(v, ".") {
+		v = strings.TrimRight(v, "0")
+		v = strings.TrimRight(v, ".")
+	}
+	return v
+}
+
+// FetchOneNullable is like FetchOne but also returns whether each column of the row is NULL, which FetchOne only
+// tells with **T destinations. The destinations can also implement sql.Scanner, like sql.NullString or sql.NullInt64,
+// which are given the value of the column as int64, float64, bool, string or []byte, or nil for NULL.
+func (c *Cursor) FetchOneNullable(ctx context.Context, dests ...interface{}) []bool {
 	c.Err = nil
 	c.fetchIfEmpty(ctx)
 	if c.Err != nil {
 		return nil
 	}
 
-	d := c.Description()
-	if c.Err != nil || len(d) != len(c.queue) {
+	if len(c.queue) != len(dests) {
+		c.Err = errors.Errorf("%d arguments where passed for filling but the number of columns is %d", len(dests), len(c.queue))
 		return nil
 	}
-	m := make([]any, len(c.queue))
-	for i := 0; i < len(c.queue); i++ {
-		columnType := d[i][1]
-		if columnType == "BOOLEAN_TYPE" {
-			if isNull(c.queue[i].BoolVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].BoolVal.Values[c.columnIndex]
-			}
-		} else if columnType == "TINYINT_TYPE" {
-			if isNull(c.queue[i].ByteVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].ByteVal.Values[c.columnIndex]
-			}
-		} else if columnType == "SMALLINT_TYPE" {
-			if isNull(c.queue[i].I16Val.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].I16Val.Values[c.columnIndex]
-			}
-		} else if columnType == "INT_TYPE" {
-			if isNull(c.queue[i].I32Val.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].I32Val.Values[c.columnIndex]
-			}
-		} else if columnType == "BIGINT_TYPE" {
-			if isNull(c.queue[i].I64Val.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].I64Val.Values[c.columnIndex]
-			}
-		} else if columnType == "FLOAT_TYPE" {
-			if isNull(c.queue[i].DoubleVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].DoubleVal.Values[c.columnIndex]
-			}
-		} else if columnType == "DOUBLE_TYPE" {
-			if isNull(c.queue[i].DoubleVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].DoubleVal.Values[c.columnIndex]
-			}
-		} else if columnType == "STRING_TYPE" || columnType == "VARCHAR_TYPE" || columnType == "CHAR_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "TIMESTAMP_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "DATE_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "BINARY_TYPE" {
-			if isNull(c.queue[i].BinaryVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].BinaryVal.Values[c.columnIndex]
-			}
-		} else if columnType == "ARRAY_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "MAP_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "STRUCT_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "UNION_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				m[i] = c.queue[i].StringVal.Values[c.columnIndex]
-			}
-		} else if columnType == "DECIMAL_TYPE" {
-			if isNull(c.queue[i].StringVal.Nulls, c.columnIndex) {
-				m[i] = nil
-			} else {
-				v := c.queue[i].StringVal.Values[c.columnIndex]
-				if strings.Contains(v, ".") {
-					v = strings.TrimRight(v, "0")
-					v = strings.TrimRight(v, ".")
-				}
-				m[i] = v
-			}
+	nulls := make([]bool, len(c.queue))
+	fetchDests := make([]interface{}, len(dests))
+	for i, column := range c.queue {
+		value := columnValue(column, c.columnIndex)
+		nulls[i] = value == nil
+		scanner, ok := dests[i].(sql.Scanner)
+		if !ok {
+			fetchDests[i] = dests[i]
+			continue
+		}
+		switch v := value.(type) {
+		case int8:
+			value = int64(v)
+		case int16:
+			value = int64(v)
+		case int32:
+			value = int64(v)
+		}
+		if err := scanner.Scan(value); err != nil {
+			c.Err = errors.Wrapf(err, "index is %v", i)
+			return nil
 		}
 	}
-	c.columnIndex++
-	return m
+	c.FetchOne(ctx, fetchDests...)
+	if c.Err != nil {
+		return nil
+	}
+	return nulls
+}
+
+// structFields returns pointers to the exported fields of the struct dest points to, in declaration order,
+// or nil if dest isn't a pointer to a struct or is the destination of a single column, like a time.Time or a Union
+func structFields(dest interface{}) []interface{} {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct || value.Elem().Type() == timeType || isComplexDest(dest) {
+		return nil
+	}
+	value = value.Elem()
+	fields := make([]interface{}, 0, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		if value.Type().Field(i).IsExported() {
+			fields = append(fields, value.Field(i).Addr().Interface())
+		}
+	}
+	return fields
 }
 
-// FetchOne returns one row and advances the cursor one
+// FetchOne returns one row and advances the cursor one.
+// FLOAT and DOUBLE columns can be read into a float32 as well as a float64.
+// A single pointer to a struct other than time.Time and Union is filled positionally instead, its exported fields in declaration order receive the
+// columns in the order of the result set. The fields must be as many as the columns and of the types of the destinations
+// FetchOne accepts for them, for example int32 or *int32 for an INT column.
 func (c *Cursor) FetchOne(ctx context.Context, dests ...interface{}) {
 	c.Err = nil
 	c.fetchIfEmpty(ctx)
@@ -978,6 +2407,15 @@ func (c *Cursor) FetchOne(ctx context.Context, dests ...interface{}) {
 		return
 	}
 
+	if len(dests) == 1 {
+		if fields := structFields(dests[0]); fields != nil {
+			if len(fields) != len(c.queue) {
+				c.Err = errors.Errorf("%T has %d exported fields but the number of columns is %d", dests[0], len(fields), len(c.queue))
+				return
+			}
+			dests = fields
+		}
+	}
 	if len(c.queue) != len(dests) {
 		c.Err = errors.Errorf("%d arguments where passed for filling but the number of columns is %d", len(dests), len(c.queue))
 		return
@@ -1055,6 +2493,13 @@ func (c *Cursor) FetchOne(ctx context.Context, dests ...interface{}) {
 			d, ok := dests[i].(*int32)
 			if !ok {
 				d, ok := dests[i].(**int32)
+				if !ok && isGoIntDest(dests[i]) {
+					if err := coerceValue(columnValue(c.queue[i], c.columnIndex), dests[i]); err != nil {
+						c.Err = errors.Wrapf(err, "index is %v", i)
+						return
+					}
+					continue
+				}
 				if !ok {
 					c.Err = errors.Errorf("Unexpected data type %T for value %v (should be %T) index is %v", dests[i], c.queue[i].I32Val.Values[c.columnIndex], c.queue[i].I32Val.Values[c.columnIndex], i)
 					return
@@ -1079,6 +2524,13 @@ func (c *Cursor) FetchOne(ctx context.Context, dests ...interface{}) {
 			d, ok := dests[i].(*int64)
 			if !ok {
 				d, ok := dests[i].(**int64)
+				if !ok && isGoIntDest(dests[i]) {
+					if err := coerceValue(columnValue(c.queue[i], c.columnIndex), dests[i]); err != nil {
+						c.Err = errors.Wrapf(err, "index is %v", i)
+						return
+					}
+					continue
+				}
 				if !ok {
 					c.Err = errors.Errorf("Unexpected data type %T for value %v (should be %T) index is %v", dests[i], c.queue[i].I64Val.Values[c.columnIndex], c.queue[i].I64Val.Values[c.columnIndex], i)
 					return
@@ -1103,6 +2555,20 @@ func (c *Cursor) FetchOne(ctx context.Context, dests ...interface{}) {
 			d, ok := dests[i].(*string)
 			if !ok {
 				d, ok := dests[i].(**string)
+				if !ok && isComplexDest(dests[i]) {
+					if c.DescriptionContext(ctx); c.Err != nil {
+						return
+					}
+					var column *hiveserver.TColumnDesc
+					if i < len(c.columns) {
+						column = c.columns[i]
+					}
+					if err := scanComplex(columnValue(c.queue[i], c.columnIndex), dests[i], columnComplexType(column)); err != nil {
+						c.Err = errors.Wrapf(err, "index is %v", i)
+						return
+					}
+					continue
+				}
 				if !ok {
 					c.Err = errors.Errorf("Unexpected data type %T for value %v (should be %T) index is %v", dests[i], c.queue[i].StringVal.Values[c.columnIndex], c.queue[i].StringVal.Values[c.columnIndex], i)
 					return
@@ -1124,6 +2590,22 @@ func (c *Cursor) FetchOne(ctx context.Context, dests ...interface{}) {
 				dests[i] = c.queue[i].DoubleVal.Values[c.columnIndex]
 				continue
 			}
+			// FLOAT columns are sent as doubles, they can be read into a float32 too
+			if d, ok := dests[i].(*float32); ok {
+				*d = float32(c.queue[i].DoubleVal.Values[c.columnIndex])
+				continue
+			}
+			if d, ok := dests[i].(**float32); ok {
+				if isNull(c.queue[i].DoubleVal.Nulls, c.columnIndex) {
+					*d = nil
+				} else {
+					if *d == nil {
+						*d = new(float32)
+					}
+					**d = float32(c.queue[i].DoubleVal.Values[c.columnIndex])
+				}
+				continue
+			}
 			d, ok := dests[i].(*float64)
 			if !ok {
 				d, ok := dests[i].(**float64)
@@ -1172,11 +2654,105 @@ func (c *Cursor) FetchOne(ctx context.Context, dests ...interface{}) {
 			return
 		}
 	}
-	c.columnIndex++
+	c.consumeRows(c.columnIndex + 1)
 
 	return
 }
 
+// RowsFetched returns the number of rows read from the result set of the last query, also after closing the cursor
+func (c *Cursor) RowsFetched() int64 {
+	return c.rowsFetched
+}
+
+// Buffered returns the number of rows of the current batch that haven't been read. While it's positive the next
+// FetchOne, RowMap or RowSlice reads a row already received, at zero HasMore fetches the next batch from the server.
+// The batches prefetched in the background aren't counted.
+func (c *Cursor) Buffered() int {
+	if c.columnIndex >= c.totalRows {
+		return 0
+	}
+	return c.totalRows - c.columnIndex
+}
+
+// consumeRows advances the cursor to the row end of the current batch, counting the rows and writing them to the row hash
+func (c *Cursor) consumeRows(end int) {
+	if c.rowHash != nil {
+		for row := c.columnIndex; row < end; row++ {
+			writeRowText(c.rowHash, c.queue, row)
+		}
+	}
+	c.rowsFetched += int64(end - c.columnIndex)
+	c.columnIndex = end
+}
+
+// writeRowText writes a row in the text format of Hive, without escaping the separators
+func writeRowText(w io.Writer, columns []*hiveserver.TColumn, row int) {
+	for i, column := range columns {
+		if i > 0 {
+			io.WriteString(w, "\t")
+		}
+		switch value := columnValue(column, row).(type) {
+		case nil:
+			io.WriteString(w, "\\N")
+		case []byte:
+			w.Write(value)
+		case string:
+			io.WriteString(w, value)
+		case float64:
+			io.WriteString(w, strconv.FormatFloat(value, 'g', -1, 64))
+		default:
+			fmt.Fprint(w, value)
+		}
+	}
+	io.WriteString(w, "\n")
+}
+
+// columnValue returns the value at the position of the column, nil if it's NULL
+func columnValue(column *hiveserver.TColumn, position int) interface{} {
+	if column.IsSetBoolVal() {
+		if isNull(column.BoolVal.Nulls, position) {
+			return nil
+		}
+		return column.BoolVal.Values[position]
+	} else if column.IsSetByteVal() {
+		if isNull(column.ByteVal.Nulls, position) {
+			return nil
+		}
+		return column.ByteVal.Values[position]
+	} else if column.IsSetI16Val() {
+		if isNull(column.I16Val.Nulls, position) {
+			return nil
+		}
+		return column.I16Val.Values[position]
+	} else if column.IsSetI32Val() {
+		if isNull(column.I32Val.Nulls, position) {
+			return nil
+		}
+		return column.I32Val.Values[position]
+	} else if column.IsSetI64Val() {
+		if isNull(column.I64Val.Nulls, position) {
+			return nil
+		}
+		return column.I64Val.Values[position]
+	} else if column.IsSetDoubleVal() {
+		if isNull(column.DoubleVal.Nulls, position) {
+			return nil
+		}
+		return column.DoubleVal.Values[position]
+	} else if column.IsSetStringVal() {
+		if isNull(column.StringVal.Nulls, position) {
+			return nil
+		}
+		return column.StringVal.Values[position]
+	} else if column.IsSetBinaryVal() {
+		if isNull(column.BinaryVal.Nulls, position) {
+			return nil
+		}
+		return column.BinaryVal.Values[position]
+	}
+	return nil
+}
+
 func isNull(nulls []byte, position int) bool {
 	index := position / 8
 	if len(nulls) > index {
@@ -1190,48 +2766,279 @@ func isNull(nulls []byte, position int) bool {
 // must be called after a FetchResult request
 // a context should be added here but seems to be ignored by thrift
 func (c *Cursor) Description() [][]string {
+	return c.DescriptionContext(context.Background())
+}
+
+// DescriptionContext is like Description but the request of the metadata is bound to ctx
+func (c *Cursor) DescriptionContext(ctx context.Context) [][]string {
 	if c.description != nil {
 		return c.description
 	}
+	cache := c.conn.metadataCache
+	if cache != nil && c.metadataKey != "" {
+		if entry := cache.get(c.metadataKey); entry != nil && (len(c.queue) == 0 || descriptionMatches(entry.columns, c.queue)) {
+			c.description = entry.description
+			c.columns = entry.columns
+			c.cachedDescription = true
+			return c.description
+		}
+	}
 	if c.operationHandle == nil {
 		c.Err = errors.Errorf("Description can only be called after after a Poll or after an async request")
 	}
 
 	metaRequest := hiveserver.NewTGetResultSetMetadataReq()
 	metaRequest.OperationHandle = c.operationHandle
-	metaResponse, err := c.conn.client.GetResultSetMetadata(context.Background(), metaRequest)
+	metaResponse, err := c.conn.rpcClient().GetResultSetMetadata(ctx, metaRequest)
 	if err != nil {
-		c.Err = err
+		c.Err = c.conn.nameError(err)
 		return nil
 	}
 	if metaResponse.Status.StatusCode != hiveserver.TStatusCode_SUCCESS_STATUS {
-		c.Err = errors.New(safeStatus(metaResponse.GetStatus()).String())
+		c.Err = c.conn.nameError(errors.New(safeStatus(metaResponse.GetStatus()).String()))
 		return nil
 	}
 	m := make([][]string, len(metaResponse.Schema.Columns))
 	for i, column := range metaResponse.Schema.Columns {
-		for _, typeDesc := range column.TypeDesc.Types {
-			m[i] = []string{column.ColumnName, typeDesc.PrimitiveEntry.Type.String()}
+		// The first entry is the type of the column, the next ones describe the types inside the complex types
+		if types := column.TypeDesc.Types; len(types) > 0 {
+			m[i] = []string{column.ColumnName, complexTypeName(types[0])}
+			if types[0].PrimitiveEntry != nil {
+				m[i][1] = types[0].PrimitiveEntry.Type.String()
+			}
 		}
 	}
 	c.description = m
+	c.columns = metaResponse.Schema.Columns
+	if cache != nil && c.metadataKey != "" {
+		cache.put(c.metadataKey, m, c.columns)
+	}
 	return m
 }
 
+// schema returns the descriptions of the columns, including the type qualifiers
+func (c *Cursor) schema(ctx context.Context) []*hiveserver.TColumnDesc {
+	if c.DescriptionContext(ctx) == nil {
+		return nil
+	}
+	return c.columns
+}
+
+// ColumnType describes a column of the result set
+type ColumnType struct {
+	// Name of the column
+	Name string
+	// Hive type of the column, for example INT_TYPE
+	HiveType string
+	// Type of the values FetchOne and RowMap return for the column. FetchOne accepts a pointer to it as destination
+	GoType reflect.Type
+}
+
+// Describe returns the columns of the result set with the Go type each of them is read into.
+// Hive types without a Go counterpart, like DECIMAL, TIMESTAMP, DATE or the complex types, are read as strings.
+func (c *Cursor) Describe() []ColumnType {
+	schema := c.schema(context.Background())
+	if schema == nil {
+		return nil
+	}
+	columns := make([]ColumnType, len(schema))
+	for i, column := range schema {
+		columns[i].Name = column.ColumnName
+		columns[i].HiveType = hiveserver.TTypeId_STRING_TYPE.String()
+		columns[i].GoType = reflect.TypeOf("")
+		if entry := primitiveEntry(column); entry != nil {
+			columns[i].HiveType = entry.Type.String()
+			columns[i].GoType = c.valueType(entry.Type)
+		} else if column.TypeDesc != nil && len(column.TypeDesc.Types) > 0 {
+			columns[i].HiveType = complexTypeName(column.TypeDesc.Types[0])
+		}
+	}
+	return columns
+}
+
+// valueType returns the type of the values RowMap and RowSlice return for a column of type typeId, which depends on
+// FloatAsFloat32 and DecodeUnions
+func (c *Cursor) valueType(typeId hiveserver.TTypeId) reflect.Type {
+	switch {
+	case typeId == hiveserver.TTypeId_FLOAT_TYPE && c.conn.configuration.FloatAsFloat32:
+		return reflect.TypeOf(float32(0))
+	case typeId == hiveserver.TTypeId_UNION_TYPE && c.conn.configuration.DecodeUnions:
+		return unionType
+	}
+	return goType(typeId)
+}
+
+// Prepare runs the query until it's compiled, returns the columns of its result set and cancels it without fetching any row.
+// HiveServer2 has the schema once the operation is running, which is after the compilation.
+// Statements without a result set, like DDL, may complete before being canceled.
+func (c *Cursor) Prepare(ctx context.Context, query string) ([]ColumnType, error) {
+	c.Execute(ctx, query, true)
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	columns, err := c.prepare(ctx)
+	c.Cancel()
+	if err == nil {
+		err = c.Err
+	}
+	c.Close()
+	if err == nil {
+		err = c.Err
+	}
+	c.Err = err
+	if err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// prepare waits for the operation to be compiled and returns its columns
+func (c *Cursor) prepare(ctx context.Context) ([]ColumnType, error) {
+	for {
+		status := c.poll(ctx, false)
+		if c.Err != nil {
+			return nil, c.Err
+		}
+		switch status.GetOperationState() {
+		case hiveserver.TOperationState_INITIALIZED_STATE, hiveserver.TOperationState_PENDING_STATE:
+			select {
+			case <-time.After(c.getPollInterval()):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		case hiveserver.TOperationState_RUNNING_STATE, hiveserver.TOperationState_FINISHED_STATE:
+			columns := c.Describe()
+			if c.Err != nil {
+				return nil, c.Err
+			}
+			return columns, nil
+		default:
+			return nil, errors.Errorf("The operation ended in state %s: %s", status.GetOperationState(), status.GetErrorMessage())
+		}
+	}
+}
+
+// goType returns the type of the values sent by the server for columns of the Hive type
+func goType(typeId hiveserver.TTypeId) reflect.Type {
+	switch typeId {
+	case hiveserver.TTypeId_BOOLEAN_TYPE:
+		return reflect.TypeOf(false)
+	case hiveserver.TTypeId_TINYINT_TYPE:
+		return reflect.TypeOf(int8(0))
+	case hiveserver.TTypeId_SMALLINT_TYPE:
+		return reflect.TypeOf(int16(0))
+	case hiveserver.TTypeId_INT_TYPE:
+		return reflect.TypeOf(int32(0))
+	case hiveserver.TTypeId_BIGINT_TYPE:
+		return reflect.TypeOf(int64(0))
+	case hiveserver.TTypeId_FLOAT_TYPE, hiveserver.TTypeId_DOUBLE_TYPE:
+		return reflect.TypeOf(float64(0))
+	case hiveserver.TTypeId_BINARY_TYPE:
+		return reflect.TypeOf([]byte(nil))
+	}
+	return reflect.TypeOf("")
+}
+
+// complexTypeName returns the Hive type of a column described by a complex type entry
+func complexTypeName(entry *hiveserver.TTypeEntry) string {
+	switch {
+	case entry.ArrayEntry != nil:
+		return hiveserver.TTypeId_ARRAY_TYPE.String()
+	case entry.MapEntry != nil:
+		return hiveserver.TTypeId_MAP_TYPE.String()
+	case entry.StructEntry != nil:
+		return hiveserver.TTypeId_STRUCT_TYPE.String()
+	case entry.UnionEntry != nil:
+		return hiveserver.TTypeId_UNION_TYPE.String()
+	case entry.UserDefinedTypeEntry != nil:
+		return hiveserver.TTypeId_USER_DEFINED_TYPE.String()
+	}
+	return hiveserver.TTypeId_STRING_TYPE.String()
+}
+
+// NextResultSet advances to the next result set of the statement and returns whether there was one. The protocol of
+// HiveServer2, which the Spark Thrift Server also implements, returns a single result set per operation and has no
+// call to get another one, so it always returns false and leaves the cursor on the current result set. The statements
+// of a script producing several result sets have to be executed one at a time.
+func (c *Cursor) NextResultSet(ctx context.Context) bool {
+	return false
+}
+
 // HasMore returns whether more rows can be fetched from the server
 func (c *Cursor) HasMore(ctx context.Context) bool {
 	c.Err = nil
+	ctx, cancel := c.conn.withDefaultTimeout(ctx)
+	defer cancel()
 	if c.response == nil && c.state != _FINISHED {
-		c.Err = c.pollUntilData(ctx, 1)
-		return c.state != _FINISHED || c.totalRows != c.columnIndex
+		c.Err = c.conn.nameError(c.pollUntilData(ctx, 1))
+	} else if c.totalRows == c.columnIndex && c.state != _FINISHED {
+		// *c.response.HasMoreRows is always false
+		// so it can be checked and another roundtrip has to be done if extra data has been added
+		c.Err = c.conn.nameError(c.pollUntilData(ctx, 1))
+	}
+
+	more := c.state != _FINISHED || c.totalRows != c.columnIndex
+	if !more && c.autoClose && c.Err == nil {
+		c.stopPrefetch()
+		c.Err = c.conn.nameError(c.closeOperation())
+	}
+	return more
+}
+
+// HasMoreErr is like HasMore but also returns the error of the fetch, so the end of the data can be told apart from a failure.
+// It returns false when there is an error.
+func (c *Cursor) HasMoreErr(ctx context.Context) (bool, error) {
+	more := c.HasMore(ctx)
+	if c.Err != nil {
+		return false, c.Err
+	}
+	return more, nil
+}
+
+// getFetchSize returns the fetch size of the cursor, the one of the connection if it wasn't overridden.
+// A negative fetch size, like FETCH_SIZE_UNLIMITED, is sent as the largest batch the server can handle.
+// It's capped at the MaxFetchSize of the connection when it's known.
+func (c *Cursor) getFetchSize() int64 {
+	fetchSize := c.conn.configuration.FetchSize
+	if c.fetchSize != 0 {
+		fetchSize = c.fetchSize
+	}
+	if fetchSize < 0 {
+		// The server reads it into a Java int
+		fetchSize = math.MaxInt32
+	}
+	if maxFetchSize := c.conn.maxFetchSize; maxFetchSize > 0 && fetchSize > maxFetchSize {
+		return maxFetchSize
+	}
+	return fetchSize
+}
+
+// fetchError explains the error of a fetch of a batch that didn't fit in a SASL frame. The transport can't tell which
+// column or row made it too big, the error gives the size of the frame and, when fetching forward, the position of the
+// first row of the batch in the result.
+func (c *Cursor) fetchError(err error, rows int64, orientation hiveserver.TFetchOrientation) error {
+	var sizeErr *frameSizeError
+	if !errors.As(err, &sizeErr) {
+		return err
 	}
-	// *c.response.HasMoreRows is always false
-	// so it can be checked and another roundtrip has to be done if extra data has been added
-	if c.totalRows == c.columnIndex && c.state != _FINISHED {
-		c.Err = c.pollUntilData(ctx, 1)
+	position := ""
+	if orientation == hiveserver.TFetchOrientation_FETCH_NEXT {
+		position = fmt.Sprintf(" at row %d", c.rowsFetched+int64(c.Buffered())+1)
 	}
+	if rows <= 1 {
+		return errors.Wrapf(err, "The row of the result%s takes a frame of %d bytes, more than MaxSize (%d), increase MaxSize",
+			position, sizeErr.size, sizeErr.maxLength)
+	}
+	return errors.Wrapf(err, "The batch of up to %d rows%s takes a frame of %d bytes, more than MaxSize (%d), lower FetchSize or increase MaxSize",
+		rows, position, sizeErr.size, sizeErr.maxLength)
+}
 
-	return c.state != _FINISHED || c.totalRows != c.columnIndex
+// getPollInterval returns the poll interval of the cursor, the one of the connection if it wasn't overridden
+func (c *Cursor) getPollInterval() time.Duration {
+	if c.pollInterval > 0 {
+		return c.pollInterval
+	}
+	return time.Duration(c.conn.configuration.PollIntervalInMillis) * time.Millisecond
 }
 
 func (c *Cursor) Error() error {
@@ -1239,11 +3046,22 @@ func (c *Cursor) Error() error {
 }
 
 func (c *Cursor) pollUntilData(ctx context.Context, n int) (err error) {
+	if c.fetchFailed {
+		c.fetchFailed = false
+		if c.orientation != hiveserver.TFetchOrientation_FETCH_FIRST {
+			return errors.Wrap(ErrBatchMayBeLost, "The previous fetch failed, the next call continues from the position of the server")
+		}
+	}
+	if c.conn.configuration.PrefetchBatches > 0 && c.orientation == hiveserver.TFetchOrientation_FETCH_NEXT {
+		return c.receivePrefetched(ctx, n)
+	}
 	rowsAvailable := make(chan error)
 	var stopLock sync.Mutex
 	done := false
+	maxEmptyPolls := c.conn.configuration.MaxEmptyPolls
 	go func() {
 		defer close(rowsAvailable)
+		emptyPolls := 0
 		for true {
 			stopLock.Lock()
 			if done {
@@ -1255,30 +3073,32 @@ func (c *Cursor) pollUntilData(ctx context.Context, n int) (err error) {
 
 			fetchRequest := hiveserver.NewTFetchResultsReq()
 			fetchRequest.OperationHandle = c.operationHandle
-			fetchRequest.Orientation = hiveserver.TFetchOrientation_FETCH_NEXT
-			fetchRequest.MaxRows = c.conn.configuration.FetchSize
-			responseFetch, err := c.conn.client.FetchResults(context.Background(), fetchRequest)
+			fetchRequest.Orientation = c.orientation
+			fetchRequest.MaxRows = c.getFetchSize()
+			responseFetch, err := c.conn.rpcClient().FetchResults(ctx, fetchRequest)
 			if err != nil {
-				rowsAvailable <- err
+				c.fetchFailed = true
+				rowsAvailable <- c.fetchError(err, fetchRequest.MaxRows, fetchRequest.Orientation)
 				return
 			}
 			c.response = responseFetch
 
 			if safeStatus(responseFetch.GetStatus()).StatusCode != hiveserver.TStatusCode_SUCCESS_STATUS {
-				rowsAvailable <- errors.New(safeStatus(responseFetch.GetStatus()).String())
+				rowsAvailable <- c.fetchStatusError(c.orientation, safeStatus(responseFetch.GetStatus()))
 				return
 			}
-			err = c.parseResults(responseFetch)
-			if err != nil {
-				rowsAvailable <- err
-				return
-			}
-
-			if len(c.queue) > 0 {
-				rowsAvailable <- nil
-				return
+			if len(responseFetch.GetResults().GetColumns()) == 0 {
+				// The batches without columns are polled again like in the prefetching, see MaxEmptyPolls
+				emptyPolls++
+				if maxEmptyPolls > 0 && emptyPolls >= maxEmptyPolls {
+					rowsAvailable <- errors.Wrapf(ErrTooManyEmptyPolls, "%d fetches", emptyPolls)
+					return
+				}
+				time.Sleep(c.getPollInterval())
+				continue
 			}
-			time.Sleep(time.Duration(c.conn.configuration.PollIntervalInMillis) * time.Millisecond)
+			rowsAvailable <- c.parseResults(responseFetch)
+			return
 		}
 	}()
 
@@ -1288,11 +3108,12 @@ func (c *Cursor) pollUntilData(ctx context.Context, n int) (err error) {
 		stopLock.Lock()
 		done = true
 		stopLock.Unlock()
-		select {
 		// Wait for goroutine to finish
-		case <-rowsAvailable:
+		if fetchErr := <-rowsAvailable; errors.Is(fetchErr, ErrConnectionInterrupted) {
+			err = errors.Wrap(fetchErr, "Context is done")
+		} else {
+			err = errors.New("Context is done")
 		}
-		err = errors.New("Context is done")
 	}
 
 	if err != nil {
@@ -1305,29 +3126,113 @@ func (c *Cursor) pollUntilData(ctx context.Context, n int) (err error) {
 	return nil
 }
 
+// ErrScrollNotSupported is set as the cursor error when the server rejects a fetch orientation. FETCH_RELATIVE and
+// FETCH_ABSOLUTE aren't offered at all: TFetchResultsReq has no field for the offset or the position to move to.
+var ErrScrollNotSupported = errors.New("gohive: the server doesn't support this fetch orientation")
+
+// The SQL state of the error sent by HiveServer2 for a fetch orientation it doesn't support
+const unsupportedOrientationState = "HY106"
+
+// fetchStatusError returns the error of a fetch that didn't succeed, wrapping ErrScrollNotSupported if the server
+// rejected the orientation and a HiveError otherwise
+func (c *Cursor) fetchStatusError(orientation hiveserver.TFetchOrientation, status *hiveserver.TStatus) error {
+	if status.GetSqlState() == unsupportedOrientationState {
+		return errors.Wrapf(ErrScrollNotSupported, "%s: %s", orientation, status.GetErrorMessage())
+	}
+	return HiveError{
+		error:      errors.New("Error while fetching results: " + status.String()),
+		Message:    status.GetErrorMessage(),
+		ErrorCode:  int(status.GetErrorCode()),
+		Connection: c.conn.configuration.Name,
+	}
+}
+
+// SetFetchOrientation sets the orientation of the fetches done by HasMore and the Fetch methods, FETCH_NEXT by default.
+// It's kept for the next queries until it's set back to FETCH_NEXT. Batches aren't prefetched with other orientations,
+// the prefetching in progress is stopped and the batches prefetched are discarded.
+func (c *Cursor) SetFetchOrientation(orientation hiveserver.TFetchOrientation) {
+	c.stopPrefetch()
+	c.orientation = orientation
+}
+
+// FetchPrior replaces the rows buffered in the cursor with the previous rowset. There is no FetchRelative or
+// FetchAbsolute, as the protocol can't send the offset or the position with FETCH_RELATIVE and FETCH_ABSOLUTE.
+func (c *Cursor) FetchPrior(ctx context.Context) {
+	c.scroll(ctx, hiveserver.TFetchOrientation_FETCH_PRIOR)
+}
+
+// scroll does a single fetch with the given orientation, bounded by DefaultTimeout like HasMore. Most HiveServer2
+// versions only support FETCH_NEXT and FETCH_FIRST and reject the others, in which case c.Err wraps
+// ErrScrollNotSupported. Only orientations without an offset can be used, see ErrScrollNotSupported. The prefetching
+// is stopped, as the server moves from the position after the batches already prefetched.
+func (c *Cursor) scroll(ctx context.Context, orientation hiveserver.TFetchOrientation) {
+	c.Err = nil
+	c.stopPrefetch()
+	ctx, cancel := c.conn.withDefaultTimeout(ctx)
+	defer cancel()
+	if c.operationHandle == nil {
+		c.Err = errors.New("Scrolling can only be done after executing a query")
+		return
+	}
+	if !c.operationHandle.HasResultSet {
+		c.Err = errors.New("Scrolling can only be done in the result set of a query")
+		return
+	}
+
+	fetchRequest := hiveserver.NewTFetchResultsReq()
+	fetchRequest.OperationHandle = c.operationHandle
+	fetchRequest.Orientation = orientation
+	fetchRequest.MaxRows = c.getFetchSize()
+	responseFetch, err := c.conn.rpcClient().FetchResults(ctx, fetchRequest)
+	if err != nil {
+		c.Err = c.conn.nameError(c.fetchError(err, fetchRequest.MaxRows, orientation))
+		return
+	}
+	if !success(safeStatus(responseFetch.GetStatus())) {
+		c.Err = c.conn.nameError(c.fetchStatusError(orientation, safeStatus(responseFetch.GetStatus())))
+		return
+	}
+
+	state := c.state
+	c.response = responseFetch
+	c.Err = c.conn.nameError(c.parseResults(responseFetch))
+	if c.Err != nil {
+		return
+	}
+	if c.totalRows > 0 {
+		// Rows may be left after the new position even if the end was reached before
+		c.state = _ASYNC_ENDED
+	} else {
+		c.state = state
+	}
+}
+
 // Cancels the current operation
 func (c *Cursor) Cancel() {
 	c.Err = nil
+	c.canceled = true
 	cancelRequest := hiveserver.NewTCancelOperationReq()
 	cancelRequest.OperationHandle = c.operationHandle
 	var responseCancel *hiveserver.TCancelOperationResp
 	// This context is simply ignored
-	responseCancel, c.Err = c.conn.client.CancelOperation(context.Background(), cancelRequest)
-	if c.Err != nil {
+	responseCancel, err := c.conn.rpcClient().CancelOperation(context.Background(), cancelRequest)
+	if err != nil {
+		c.Err = c.conn.nameError(err)
 		return
 	}
 	if !success(safeStatus(responseCancel.GetStatus())) {
-		c.Err = errors.New("Error closing the operation: " + safeStatus(responseCancel.GetStatus()).String())
+		c.Err = c.conn.nameError(errors.New("Error closing the operation: " + safeStatus(responseCancel.GetStatus()).String()))
 	}
 	return
 }
 
 // Close closes the cursor
 func (c *Cursor) Close() {
-	c.Err = c.resetState()
+	c.Err = c.conn.nameError(c.resetState())
 }
 
 func (c *Cursor) resetState() error {
+	c.stopPrefetch()
 	c.response = nil
 	c.Err = nil
 	c.queue = nil
@@ -1335,12 +3240,24 @@ func (c *Cursor) resetState() error {
 	c.totalRows = 0
 	c.state = _NONE
 	c.description = nil
+	c.columns = nil
+	c.metadataKey = ""
+	c.cachedDescription = false
+	c.boundChecked = false
 	c.newData = false
+	c.fetchFailed = false
+	c.result = nil
+	c.pendingResult = nil
+	return c.closeOperation()
+}
+
+// closeOperation closes the operation of the cursor in the server, if any
+func (c *Cursor) closeOperation() error {
 	if c.operationHandle != nil {
 		closeRequest := hiveserver.NewTCloseOperationReq()
 		closeRequest.OperationHandle = c.operationHandle
 		// This context is ignored
-		responseClose, err := c.conn.client.CloseOperation(context.Background(), closeRequest)
+		responseClose, err := c.conn.rpcClient().CloseOperation(context.Background(), closeRequest)
 		c.operationHandle = nil
 		if err != nil {
 			return err
@@ -1357,6 +3274,20 @@ func (c *Cursor) parseResults(response *hiveserver.TFetchResultsResp) (err error
 	c.queue = response.Results.GetColumns()
 	c.columnIndex = 0
 	c.totalRows, err = getTotalRows(c.queue)
+	c.conn.stats.addFetch(max(c.totalRows, 0), c.queue)
+	if err == nil && c.conn.configuration.Charset != nil {
+		err = decodeStrings(c.queue, c.conn.configuration.Charset)
+	}
+	if err == nil {
+		err = checkUTF8(c.queue, c.conn.configuration.InvalidUTF8)
+	}
+	if err == nil && c.cachedDescription && !descriptionMatches(c.columns, c.queue) {
+		// The cached description is stale, the next call to Description requests it again
+		c.conn.metadataCache.remove(c.metadataKey)
+		c.description = nil
+		c.columns = nil
+		c.cachedDescription = false
+	}
 	c.newData = c.totalRows > 0
 	if !c.newData {
 		c.state = _FINISHED
@@ -1364,29 +3295,49 @@ func (c *Cursor) parseResults(response *hiveserver.TFetchResultsResp) (err error
 	return
 }
 
+// getTotalRows returns the number of rows of the columns, all of them must have the same number of rows.
+// Every Hive type is carried by one of the typed columns, DECIMAL, TIMESTAMP, CHAR, VARCHAR and the complex types by StringVal.
 func getTotalRows(columns []*hiveserver.TColumn) (int, error) {
-	for _, el := range columns {
-		if el.IsSetBinaryVal() {
-			return len(el.BinaryVal.Values), nil
-		} else if el.IsSetByteVal() {
-			return len(el.ByteVal.Values), nil
-		} else if el.IsSetI16Val() {
-			return len(el.I16Val.Values), nil
-		} else if el.IsSetI32Val() {
-			return len(el.I32Val.Values), nil
-		} else if el.IsSetI64Val() {
-			return len(el.I64Val.Values), nil
-		} else if el.IsSetBoolVal() {
-			return len(el.BoolVal.Values), nil
-		} else if el.IsSetDoubleVal() {
-			return len(el.DoubleVal.Values), nil
-		} else if el.IsSetStringVal() {
-			return len(el.StringVal.Values), nil
-		} else {
-			return -1, errors.Errorf("Unrecognized column type %T", el)
+	if len(columns) == 0 {
+		return 0, errors.New("All columns seem empty")
+	}
+	totalRows := -1
+	for i, column := range columns {
+		rows := columnLength(column)
+		if rows < 0 {
+			return -1, errors.Errorf("Unrecognized column type for column %d: %v", i, column)
 		}
+		if totalRows >= 0 && rows != totalRows {
+			return -1, errors.Errorf("Column %d has %d rows but the previous ones have %d", i, rows, totalRows)
+		}
+		totalRows = rows
+	}
+	return totalRows, nil
+}
+
+// columnLength returns the number of values of the column, -1 if no values are set
+func columnLength(column *hiveserver.TColumn) int {
+	switch {
+	case column == nil:
+		return -1
+	case column.IsSetBinaryVal():
+		return len(column.BinaryVal.Values)
+	case column.IsSetByteVal():
+		return len(column.ByteVal.Values)
+	case column.IsSetI16Val():
+		return len(column.I16Val.Values)
+	case column.IsSetI32Val():
+		return len(column.I32Val.Values)
+	case column.IsSetI64Val():
+		return len(column.I64Val.Values)
+	case column.IsSetBoolVal():
+		return len(column.BoolVal.Values)
+	case column.IsSetDoubleVal():
+		return len(column.DoubleVal.Values)
+	case column.IsSetStringVal():
+		return len(column.StringVal.Values)
 	}
-	return 0, errors.New("All columns seem empty")
+	return -1
 }
 
 func safeStatus(status *hiveserver.TStatus) *hiveserver.TStatus {
@@ -6,6 +6,8 @@ package gohive
 import (
 	"context"
 	"crypto/tls"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -785,6 +787,27 @@ func TestSimpleSelectWithNil(t *testing.T) {
 	closeAll(t, connection, cursor)
 }
 
+func TestSimpleSelectWithNilNullable(t *testing.T) {
+	connection, cursor, tableName := prepareTable(t, 0, 1000)
+	cursor.Execute(context.Background(), fmt.Sprintf("INSERT INTO %s VALUES (1, NULL) ", tableName), false)
+	cursor.Execute(context.Background(), fmt.Sprintf("SELECT * FROM %s", tableName), false)
+	if cursor.Error() != nil {
+		t.Fatal(cursor.Error())
+	}
+	var s sql.NullString
+	var i int32
+	nulls := cursor.FetchOneNullable(context.Background(), &i, &s)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+
+	if i != 1 || s.Valid || !reflect.DeepEqual(nulls, []bool{false, true}) {
+		t.Fatalf("Unexpected values for i(%d), s(%v) or nulls(%v)", i, s, nulls)
+	}
+
+	closeAll(t, connection, cursor)
+}
+
 func TestIsRow(t *testing.T) {
 	connection, cursor, tableName := prepareTable(t, 1, 1000)
 	cursor.Execute(context.Background(), fmt.Sprintf("SELECT * FROM %s", tableName), false)
@@ -905,6 +928,9 @@ func TestHiveError(t *testing.T) {
 	if hiveErr.Message != "Error while compiling statement: FAILED: SemanticException [Error 10001]: Line 1:14 Table not found 'table_doesnt_exist'" {
 		t.Fatalf("expected error message: 10001, got %s", hiveErr.Message)
 	}
+	if hiveErr.Category() != ErrorCategorySemantic {
+		t.Fatalf("expected a semantic error, got %s", hiveErr.Category())
+	}
 
 	closeAll(t, connection, cursor)
 }
@@ -1809,6 +1835,201 @@ func TestParseZookeeperHiveServer2Info(t *testing.T) {
 	}
 }
 
+func TestExecResult(t *testing.T) {
+	connection, cursor := makeConnection(t, 1000)
+	tableName := createTable(t, cursor)
+	if cursor.Result() == nil || cursor.Result().StatementType != "CREATE" {
+		t.Fatalf("Unexpected result after create: %+v", cursor.Result())
+	}
+	if cursor.Result().HasResultSet {
+		t.Fatal("CREATE shouldn't produce a result set")
+	}
+
+	cursor.Exec(context.Background(), fmt.Sprintf("INSERT INTO %s VALUES (1, '1'), (2, '2')", tableName))
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	result := cursor.Result()
+	if result.StatementType != "INSERT" || result.OperationID == "" || result.Duration <= 0 {
+		t.Fatalf("Unexpected result after insert: %+v", result)
+	}
+
+	cursor.Exec(context.Background(), fmt.Sprintf("SELECT * FROM %s", tableName))
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if !cursor.Result().HasResultSet {
+		t.Fatal("SELECT should produce a result set")
+	}
+
+	closeAll(t, connection, cursor)
+	if cursor.Result() != nil {
+		t.Fatal("Result should be reset after closing the cursor")
+	}
+}
+
+func TestFetchPriorNotSupported(t *testing.T) {
+	connection, cursor, tableName := prepareTable(t, 2, 1000)
+	cursor.Exec(context.Background(), fmt.Sprintf("SELECT * FROM %s", tableName))
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	cursor.FetchPrior(context.Background())
+	if !errors.Is(cursor.Err, ErrScrollNotSupported) {
+		t.Fatalf("Expected ErrScrollNotSupported, got: %v", cursor.Err)
+	}
+
+	// Fetching forward should still work
+	var i int32
+	var s string
+	cursor.FetchOne(context.Background(), &i, &s)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	closeAll(t, connection, cursor)
+}
+
+func TestHasMoreErr(t *testing.T) {
+	connection, cursor, tableName := prepareTable(t, 2, 1000)
+	cursor.Exec(context.Background(), fmt.Sprintf("SELECT * FROM %s", tableName))
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	var i int32
+	var s string
+	rows := 0
+	for {
+		more, err := cursor.HasMoreErr(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !more {
+			break
+		}
+		cursor.FetchOne(context.Background(), &i, &s)
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		rows++
+	}
+	if rows != 1000 {
+		t.Fatalf("Expected 1000 rows, got %d", rows)
+	}
+	closeAll(t, connection, cursor)
+}
+
+func TestExplain(t *testing.T) {
+	connection, cursor, tableName := prepareTable(t, 2, 10)
+	plan, err := cursor.Explain(context.Background(), fmt.Sprintf("SELECT * FROM %s", tableName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plan, "Stage") {
+		t.Fatalf("Unexpected plan: %s", plan)
+	}
+	plan, err = cursor.Explain(context.Background(), fmt.Sprintf("SELECT * FROM %s", tableName), ExplainExtended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan == "" {
+		t.Fatal("Expected an extended plan")
+	}
+	tree, err := cursor.ExplainTree(context.Background(), fmt.Sprintf("SELECT * FROM %s", tableName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Find("TableScan")) == 0 {
+		t.Fatalf("Expected a TableScan in the plan: %+v", tree)
+	}
+	closeAll(t, connection, cursor)
+}
+
+func TestCurrentDatabase(t *testing.T) {
+	connection, cursor := makeConnection(t, 1000)
+	cursor.Exec(context.Background(), "CREATE DATABASE IF NOT EXISTS gohive_current")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	cursor.Execute(context.Background(), "USE gohive_current", true)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	cursor.WaitForCompletion(context.Background())
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	database, err := connection.CurrentDatabase(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if database != "gohive_current" {
+		t.Fatalf("Expected gohive_current, got %s", database)
+	}
+	cursor.Exec(context.Background(), "USE default")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	closeAll(t, connection, cursor)
+}
+
+func TestHiveVars(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.HiveVars = map[string]string{"gohive_value": "42"}
+	configuration.HiveConf = map[string]string{"hive.query.name": "gohive"}
+	connection, cursor := makeConnectionWithConnectConfiguration(t, configuration)
+	cursor.Exec(context.Background(), "SELECT ${hivevar:gohive_value}")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	var value int32
+	cursor.FetchOne(context.Background(), &value)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if value != 42 {
+		t.Fatalf("Expected 42, got %d", value)
+	}
+	closeAll(t, connection, cursor)
+}
+
+func TestGetTablesCatalog(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.Service = "hive"
+	configuration.TransportMode = getTransport()
+	configuration.Catalog = "hive"
+	connection, cursor := makeConnectionWithConnectConfiguration(t, configuration)
+	tableName := createTable(t, cursor)
+
+	cursor.GetTables(context.Background(), "default", tableName, nil)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	m := cursor.RowMap(context.Background())
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if m["TABLE_NAME"] != tableName {
+		t.Fatalf("Unexpected row: %v", m)
+	}
+
+	cursor.GetColumns(context.Background(), "default", tableName, "")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	columns := 0
+	for cursor.HasMore(context.Background()) {
+		cursor.RowMap(context.Background())
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		columns++
+	}
+	if columns != 2 {
+		t.Fatalf("Expected 2 columns, got %d", columns)
+	}
+	closeAll(t, connection, cursor)
+}
+
 func prepareAllTypesTable(t *testing.T, cursor *Cursor) {
 	createAllTypesTable(t, cursor)
 	insertAllTypesTable(t, cursor)
@@ -0,0 +1,139 @@
+package gohive
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+// ErrIdleTimeout is the error of the calls made with a connection closed after being idle for IdleTimeout
+var ErrIdleTimeout = errors.New("gohive: the connection was closed after being idle longer than IdleTimeout")
+
+type keepAliveKey struct{}
+
+// idleMonitor closes the session of a connection after IdleTimeout without calls and sends the keep-alives
+type idleMonitor struct {
+	lock          sync.Mutex
+	lastUsed      time.Time
+	lastKeepAlive time.Time
+	inFlight      int
+	// expired is set when the monitor closed the session, closed when Close did
+	expired bool
+	closed  bool
+	stop    chan struct{}
+}
+
+// startIdleMonitor starts watching the calls of the connection if IdleTimeout or KeepAliveInterval is set
+func (c *Connection) startIdleMonitor() {
+	idleTimeout := c.configuration.IdleTimeout
+	keepAliveInterval := c.configuration.KeepAliveInterval
+	if idleTimeout <= 0 && keepAliveInterval <= 0 {
+		return
+	}
+	now := time.Now()
+	m := &idleMonitor{lastUsed: now, lastKeepAlive: now, stop: make(chan struct{})}
+	c.idle = m
+
+	tick := idleTimeout
+	if keepAliveInterval > 0 && (tick <= 0 || keepAliveInterval < tick) {
+		tick = keepAliveInterval
+	}
+	ticker := time.NewTicker(max(tick/4, time.Millisecond))
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+			m.lock.Lock()
+			if m.closed {
+				m.lock.Unlock()
+				return
+			}
+			now := time.Now()
+			if m.inFlight == 0 && idleTimeout > 0 && now.Sub(m.lastUsed) >= idleTimeout {
+				m.expired = true
+				m.lock.Unlock()
+				c.closeSession()
+				return
+			}
+			keepAlive := m.inFlight == 0 && keepAliveInterval > 0 &&
+				now.Sub(m.lastUsed) >= keepAliveInterval && now.Sub(m.lastKeepAlive) >= keepAliveInterval
+			if keepAlive {
+				m.lastKeepAlive = now
+			}
+			m.lock.Unlock()
+			if keepAlive {
+				c.keepAlive()
+			}
+		}
+	}()
+}
+
+// keepAlive sends a GetInfo request, which refreshes the last access of the session in the server without counting
+// as a use of the connection for IdleTimeout
+func (c *Connection) keepAlive() {
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), keepAliveKey{}, true), c.configuration.KeepAliveInterval)
+	defer cancel()
+	request := hiveserver.NewTGetInfoReq()
+	request.SessionHandle = c.sessionHandle
+	request.InfoType = hiveserver.TGetInfoType_CLI_SERVER_NAME
+	c.rpcClient().GetInfo(ctx, request)
+}
+
+// middleware records the calls, and fails them once the session was closed by the monitor
+func (m *idleMonitor) middleware() thrift.ClientMiddleware {
+	return func(next thrift.TClient) thrift.TClient {
+		return thrift.WrappedTClient{
+			Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+				keepAlive := ctx.Value(keepAliveKey{}) != nil
+				m.lock.Lock()
+				if m.expired {
+					m.lock.Unlock()
+					return thrift.ResponseMeta{}, ErrIdleTimeout
+				}
+				m.inFlight++
+				m.lock.Unlock()
+				defer func() {
+					m.lock.Lock()
+					m.inFlight--
+					if !keepAlive {
+						m.lastUsed = time.Now()
+					}
+					m.lock.Unlock()
+				}()
+				return next.Call(ctx, method, args, result)
+			},
+		}
+	}
+}
+
+// close stops the monitor, it returns false if the session was already closed after IdleTimeout
+func (m *idleMonitor) close() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.expired {
+		return false
+	}
+	if !m.closed {
+		m.closed = true
+		close(m.stop)
+	}
+	return true
+}
+
+// Expired returns whether the connection was closed after being idle for IdleTimeout, so it has to be discarded
+func (c *Connection) Expired() bool {
+	if c.idle == nil {
+		return false
+	}
+	c.idle.lock.Lock()
+	defer c.idle.lock.Unlock()
+	return c.idle.expired
+}
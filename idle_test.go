@@ -0,0 +1,94 @@
+package gohive
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+// idleHiveServer counts the GetInfo and CloseSession requests
+type idleHiveServer struct {
+	operationHiveServer
+	infos          atomic.Int32
+	closedSessions atomic.Int32
+}
+
+func (s *idleHiveServer) GetInfo(ctx context.Context, req *hiveserver.TGetInfoReq) (*hiveserver.TGetInfoResp, error) {
+	s.infos.Add(1)
+	return s.operationHiveServer.GetInfo(ctx, req)
+}
+
+func (s *idleHiveServer) CloseSession(ctx context.Context, req *hiveserver.TCloseSessionReq) (*hiveserver.TCloseSessionResp, error) {
+	s.closedSessions.Add(1)
+	return s.operationHiveServer.CloseSession(ctx, req)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	server := &idleHiveServer{}
+	configuration := NewConnectConfiguration()
+	configuration.IdleTimeout = 100 * time.Millisecond
+	connection := connectFakeHiveServer(t, server, configuration)
+	cursor := connection.Cursor()
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		cursor.Exec(context.Background(), "SELECT 1")
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+	}
+	if connection.Expired() {
+		t.Fatal("Expected the connection to be kept while it's used")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	// The connection expires before the server receives the CloseSession request
+	for (!connection.Expired() || server.closedSessions.Load() == 0) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !connection.Expired() || server.closedSessions.Load() != 1 {
+		t.Fatalf("Expected the session to be closed after IdleTimeout, %d were closed", server.closedSessions.Load())
+	}
+	cursor.Exec(context.Background(), "SELECT 1")
+	if !errors.Is(cursor.Err, ErrIdleTimeout) {
+		t.Fatalf("Expected ErrIdleTimeout, got %v", cursor.Err)
+	}
+	if err := connection.Close(); err != nil || server.closedSessions.Load() != 1 {
+		t.Fatalf("Expected Close to do nothing, got %v", err)
+	}
+}
+
+func TestKeepAliveInterval(t *testing.T) {
+	server := &idleHiveServer{}
+	configuration := NewConnectConfiguration()
+	configuration.KeepAliveInterval = 20 * time.Millisecond
+	connection := connectFakeHiveServer(t, server, configuration)
+	deadline := time.Now().Add(5 * time.Second)
+	for server.infos.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if server.infos.Load() < 3 {
+		t.Fatalf("Expected keep-alives every 20ms, got %d", server.infos.Load())
+	}
+	if err := connection.Close(); err != nil || server.closedSessions.Load() != 1 {
+		t.Fatalf("Expected the session to be closed, got %v", err)
+	}
+}
+
+func TestReconnectWithKeepAlive(t *testing.T) {
+	// Run with -race: the keep-alives and the closing after IdleTimeout use the transport replaced by Reconnect
+	server := &idleHiveServer{}
+	configuration := NewConnectConfiguration()
+	configuration.KeepAliveInterval = time.Millisecond
+	configuration.IdleTimeout = 50 * time.Millisecond
+	connection := connectFakeHiveServer(t, server, configuration)
+	for i := 0; i < 10; i++ {
+		// The session may be closed after IdleTimeout meanwhile
+		connection.Reconnect(context.Background())
+		time.Sleep(5 * time.Millisecond)
+	}
+	connection.Close()
+}
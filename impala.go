@@ -0,0 +1,378 @@
+package gohive
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+// ErrNotImpala is returned by the Impala extensions when ImpalaExtensions isn't set or the server isn't Impala
+var ErrNotImpala = errors.New("gohive: the Impala extensions need ImpalaExtensions and an Impala server")
+
+// impalaExecStates are the names of the TExecState of Impala
+var impalaExecStates = []string{"REGISTERED", "PLANNING", "QUEUED", "RUNNING", "FINISHED", "CANCELLED", "FAILED"}
+
+// ImpalaExecSummary is the summary of the execution of a query by Impala, the one of the SUMMARY command of
+// impala-shell
+type ImpalaExecSummary struct {
+	// State of the query, for example RUNNING or FINISHED
+	State string
+	// Nodes of the plan in the order of the summary, each one followed by its children
+	Nodes []ImpalaPlanNodeSummary
+	// Errors and warnings of the query
+	ErrorLogs []string
+	// Scan ranges read so far and in total, the progress of the query
+	CompletedScanRanges int64
+	TotalScanRanges     int64
+	// Whether the query is waiting for admission, and why
+	Queued       bool
+	QueuedReason string
+}
+
+// ImpalaPlanNodeSummary is the summary of the execution of a node of the plan
+type ImpalaPlanNodeSummary struct {
+	NodeID        int32
+	FragmentIndex int32
+	// Label of the node, for example "00:SCAN HDFS", and its detail, for example the table scanned
+	Label       string
+	LabelDetail string
+	NumChildren int32
+	NumHosts    int32
+	Broadcast   bool
+	// Stats estimated by the planner, only Rows and Memory are set
+	Estimated ImpalaExecStats
+	// Stats of each instance of the node
+	Instances []ImpalaExecStats
+}
+
+// ImpalaExecStats are the stats of the execution of a node of the plan
+type ImpalaExecStats struct {
+	Latency time.Duration
+	CPUTime time.Duration
+	Rows    int64
+	Memory  int64
+}
+
+// RuntimeProfile returns the runtime profile of the last query executed as text, the one of the PROFILE command of
+// impala-shell. It can only be used against Impala with ImpalaExtensions set, otherwise ErrNotImpala is returned.
+func (c *Cursor) RuntimeProfile(ctx context.Context) (string, error) {
+	var profile string
+	err := c.callImpala(ctx, "GetRuntimeProfile", func(ctx context.Context, iprot thrift.TProtocol, id int16, fieldType thrift.TType) (bool, error) {
+		if id != 2 || fieldType != thrift.STRING {
+			return false, nil
+		}
+		var err error
+		profile, err = iprot.ReadString(ctx)
+		return true, err
+	})
+	return profile, err
+}
+
+// ExecSummary returns the summary of the execution of the last query executed, which can still be running. It can
+// only be used against Impala with ImpalaExtensions set, otherwise ErrNotImpala is returned.
+func (c *Cursor) ExecSummary(ctx context.Context) (*ImpalaExecSummary, error) {
+	var summary *ImpalaExecSummary
+	err := c.callImpala(ctx, "GetExecSummary", func(ctx context.Context, iprot thrift.TProtocol, id int16, fieldType thrift.TType) (bool, error) {
+		if id != 2 || fieldType != thrift.STRUCT {
+			return false, nil
+		}
+		summary = &ImpalaExecSummary{}
+		return true, readImpalaStruct(ctx, iprot, summary.readField)
+	})
+	if err == nil && summary == nil {
+		err = errors.New("The server didn't send the summary of the query")
+	}
+	return summary, err
+}
+
+// isImpala returns whether the extensions of Impala can be used, the name of the server is requested the first time
+func (c *Connection) isImpala(ctx context.Context) (bool, error) {
+	if !c.configuration.ImpalaExtensions {
+		return false, nil
+	}
+	c.impalaLock.Lock()
+	defer c.impalaLock.Unlock()
+	if c.impala == nil {
+		request := hiveserver.NewTGetInfoReq()
+		request.SessionHandle = c.sessionHandle
+		request.InfoType = hiveserver.TGetInfoType_CLI_DBMS_NAME
+		response, err := c.rpcClient().GetInfo(ctx, request)
+		if err != nil {
+			return false, err
+		}
+		if !success(safeStatus(response.GetStatus())) {
+			return false, errors.New("Error getting the name of the server: " + safeStatus(response.GetStatus()).String())
+		}
+		impala := strings.Contains(strings.ToLower(response.GetInfoValue().GetStringValue()), "impala")
+		c.impala = &impala
+	}
+	return *c.impala, nil
+}
+
+// callImpala calls a method of ImpalaHiveServer2Service for the operation of the cursor, readField reads the fields
+// of the response after its status
+func (c *Cursor) callImpala(ctx context.Context, method string, readField impalaFieldReader) error {
+	ctx, cancel := c.conn.withDefaultTimeout(ctx)
+	defer cancel()
+	impala, err := c.conn.isImpala(ctx)
+	if err != nil {
+		return err
+	}
+	if !impala {
+		return ErrNotImpala
+	}
+	if c.operationHandle == nil {
+		return errors.Errorf("%s can only be called after executing a query", method)
+	}
+	args := &impalaArgs{method: method, operationHandle: c.operationHandle, sessionHandle: c.conn.sessionHandle}
+	status := hiveserver.NewTStatus()
+	result := &impalaResult{read: func(ctx context.Context, iprot thrift.TProtocol) error {
+		return readImpalaStruct(ctx, iprot, func(ctx context.Context, iprot thrift.TProtocol, id int16, fieldType thrift.TType) (bool, error) {
+			if id == 1 && fieldType == thrift.STRUCT {
+				return true, status.Read(ctx, iprot)
+			}
+			return readField(ctx, iprot, id, fieldType)
+		})
+	}}
+	if _, err = c.conn.rpcClient().Client_().Call(ctx, method, args, result); err != nil {
+		return err
+	}
+	if !success(status) {
+		return errors.Errorf("Error in %s: %s", method, status.String())
+	}
+	return nil
+}
+
+// impalaArgs are the arguments of GetRuntimeProfile and GetExecSummary, whose requests share the handles as their
+// first fields. The profile is requested as text, the default.
+type impalaArgs struct {
+	method          string
+	operationHandle *hiveserver.TOperationHandle
+	sessionHandle   *hiveserver.TSessionHandle
+}
+
+func (p *impalaArgs) Write(ctx context.Context, oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin(ctx, p.method+"_args"); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldBegin(ctx, "req", thrift.STRUCT, 1); err != nil {
+		return err
+	}
+	if err := oprot.WriteStructBegin(ctx, "T"+p.method+"Req"); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldBegin(ctx, "operationHandle", thrift.STRUCT, 1); err != nil {
+		return err
+	}
+	if err := p.operationHandle.Write(ctx, oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldBegin(ctx, "sessionHandle", thrift.STRUCT, 2); err != nil {
+		return err
+	}
+	if err := p.sessionHandle.Write(ctx, oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(ctx); err != nil {
+		return err
+	}
+	if err := oprot.WriteStructEnd(ctx); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(ctx); err != nil {
+		return err
+	}
+	return oprot.WriteStructEnd(ctx)
+}
+
+// Read isn't needed as the arguments are only sent
+func (p *impalaArgs) Read(ctx context.Context, iprot thrift.TProtocol) error {
+	return errors.New("The arguments of the Impala extensions can't be read")
+}
+
+// impalaResult reads the response, the success field of the result
+type impalaResult struct {
+	read func(ctx context.Context, iprot thrift.TProtocol) error
+}
+
+func (p *impalaResult) Read(ctx context.Context, iprot thrift.TProtocol) error {
+	received := false
+	err := readImpalaStruct(ctx, iprot, func(ctx context.Context, iprot thrift.TProtocol, id int16, fieldType thrift.TType) (bool, error) {
+		if id != 0 || fieldType != thrift.STRUCT {
+			return false, nil
+		}
+		received = true
+		return true, p.read(ctx, iprot)
+	})
+	if err == nil && !received {
+		err = thrift.NewTApplicationException(thrift.MISSING_RESULT, "The Impala extension returned no result")
+	}
+	return err
+}
+
+// Write isn't needed as the results are only received
+func (p *impalaResult) Write(ctx context.Context, oprot thrift.TProtocol) error {
+	return errors.New("The results of the Impala extensions can't be written")
+}
+
+// impalaFieldReader reads a field of a struct, it returns false if it doesn't know the field, which is skipped
+type impalaFieldReader func(ctx context.Context, iprot thrift.TProtocol, id int16, fieldType thrift.TType) (bool, error)
+
+func readImpalaStruct(ctx context.Context, iprot thrift.TProtocol, readField impalaFieldReader) error {
+	if _, err := iprot.ReadStructBegin(ctx); err != nil {
+		return err
+	}
+	for {
+		_, fieldType, id, err := iprot.ReadFieldBegin(ctx)
+		if err != nil {
+			return err
+		}
+		if fieldType == thrift.STOP {
+			break
+		}
+		read, err := readField(ctx, iprot, id, fieldType)
+		if err != nil {
+			return err
+		}
+		if !read {
+			if err = iprot.Skip(ctx, fieldType); err != nil {
+				return err
+			}
+		}
+		if err = iprot.ReadFieldEnd(ctx); err != nil {
+			return err
+		}
+	}
+	return iprot.ReadStructEnd(ctx)
+}
+
+// readImpalaList reads a list, calling readElement for each element if they have the type expected
+func readImpalaList(ctx context.Context, iprot thrift.TProtocol, elementType thrift.TType, readElement func() error) error {
+	actualType, size, err := iprot.ReadListBegin(ctx)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < size; i++ {
+		if actualType != elementType {
+			err = iprot.Skip(ctx, actualType)
+		} else {
+			err = readElement()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return iprot.ReadListEnd(ctx)
+}
+
+// readField reads the fields of a TExecSummary
+func (s *ImpalaExecSummary) readField(ctx context.Context, iprot thrift.TProtocol, id int16, fieldType thrift.TType) (bool, error) {
+	switch {
+	case id == 1 && fieldType == thrift.I32:
+		state, err := iprot.ReadI32(ctx)
+		if state >= 0 && int(state) < len(impalaExecStates) {
+			s.State = impalaExecStates[state]
+		}
+		return true, err
+	case id == 3 && fieldType == thrift.LIST:
+		return true, readImpalaList(ctx, iprot, thrift.STRUCT, func() error {
+			var node ImpalaPlanNodeSummary
+			err := readImpalaStruct(ctx, iprot, node.readField)
+			s.Nodes = append(s.Nodes, node)
+			return err
+		})
+	case id == 5 && fieldType == thrift.LIST:
+		return true, readImpalaList(ctx, iprot, thrift.STRING, func() error {
+			log, err := iprot.ReadString(ctx)
+			s.ErrorLogs = append(s.ErrorLogs, log)
+			return err
+		})
+	case id == 6 && fieldType == thrift.STRUCT:
+		return true, readImpalaStruct(ctx, iprot, func(ctx context.Context, iprot thrift.TProtocol, id int16, fieldType thrift.TType) (bool, error) {
+			if fieldType != thrift.I64 || (id != 1 && id != 2) {
+				return false, nil
+			}
+			value, err := iprot.ReadI64(ctx)
+			if id == 1 {
+				s.TotalScanRanges = value
+			} else {
+				s.CompletedScanRanges = value
+			}
+			return true, err
+		})
+	case id == 7 && fieldType == thrift.BOOL:
+		var err error
+		s.Queued, err = iprot.ReadBool(ctx)
+		return true, err
+	case id == 8 && fieldType == thrift.STRING:
+		var err error
+		s.QueuedReason, err = iprot.ReadString(ctx)
+		return true, err
+	}
+	return false, nil
+}
+
+// readField reads the fields of a TPlanNodeExecSummary
+func (n *ImpalaPlanNodeSummary) readField(ctx context.Context, iprot thrift.TProtocol, id int16, fieldType thrift.TType) (bool, error) {
+	var err error
+	switch {
+	case id == 1 && fieldType == thrift.I32:
+		n.NodeID, err = iprot.ReadI32(ctx)
+	case id == 2 && fieldType == thrift.I32:
+		n.FragmentIndex, err = iprot.ReadI32(ctx)
+	case id == 3 && fieldType == thrift.STRING:
+		n.Label, err = iprot.ReadString(ctx)
+	case id == 4 && fieldType == thrift.STRING:
+		n.LabelDetail, err = iprot.ReadString(ctx)
+	case id == 5 && fieldType == thrift.I32:
+		n.NumChildren, err = iprot.ReadI32(ctx)
+	case id == 6 && fieldType == thrift.STRUCT:
+		err = readImpalaStruct(ctx, iprot, n.Estimated.readField)
+	case id == 7 && fieldType == thrift.LIST:
+		err = readImpalaList(ctx, iprot, thrift.STRUCT, func() error {
+			var stats ImpalaExecStats
+			err := readImpalaStruct(ctx, iprot, stats.readField)
+			n.Instances = append(n.Instances, stats)
+			return err
+		})
+	case id == 8 && fieldType == thrift.BOOL:
+		n.Broadcast, err = iprot.ReadBool(ctx)
+	case id == 9 && fieldType == thrift.I32:
+		n.NumHosts, err = iprot.ReadI32(ctx)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// readField reads the fields of a TExecStats
+func (s *ImpalaExecStats) readField(ctx context.Context, iprot thrift.TProtocol, id int16, fieldType thrift.TType) (bool, error) {
+	if fieldType != thrift.I64 || id < 1 || id > 4 {
+		return false, nil
+	}
+	value, err := iprot.ReadI64(ctx)
+	switch id {
+	case 1:
+		s.Latency = time.Duration(value)
+	case 2:
+		s.CPUTime = time.Duration(value)
+	case 3:
+		s.Rows = value
+	case 4:
+		s.Memory = value
+	}
+	return true, err
+}
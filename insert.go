@@ -0,0 +1,74 @@
+package gohive
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// InsertRows inserts the rows in table with INSERT INTO ... VALUES statements, with the values written as literals
+// like ExecNamed does. table is used as written, so it can have the database, and columns are the names of the
+// columns of the values in order, or empty for all the columns of the table. With MaxStatementBytes set the rows
+// are split in as few statements under it as possible, otherwise they are inserted with a single statement.
+//
+// It returns the number of rows inserted, those of the statements that succeeded before an error.
+func (c *Cursor) InsertRows(ctx context.Context, table string, columns []string, rows [][]interface{}) (int, error) {
+	prefix := "INSERT INTO " + table
+	if len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			quoted[i] = QuoteIdentifier(column)
+		}
+		prefix += " (" + strings.Join(quoted, ", ") + ")"
+	}
+	prefix += " VALUES "
+	limit := c.conn.configuration.MaxStatementBytes
+
+	inserted := 0
+	var statement strings.Builder
+	batch := 0
+	flush := func() error {
+		if batch == 0 {
+			return nil
+		}
+		c.Exec(ctx, statement.String())
+		if c.Err != nil {
+			return c.Err
+		}
+		inserted += batch
+		batch = 0
+		statement.Reset()
+		return nil
+	}
+	for i, row := range rows {
+		if len(columns) > 0 && len(row) != len(columns) {
+			return inserted, errors.Errorf("Row %d has %d values but %d columns were given", i, len(row), len(columns))
+		}
+		values := make([]string, len(row))
+		for j, value := range row {
+			literal, err := formatLiteral(value)
+			if err != nil {
+				return inserted, errors.Wrapf(err, "Row %d", i)
+			}
+			values[j] = literal
+		}
+		tuple := "(" + strings.Join(values, ", ") + ")"
+		if limit > 0 && len(prefix)+len(tuple) > limit {
+			return inserted, errors.Wrapf(ErrStatementTooLong, "Row %d alone needs a statement of %d bytes, more than MaxStatementBytes (%d)", i, len(prefix)+len(tuple), limit)
+		}
+		if limit > 0 && batch > 0 && statement.Len()+len(", ")+len(tuple) > limit {
+			if err := flush(); err != nil {
+				return inserted, err
+			}
+		}
+		if batch == 0 {
+			statement.WriteString(prefix)
+		} else {
+			statement.WriteString(", ")
+		}
+		statement.WriteString(tuple)
+		batch++
+	}
+	return inserted, flush()
+}
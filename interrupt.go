@@ -0,0 +1,27 @@
+package gohive
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// CancelOnInterrupt returns a copy of ctx that is canceled when the process receives an interrupt, like Ctrl-C,
+// or SIGTERM. A query run with it is then canceled in the server and the cursor error is set. Only the first
+// signal is caught, a second one has its default behavior and ends the process if the cancellation hangs.
+// The returned function releases the signals and must be called once the context isn't needed.
+func CancelOnInterrupt(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+		cancel()
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,134 @@
+package gohive
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+// JSONLOptions configures how WriteJSONL writes the rows
+type JSONLOptions struct {
+	// Write BIGINT values as JSON strings, as JavaScript numbers lose precision beyond 2^53
+	BigIntAsString bool
+	// Write DECIMAL values as JSON strings instead of numbers, for the same reason
+	DecimalAsString bool
+}
+
+// WriteJSONL fetches all the remaining rows of the cursor and writes them to w as JSON lines, one object per row
+// with the columns in the order of the result set. NULL is written as null, BINARY as base64, NaN and infinite
+// DOUBLE values as strings, and DECIMAL as a number unless DecimalAsString is set. DATE, TIMESTAMP and the
+// complex types are written as the string returned by the server.
+func (c *Cursor) WriteJSONL(ctx context.Context, w io.Writer, opts *JSONLOptions) error {
+	if opts == nil {
+		opts = &JSONLOptions{}
+	}
+	schema := c.schema(ctx)
+	if c.Err != nil {
+		return c.Err
+	}
+	if schema == nil {
+		return errors.New("The result set doesn't have a schema")
+	}
+	names := make([][]byte, len(schema))
+	types := make([]hiveserver.TTypeId, len(schema))
+	for i, desc := range schema {
+		name, err := json.Marshal(desc.ColumnName)
+		if err != nil {
+			return err
+		}
+		names[i] = name
+		types[i] = hiveserver.TTypeId_STRING_TYPE
+		if entry := primitiveEntry(desc); entry != nil {
+			types[i] = entry.Type
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	var line []byte
+	for c.HasMore(ctx) {
+		if c.Err != nil {
+			return c.Err
+		}
+		if len(c.queue) != len(schema) {
+			return errors.Errorf("%d columns were received but the schema has %d", len(c.queue), len(schema))
+		}
+		for c.columnIndex < c.totalRows {
+			var err error
+			line, err = appendJSONLRow(line[:0], names, types, c.queue, c.columnIndex, opts)
+			if err != nil {
+				return err
+			}
+			if _, err = bw.Write(line); err != nil {
+				return err
+			}
+			c.consumeRows(c.columnIndex + 1)
+		}
+	}
+	if c.Err != nil {
+		return c.Err
+	}
+	return bw.Flush()
+}
+
+// appendJSONLRow appends the row of the columns as a JSON object followed by a new line
+func appendJSONLRow(b []byte, names [][]byte, types []hiveserver.TTypeId, columns []*hiveserver.TColumn, row int, opts *JSONLOptions) ([]byte, error) {
+	b = append(b, '{')
+	for i, column := range columns {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, names[i]...)
+		b = append(b, ':')
+		var err error
+		b, err = appendJSONValue(b, types[i], columnValue(column, row), opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "column %s", names[i])
+		}
+	}
+	return append(b, '}', '\n'), nil
+}
+
+func appendJSONValue(b []byte, typeId hiveserver.TTypeId, value interface{}, opts *JSONLOptions) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case bool:
+		return strconv.AppendBool(b, v), nil
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int64:
+		if opts.BigIntAsString {
+			b = append(b, '"')
+			b = strconv.AppendInt(b, v, 10)
+			return append(b, '"'), nil
+		}
+		return strconv.AppendInt(b, v, 10), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.AppendQuote(b, strconv.FormatFloat(v, 'g', -1, 64)), nil
+		}
+		return strconv.AppendFloat(b, v, 'g', -1, 64), nil
+	case string:
+		if typeId == hiveserver.TTypeId_DECIMAL_TYPE && !opts.DecimalAsString {
+			if !json.Valid([]byte(v)) {
+				return nil, errors.Errorf("Invalid decimal %q", v)
+			}
+			return append(b, v...), nil
+		}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, encoded...), nil
+}
@@ -0,0 +1,69 @@
+package gohive
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestAppendJSONLRow(t *testing.T) {
+	names := [][]byte{[]byte(`"id"`), []byte(`"amount"`), []byte(`"ratio"`), []byte(`"name"`), []byte(`"data"`)}
+	types := []hiveserver.TTypeId{
+		hiveserver.TTypeId_BIGINT_TYPE,
+		hiveserver.TTypeId_DECIMAL_TYPE,
+		hiveserver.TTypeId_DOUBLE_TYPE,
+		hiveserver.TTypeId_STRING_TYPE,
+		hiveserver.TTypeId_BINARY_TYPE,
+	}
+	columns := []*hiveserver.TColumn{
+		{I64Val: &hiveserver.TI64Column{Values: []int64{9007199254740993, 0}, Nulls: []byte{2}}},
+		{StringVal: &hiveserver.TStringColumn{Values: []string{"12345678901234567890.12", ""}, Nulls: []byte{2}}},
+		{DoubleVal: &hiveserver.TDoubleColumn{Values: []float64{0.5, math.NaN()}, Nulls: []byte{}}},
+		{StringVal: &hiveserver.TStringColumn{Values: []string{"a\"b", "c"}, Nulls: []byte{}}},
+		{BinaryVal: &hiveserver.TBinaryColumn{Values: [][]byte{[]byte("hi"), nil}, Nulls: []byte{2}}},
+	}
+	tests := []struct {
+		opts     JSONLOptions
+		row      int
+		expected string
+	}{
+		{JSONLOptions{}, 0, `{"id":9007199254740993,"amount":12345678901234567890.12,"ratio":0.5,"name":"a\"b","data":"aGk="}` + "\n"},
+		{JSONLOptions{BigIntAsString: true, DecimalAsString: true}, 0, `{"id":"9007199254740993","amount":"12345678901234567890.12","ratio":0.5,"name":"a\"b","data":"aGk="}` + "\n"},
+		{JSONLOptions{BigIntAsString: true}, 1, `{"id":null,"amount":null,"ratio":"NaN","name":"c","data":null}` + "\n"},
+	}
+	for _, test := range tests {
+		line, err := appendJSONLRow(nil, names, types, columns, test.row, &test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(line) != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, line)
+		}
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.FetchSize = 2
+	connection := connectFakeHiveServer(t, &operationHiveServer{rows: 3}, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "SELECT n FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	var buffer bytes.Buffer
+	if err := cursor.WriteJSONL(context.Background(), &buffer, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{\"t.n\":0}\n{\"t.n\":1}\n{\"t.n\":2}\n"; buffer.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, buffer.String())
+	}
+	if cursor.RowsFetched() != 3 {
+		t.Fatalf("Expected 3 rows fetched, got %d", cursor.RowsFetched())
+	}
+}
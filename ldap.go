@@ -0,0 +1,44 @@
+package gohive
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ldapBindUser returns the username sent with the LDAP auth, formatted with LDAPUserPattern or LDAPDomain
+func ldapBindUser(configuration *ConnectConfiguration) (string, error) {
+	username := configuration.transportUsername()
+	if configuration.LDAPUserPattern != "" && configuration.LDAPDomain != "" {
+		return "", errors.New("Only one of LDAPUserPattern and LDAPDomain can be set")
+	}
+	if configuration.LDAPUserPattern != "" {
+		if strings.Count(configuration.LDAPUserPattern, "%s") != 1 {
+			return "", errors.Errorf("LDAPUserPattern %q should have %%s once, where the username goes", configuration.LDAPUserPattern)
+		}
+		return strings.Replace(configuration.LDAPUserPattern, "%s", escapeDNValue(username), 1), nil
+	}
+	if configuration.LDAPDomain != "" && !strings.Contains(username, "@") {
+		return username + "@" + strings.TrimPrefix(configuration.LDAPDomain, "@"), nil
+	}
+	return username, nil
+}
+
+// escapeDNValue escapes the characters of an attribute value of a distinguished name as RFC 4514 requires
+func escapeDNValue(value string) string {
+	var b strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			r == '#' && i == 0,
+			r == ' ' && (i == 0 || i == len(value)-1):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package gohive
+
+import (
+	"testing"
+)
+
+func TestLDAPBindUser(t *testing.T) {
+	tests := []struct {
+		username string
+		pattern  string
+		domain   string
+		expected string
+	}{
+		{"alice", "", "", "alice"},
+		{"alice", "uid=%s,ou=people,dc=example,dc=com", "", "uid=alice,ou=people,dc=example,dc=com"},
+		{"smith, john", "cn=%s,dc=example,dc=com", "", `cn=smith\, john,dc=example,dc=com`},
+		{" #a=b ", "cn=%s", "", `cn=\ #a\=b\ `},
+		{"#a", "cn=%s", "", `cn=\#a`},
+		{"alice", "", "example.com", "alice@example.com"},
+		{"alice", "", "@example.com", "alice@example.com"},
+		{"alice@corp.example.com", "", "example.com", "alice@corp.example.com"},
+	}
+	for _, test := range tests {
+		configuration := NewConnectConfiguration()
+		configuration.Username = test.username
+		configuration.LDAPUserPattern = test.pattern
+		configuration.LDAPDomain = test.domain
+		username, err := ldapBindUser(configuration)
+		if err != nil || username != test.expected {
+			t.Fatalf("Expected %q for %q, got %q (%v)", test.expected, test.username, username, err)
+		}
+	}
+
+	configuration := NewConnectConfiguration()
+	configuration.LDAPUserPattern = "uid=%s,ou=%s"
+	if _, err := ldapBindUser(configuration); err == nil {
+		t.Fatal("Expected an error for a pattern with two placeholders")
+	}
+	configuration.LDAPUserPattern = "uid=%s"
+	configuration.LDAPDomain = "example.com"
+	if _, err := ldapBindUser(configuration); err == nil {
+		t.Fatal("Expected an error with both the pattern and the domain")
+	}
+}
@@ -1,11 +1,16 @@
 package gohive
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/go-data-exporter/gohive/hive_metastore"
+	"net/url"
 	"os/user"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type HiveMetastoreClient struct {
@@ -19,8 +24,17 @@ type MetastoreConnectConfiguration struct {
 	TransportMode string
 	Username      string
 	Password      string
+	// Number of times the metastores are tried again after all of them failed to connect. Zero makes a single attempt.
+	Retries int
+	// Wait before the first retry, doubled before every next one
+	RetryBackoff time.Duration
+	// Maximum wait before a retry, the backoff stops doubling when it reaches it. DEFAULT_MAX_RETRY_BACKOFF if zero.
+	MaxRetryBackoff time.Duration
 }
 
+// DEFAULT_MAX_RETRY_BACKOFF is the maximum wait between the connection retries when MaxRetryBackoff isn't set
+const DEFAULT_MAX_RETRY_BACKOFF = time.Minute
+
 func NewMetastoreConnectConfiguration() *MetastoreConnectConfiguration {
 	return &MetastoreConnectConfiguration{
 		TransportMode: "binary",
@@ -29,8 +43,92 @@ func NewMetastoreConnectConfiguration() *MetastoreConnectConfiguration {
 	}
 }
 
+type metastoreAddress struct {
+	host string
+	port int
+}
+
 // Open connection to the metastore.
 func ConnectToMetastore(host string, port int, auth string, configuration *MetastoreConnectConfiguration) (client *HiveMetastoreClient, err error) {
+	return connectToMetastores(context.Background(), []metastoreAddress{{host, port}}, auth, configuration)
+}
+
+// ConnectToMetastoreURIs connects to the first available metastore of a comma separated list like the one of
+// hive.metastore.uris, for example "thrift://hm1.example.com:9083,thrift://hm2.example.com:9083", trying them
+// in order. The last error is returned if none of them connects after the retries.
+func ConnectToMetastoreURIs(uris string, auth string, configuration *MetastoreConnectConfiguration) (*HiveMetastoreClient, error) {
+	return ConnectToMetastoreURIsContext(context.Background(), uris, auth, configuration)
+}
+
+// ConnectToMetastoreURIsContext is ConnectToMetastoreURIs stopping to wait for the next retry when ctx is done, in which
+// case the error wraps both the error of the context and the last error of the metastores.
+func ConnectToMetastoreURIsContext(ctx context.Context, uris string, auth string, configuration *MetastoreConnectConfiguration) (*HiveMetastoreClient, error) {
+	addresses, err := parseMetastoreURIs(uris)
+	if err != nil {
+		return nil, err
+	}
+	return connectToMetastores(ctx, addresses, auth, configuration)
+}
+
+func parseMetastoreURIs(uris string) ([]metastoreAddress, error) {
+	var addresses []metastoreAddress
+	for _, uri := range strings.Split(uris, ",") {
+		uri = strings.TrimSpace(uri)
+		if uri == "" {
+			continue
+		}
+		if !strings.Contains(uri, "://") {
+			uri = "thrift://" + uri
+		}
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metastore uri %q: %w", uri, err)
+		}
+		port, err := strconv.Atoi(parsed.Port())
+		if parsed.Scheme != "thrift" || parsed.Hostname() == "" || err != nil {
+			return nil, fmt.Errorf("invalid metastore uri %q, expected thrift://host:port", uri)
+		}
+		addresses = append(addresses, metastoreAddress{parsed.Hostname(), port})
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("no metastore uri was given")
+	}
+	return addresses, nil
+}
+
+// connectToMetastores tries the addresses in order, again after the backoff while there are retries left and ctx
+// isn't done
+func connectToMetastores(ctx context.Context, addresses []metastoreAddress, auth string, configuration *MetastoreConnectConfiguration) (*HiveMetastoreClient, error) {
+	backoff := configuration.RetryBackoff
+	maxBackoff := configuration.MaxRetryBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DEFAULT_MAX_RETRY_BACKOFF
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		for _, address := range addresses {
+			var client *HiveMetastoreClient
+			client, err = connectToMetastore(address.host, address.port, auth, configuration)
+			if err == nil {
+				return client, nil
+			}
+			err = fmt.Errorf("error connecting to the metastore %s:%d: %w", address.host, address.port, err)
+		}
+		if attempt >= configuration.Retries {
+			return nil, err
+		}
+		timer := time.NewTimer(min(backoff, maxBackoff))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w while waiting to retry after: %w", ctx.Err(), err)
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func connectToMetastore(host string, port int, auth string, configuration *MetastoreConnectConfiguration) (client *HiveMetastoreClient, err error) {
 	addr := fmt.Sprintf("%s:%d", host, port)
 	socket, err := thrift.NewTSocket(addr)
 	if err != nil {
@@ -40,6 +138,11 @@ func ConnectToMetastore(host string, port int, auth string, configuration *Metas
 	if err = socket.Open(); err != nil {
 		return
 	}
+	defer func() {
+		if err != nil {
+			socket.Close()
+		}
+	}()
 
 	var transport thrift.TTransport
 
@@ -99,3 +202,93 @@ func ConnectToMetastore(host string, port int, auth string, configuration *Metas
 func (c *HiveMetastoreClient) Close() {
 	c.transport.Close()
 }
+
+// TableExists returns whether the table exists in the database
+func (c *HiveMetastoreClient) TableExists(ctx context.Context, db string, table string) (bool, error) {
+	_, err := c.Client.GetTable(ctx, db, table)
+	if err != nil {
+		var notFound *hive_metastore.NoSuchObjectException
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateTableIfNotExists creates the table, it doesn't fail if a table with the same name already exists
+func (c *HiveMetastoreClient) CreateTableIfNotExists(ctx context.Context, table *hive_metastore.Table) error {
+	err := c.Client.CreateTable(ctx, table)
+	var alreadyExists *hive_metastore.AlreadyExistsException
+	if errors.As(err, &alreadyExists) {
+		return nil
+	}
+	return err
+}
+
+// CreateTablesIfNotExist creates the tables in order with CreateTableIfNotExists, stopping at the first error
+func (c *HiveMetastoreClient) CreateTablesIfNotExist(ctx context.Context, tables []*hive_metastore.Table) error {
+	for _, table := range tables {
+		if err := c.CreateTableIfNotExists(ctx, table); err != nil {
+			return fmt.Errorf("error creating table %s.%s: %w", table.DbName, table.TableName, err)
+		}
+	}
+	return nil
+}
+
+// TableStats are the basic statistics and the storage of a table, as recorded in the metastore.
+// Statistics that weren't computed are -1.
+type TableStats struct {
+	NumRows     int64
+	TotalSize   int64
+	NumFiles    int64
+	RawDataSize int64
+	// Storage of the table, InputFormat, OutputFormat, SerializationLib and Location are copied from it
+	StorageDescriptor *hive_metastore.StorageDescriptor
+	InputFormat       string
+	OutputFormat      string
+	SerializationLib  string
+	Location          string
+}
+
+// GetTableStats returns the statistics kept in the parameters of the table and its storage descriptor
+func (c *HiveMetastoreClient) GetTableStats(ctx context.Context, db string, table string) (*TableStats, error) {
+	t, err := c.Client.GetTable(ctx, db, table)
+	if err != nil {
+		return nil, err
+	}
+	return tableStats(t)
+}
+
+func tableStats(table *hive_metastore.Table) (*TableStats, error) {
+	stats := &TableStats{StorageDescriptor: table.Sd}
+	for _, stat := range []struct {
+		name  string
+		value *int64
+	}{
+		{"numRows", &stats.NumRows},
+		{"totalSize", &stats.TotalSize},
+		{"numFiles", &stats.NumFiles},
+		{"rawDataSize", &stats.RawDataSize},
+	} {
+		*stat.value = -1
+		value, ok := table.Parameters[stat.name]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q of table %s.%s: %w", stat.name, value, table.DbName, table.TableName, err)
+		}
+		*stat.value = n
+	}
+	if sd := table.Sd; sd != nil {
+		stats.InputFormat = sd.InputFormat
+		stats.OutputFormat = sd.OutputFormat
+		stats.Location = sd.Location
+		if sd.SerdeInfo != nil {
+			stats.SerializationLib = sd.SerdeInfo.SerializationLib
+		}
+	}
+	return stats, nil
+}
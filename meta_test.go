@@ -2,12 +2,16 @@ package gohive
 
 import (
 	"context"
+	"errors"
 	"github.com/go-data-exporter/gohive/hive_metastore"
 	"log"
 	"os"
 	"fmt"
 	"testing"
 	"math/rand"
+	"net"
+	"strings"
+	"time"
 )
 
 var lettersDb = []rune("abcdefghijklmnopqrstuvwxyz")
@@ -107,6 +111,64 @@ func TestDatabaseOperations(t *testing.T) {
 	connection.Close()
 }
 
+func TestTableOperations(t *testing.T) {
+	if os.Getenv("METASTORE_SKIP") == "1" {
+		t.Skip("metastore not set.")
+	}
+	configuration := NewMetastoreConnectConfiguration()
+	configuration.TransportMode = getTransportForMeta()
+	connection, err := ConnectToMetastore("hm.example.com", 9083, getAuthForMeta(), configuration)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer connection.Close()
+
+	name := GetDatabaseName()
+	database := hive_metastore.Database{
+		Name:        name,
+		LocationUri: "/"}
+	err = connection.Client.CreateDatabase(context.Background(), &database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer connection.Client.DropDatabase(context.Background(), name, true, true)
+
+	exists, err := connection.TableExists(context.Background(), name, "pokes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("Table shouldn't exist yet")
+	}
+
+	table := &hive_metastore.Table{
+		DbName:    name,
+		TableName: "pokes",
+		Sd: &hive_metastore.StorageDescriptor{
+			Cols: []*hive_metastore.FieldSchema{{Name: "a", Type: "int"}},
+			SerdeInfo: &hive_metastore.SerDeInfo{
+				SerializationLib: "org.apache.hadoop.hive.serde2.lazy.LazySimpleSerDe",
+			},
+			InputFormat:  "org.apache.hadoop.mapred.TextInputFormat",
+			OutputFormat: "org.apache.hadoop.hive.ql.io.HiveIgnoreKeyTextOutputFormat",
+		},
+	}
+	for i := 0; i < 2; i++ {
+		err = connection.CreateTablesIfNotExist(context.Background(), []*hive_metastore.Table{table})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exists, err = connection.TableExists(context.Background(), name, "pokes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("Table should exist")
+	}
+}
+
 func getAuthForMeta() string {
 	auth := os.Getenv("AUTH")
 	os.Setenv("KRB5CCNAME", "/tmp/krb5_gohive")
@@ -123,3 +185,118 @@ func getTransportForMeta() string {
 	}
 	return transport
 }
+
+func TestTableStats(t *testing.T) {
+	table := &hive_metastore.Table{
+		DbName:     "db",
+		TableName:  "t",
+		Parameters: map[string]string{"numRows": "10", "totalSize": "2048", "numFiles": "2"},
+		Sd: &hive_metastore.StorageDescriptor{
+			Location:     "hdfs://nn/warehouse/db.db/t",
+			InputFormat:  "org.apache.hadoop.hive.ql.io.orc.OrcInputFormat",
+			OutputFormat: "org.apache.hadoop.hive.ql.io.orc.OrcOutputFormat",
+			SerdeInfo:    &hive_metastore.SerDeInfo{SerializationLib: "org.apache.hadoop.hive.ql.io.orc.OrcSerde"},
+		},
+	}
+	stats, err := tableStats(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NumRows != 10 || stats.TotalSize != 2048 || stats.NumFiles != 2 || stats.RawDataSize != -1 {
+		t.Fatalf("Unexpected statistics %+v", stats)
+	}
+	if stats.SerializationLib != "org.apache.hadoop.hive.ql.io.orc.OrcSerde" || stats.Location != table.Sd.Location || stats.StorageDescriptor != table.Sd {
+		t.Fatalf("Unexpected storage %+v", stats)
+	}
+	table.Parameters["numRows"] = "x"
+	if _, err := tableStats(table); err == nil {
+		t.Fatal("Expected an error for an invalid numRows")
+	}
+}
+
+func TestParseMetastoreURIs(t *testing.T) {
+	addresses, err := parseMetastoreURIs("thrift://hm1.example.com:9083, hm2.example.com:9084")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []metastoreAddress{{"hm1.example.com", 9083}, {"hm2.example.com", 9084}}
+	if len(addresses) != 2 || addresses[0] != expected[0] || addresses[1] != expected[1] {
+		t.Fatalf("Expected %v, got %v", expected, addresses)
+	}
+	for _, uris := range []string{"", "thrift://hm1.example.com", "http://hm1.example.com:9083"} {
+		if _, err := parseMetastoreURIs(uris); err == nil {
+			t.Fatalf("Expected an error for %q", uris)
+		}
+	}
+}
+
+func TestConnectToMetastoreURIsFailover(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downAddress := down.Addr().String()
+	down.Close()
+
+	configuration := NewMetastoreConnectConfiguration()
+	client, err := ConnectToMetastoreURIs("thrift://"+downAddress+",thrift://"+listener.Addr().String(), "NOSASL", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.port != listener.Addr().(*net.TCPAddr).Port {
+		t.Fatalf("Expected to connect to the second metastore, got port %d", client.port)
+	}
+	client.Close()
+
+	configuration.Retries = 2
+	configuration.RetryBackoff = 20 * time.Millisecond
+	start := time.Now()
+	_, err = ConnectToMetastoreURIs(downAddress, "NOSASL", configuration)
+	if err == nil || !strings.Contains(err.Error(), downAddress) {
+		t.Fatalf("Expected the error of the last metastore, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Fatalf("Expected two retries waiting 20ms and 40ms, returned after %v", elapsed)
+	}
+}
+
+func TestConnectToMetastoreURIsBackoff(t *testing.T) {
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downAddress := down.Addr().String()
+	down.Close()
+
+	// The waits are capped at MaxRetryBackoff, 100ms, 100ms and 100ms instead of 100ms, 200ms and 400ms
+	configuration := NewMetastoreConnectConfiguration()
+	configuration.Retries = 3
+	configuration.RetryBackoff = 100 * time.Millisecond
+	configuration.MaxRetryBackoff = 100 * time.Millisecond
+	start := time.Now()
+	if _, err := ConnectToMetastoreURIs(downAddress, "NOSASL", configuration); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 600*time.Millisecond {
+		t.Fatalf("Expected three retries waiting 100ms, returned after %v", elapsed)
+	}
+
+	// The context stops the wait for the next retry
+	configuration.RetryBackoff = time.Minute
+	configuration.MaxRetryBackoff = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = ConnectToMetastoreURIsContext(ctx, downAddress, "NOSASL", configuration)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), downAddress) {
+		t.Fatalf("Expected the error of the context and of the metastore, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("The retries waited %v after the context was done", elapsed)
+	}
+}
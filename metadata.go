@@ -0,0 +1,348 @@
+package gohive
+
+import (
+	"context"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+// GetSchemas lists the schemas matching the pattern, all of them if it's empty.
+// The result is read from the cursor like the result of any other query.
+func (c *Cursor) GetSchemas(ctx context.Context, schemaPattern string) {
+	c.runMetadataOperation(ctx, func() (*hiveserver.TOperationHandle, *hiveserver.TStatus, error) {
+		request := hiveserver.NewTGetSchemasReq()
+		request.SessionHandle = c.conn.sessionHandle
+		request.CatalogName = c.conn.catalogIdentifier()
+		request.SchemaName = patternOrNil(schemaPattern)
+		response, err := c.conn.rpcClient().GetSchemas(ctx, request)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.OperationHandle, response.Status, nil
+	})
+}
+
+// GetTables lists the tables matching the patterns and table types, empty values match everything.
+// The result is read from the cursor like the result of any other query.
+func (c *Cursor) GetTables(ctx context.Context, schemaPattern string, tablePattern string, tableTypes []string) {
+	c.runMetadataOperation(ctx, func() (*hiveserver.TOperationHandle, *hiveserver.TStatus, error) {
+		request := hiveserver.NewTGetTablesReq()
+		request.SessionHandle = c.conn.sessionHandle
+		if catalog := c.conn.catalogIdentifier(); catalog != nil {
+			request.CatalogName = hiveserver.TPatternOrIdentifierPtr(hiveserver.TPatternOrIdentifier(*catalog))
+		}
+		request.SchemaName = patternOrNil(schemaPattern)
+		request.TableName = patternOrNil(tablePattern)
+		request.TableTypes = tableTypes
+		response, err := c.conn.rpcClient().GetTables(ctx, request)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.OperationHandle, response.Status, nil
+	})
+}
+
+// GetColumns lists the columns matching the patterns, empty values match everything.
+// The result is read from the cursor like the result of any other query.
+func (c *Cursor) GetColumns(ctx context.Context, schemaPattern string, tablePattern string, columnPattern string) {
+	c.runMetadataOperation(ctx, func() (*hiveserver.TOperationHandle, *hiveserver.TStatus, error) {
+		request := hiveserver.NewTGetColumnsReq()
+		request.SessionHandle = c.conn.sessionHandle
+		request.CatalogName = c.conn.catalogIdentifier()
+		request.SchemaName = patternOrNil(schemaPattern)
+		request.TableName = patternOrNil(tablePattern)
+		request.ColumnName = patternOrNil(columnPattern)
+		response, err := c.conn.rpcClient().GetColumns(ctx, request)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.OperationHandle, response.Status, nil
+	})
+}
+
+// runMetadataOperation runs a metadata RPC and leaves the cursor ready for fetching its result
+func (c *Cursor) runMetadataOperation(ctx context.Context, rpc func() (*hiveserver.TOperationHandle, *hiveserver.TStatus, error)) {
+	c.resetState()
+	c.state = _RUNNING
+
+	operationHandle, status, err := rpc()
+	if err != nil {
+		c.Err = c.conn.nameError(err)
+		return
+	}
+	if !success(safeStatus(status)) {
+		status = safeStatus(status)
+		c.Err = HiveError{
+			error:      errors.New("Error while running metadata operation: " + status.String()),
+			Message:    status.GetErrorMessage(),
+			ErrorCode:  int(status.GetErrorCode()),
+			Connection: c.conn.configuration.Name,
+		}
+		return
+	}
+	c.operationHandle = operationHandle
+
+	c.WaitForCompletion(ctx)
+	if c.Err != nil {
+		return
+	}
+	c.state = _ASYNC_ENDED
+}
+
+func (c *Connection) catalogIdentifier() *hiveserver.TIdentifier {
+	if c.configuration.Catalog == "" {
+		return nil
+	}
+	return hiveserver.TIdentifierPtr(hiveserver.TIdentifier(c.configuration.Catalog))
+}
+
+func patternOrNil(pattern string) *hiveserver.TPatternOrIdentifier {
+	if pattern == "" {
+		return nil
+	}
+	return hiveserver.TPatternOrIdentifierPtr(hiveserver.TPatternOrIdentifier(pattern))
+}
+
+// PrimaryKey is a column of the primary key of a table
+type PrimaryKey struct {
+	Catalog string
+	Schema  string
+	Table   string
+	Column  string
+	// Position of the column in the key, starting at 1
+	KeySeq int
+	Name   string
+}
+
+// ForeignKey is a column of a foreign key and the column of the primary key it references
+type ForeignKey struct {
+	ParentCatalog  string
+	ParentSchema   string
+	ParentTable    string
+	ParentColumn   string
+	ForeignCatalog string
+	ForeignSchema  string
+	ForeignTable   string
+	ForeignColumn  string
+	// Position of the column in the key, starting at 1
+	KeySeq        int
+	UpdateRule    int
+	DeleteRule    int
+	Name          string
+	ParentKeyName string
+	Deferrability int
+}
+
+// GetPrimaryKeys returns the columns of the primary key of the table, ordered by their position in the key.
+// Constraints are only known to Hive 2.1 and later, empty values aren't used for filtering.
+func (c *Connection) GetPrimaryKeys(ctx context.Context, schema string, table string) ([]PrimaryKey, error) {
+	cursor := c.Cursor()
+	defer cursor.Close()
+	cursor.runMetadataOperation(ctx, func() (*hiveserver.TOperationHandle, *hiveserver.TStatus, error) {
+		request := hiveserver.NewTGetPrimaryKeysReq()
+		request.SessionHandle = c.sessionHandle
+		request.CatalogName = c.catalogIdentifier()
+		request.SchemaName = identifierOrNil(schema)
+		request.TableName = identifierOrNil(table)
+		response, err := c.rpcClient().GetPrimaryKeys(ctx, request)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.OperationHandle, response.Status, nil
+	})
+	if cursor.Err != nil {
+		return nil, cursor.Err
+	}
+
+	var keys []PrimaryKey
+	for cursor.HasMore(ctx) {
+		row := cursor.RowSlice(ctx)
+		if cursor.Err != nil {
+			return nil, cursor.Err
+		}
+		if len(row) < 6 {
+			return nil, errors.Errorf("Expected 6 columns of primary keys, got %d", len(row))
+		}
+		keys = append(keys, PrimaryKey{
+			Catalog: metadataString(row[0]),
+			Schema:  metadataString(row[1]),
+			Table:   metadataString(row[2]),
+			Column:  metadataString(row[3]),
+			KeySeq:  metadataInt(row[4]),
+			Name:    metadataString(row[5]),
+		})
+	}
+	if cursor.Err != nil {
+		return nil, cursor.Err
+	}
+	return keys, nil
+}
+
+// GetCrossReference returns the columns of the foreign keys of the foreign table referencing the primary key of the
+// parent table. Either table can be left empty to get all the foreign keys referencing the parent table or all the
+// foreign keys of the foreign table.
+func (c *Connection) GetCrossReference(ctx context.Context, parentSchema string, parentTable string, foreignSchema string, foreignTable string) ([]ForeignKey, error) {
+	cursor := c.Cursor()
+	defer cursor.Close()
+	cursor.runMetadataOperation(ctx, func() (*hiveserver.TOperationHandle, *hiveserver.TStatus, error) {
+		request := hiveserver.NewTGetCrossReferenceReq()
+		request.SessionHandle = c.sessionHandle
+		request.ParentCatalogName = c.catalogIdentifier()
+		request.ParentSchemaName = identifierOrNil(parentSchema)
+		request.ParentTableName = identifierOrNil(parentTable)
+		request.ForeignCatalogName = c.catalogIdentifier()
+		request.ForeignSchemaName = identifierOrNil(foreignSchema)
+		request.ForeignTableName = identifierOrNil(foreignTable)
+		response, err := c.rpcClient().GetCrossReference(ctx, request)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.OperationHandle, response.Status, nil
+	})
+	if cursor.Err != nil {
+		return nil, cursor.Err
+	}
+
+	var keys []ForeignKey
+	for cursor.HasMore(ctx) {
+		row := cursor.RowSlice(ctx)
+		if cursor.Err != nil {
+			return nil, cursor.Err
+		}
+		if len(row) < 14 {
+			return nil, errors.Errorf("Expected 14 columns of foreign keys, got %d", len(row))
+		}
+		keys = append(keys, ForeignKey{
+			ParentCatalog:  metadataString(row[0]),
+			ParentSchema:   metadataString(row[1]),
+			ParentTable:    metadataString(row[2]),
+			ParentColumn:   metadataString(row[3]),
+			ForeignCatalog: metadataString(row[4]),
+			ForeignSchema:  metadataString(row[5]),
+			ForeignTable:   metadataString(row[6]),
+			ForeignColumn:  metadataString(row[7]),
+			KeySeq:         metadataInt(row[8]),
+			UpdateRule:     metadataInt(row[9]),
+			DeleteRule:     metadataInt(row[10]),
+			Name:           metadataString(row[11]),
+			ParentKeyName:  metadataString(row[12]),
+			Deferrability:  metadataInt(row[13]),
+		})
+	}
+	if cursor.Err != nil {
+		return nil, cursor.Err
+	}
+	return keys, nil
+}
+
+// TypeInfo is a data type supported by the server, as described by the JDBC DatabaseMetaData.getTypeInfo
+type TypeInfo struct {
+	Name string
+	// Code of the type in java.sql.Types
+	DataType int
+	// Maximum precision, or length for the textual types
+	Precision     int
+	LiteralPrefix string
+	LiteralSuffix string
+	// Parameters used when declaring the type, for example "PRECISION,SCALE" for DECIMAL
+	CreateParams string
+	// 0 if the type doesn't allow NULL, 1 if it does and 2 if it's unknown
+	Nullable      int
+	CaseSensitive bool
+	// How the type can be used in WHERE clauses, 3 when all the operators can be used with it
+	Searchable     int
+	Unsigned       bool
+	FixedPrecScale bool
+	AutoIncrement  bool
+	LocalName      string
+	MinimumScale   int
+	MaximumScale   int
+	// Radix of the precision, usually 10
+	NumPrecRadix int
+}
+
+// GetTypeInfo returns the data types supported by the server with the GetTypeInfo RPC
+func (c *Connection) GetTypeInfo(ctx context.Context) ([]TypeInfo, error) {
+	cursor := c.Cursor()
+	defer cursor.Close()
+	cursor.runMetadataOperation(ctx, func() (*hiveserver.TOperationHandle, *hiveserver.TStatus, error) {
+		request := hiveserver.NewTGetTypeInfoReq()
+		request.SessionHandle = c.sessionHandle
+		response, err := c.rpcClient().GetTypeInfo(ctx, request)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.OperationHandle, response.Status, nil
+	})
+	if cursor.Err != nil {
+		return nil, cursor.Err
+	}
+
+	var types []TypeInfo
+	for cursor.HasMore(ctx) {
+		row := cursor.RowSlice(ctx)
+		if cursor.Err != nil {
+			return nil, cursor.Err
+		}
+		if len(row) < 18 {
+			return nil, errors.Errorf("Expected 18 columns of type info, got %d", len(row))
+		}
+		types = append(types, TypeInfo{
+			Name:           metadataString(row[0]),
+			DataType:       metadataInt(row[1]),
+			Precision:      metadataInt(row[2]),
+			LiteralPrefix:  metadataString(row[3]),
+			LiteralSuffix:  metadataString(row[4]),
+			CreateParams:   metadataString(row[5]),
+			Nullable:       metadataInt(row[6]),
+			CaseSensitive:  metadataBool(row[7]),
+			Searchable:     metadataInt(row[8]),
+			Unsigned:       metadataBool(row[9]),
+			FixedPrecScale: metadataBool(row[10]),
+			AutoIncrement:  metadataBool(row[11]),
+			LocalName:      metadataString(row[12]),
+			MinimumScale:   metadataInt(row[13]),
+			MaximumScale:   metadataInt(row[14]),
+			NumPrecRadix:   metadataInt(row[17]),
+		})
+	}
+	if cursor.Err != nil {
+		return nil, cursor.Err
+	}
+	return types, nil
+}
+
+func identifierOrNil(identifier string) *hiveserver.TIdentifier {
+	if identifier == "" {
+		return nil
+	}
+	return hiveserver.TIdentifierPtr(hiveserver.TIdentifier(identifier))
+}
+
+// metadataString returns the value of a string column of a metadata result, NULL is returned as an empty string
+func metadataString(value any) string {
+	s, _ := value.(string)
+	return s
+}
+
+// metadataInt returns the value of an integer column of a metadata result, NULL is returned as 0
+func metadataInt(value any) int {
+	switch v := value.(type) {
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// metadataBool returns the value of a boolean column of a metadata result, NULL is returned as false
+func metadataBool(value any) bool {
+	b, _ := value.(bool)
+	return b
+}
@@ -0,0 +1,310 @@
+package gohive
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestMetadataCache(t *testing.T) {
+	server := &operationHiveServer{resultSet: true, rows: 2}
+	configuration := NewConnectConfiguration()
+	configuration.MetadataCacheSize = 2
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	run := func(exec func()) []interface{} {
+		exec()
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		var values []interface{}
+		for cursor.HasMore(context.Background()) {
+			m := cursor.RowMap(context.Background())
+			if cursor.Err != nil {
+				t.Fatal(cursor.Err)
+			}
+			values = append(values, m["t.n"])
+		}
+		return values
+	}
+	query := func(query string) func() {
+		return func() {
+			cursor.Exec(context.Background(), query)
+		}
+	}
+
+	run(query("SELECT n FROM t"))
+	run(query("SELECT n FROM t"))
+	if server.metadata != 1 {
+		t.Fatalf("Expected the metadata to be requested once, got %d", server.metadata)
+	}
+	for _, n := range []int{1, 2} {
+		run(func() {
+			cursor.ExecNamed(context.Background(), "SELECT n FROM t WHERE n = :n", map[string]interface{}{"n": n})
+		})
+	}
+	if server.metadata != 2 {
+		t.Fatalf("Expected the metadata of the named query to be requested once, got %d", server.metadata)
+	}
+
+	// A stale description is replaced
+	connection.metadataCache.put("SELECT n FROM t", [][]string{{"t.n", "BIGINT_TYPE"}}, []*hiveserver.TColumnDesc{{
+		ColumnName: "t.n",
+		TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{{
+			PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: hiveserver.TTypeId_BIGINT_TYPE},
+		}}},
+	}})
+	if values := run(query("SELECT n FROM t")); !reflect.DeepEqual(values, []interface{}{int32(0), int32(1)}) || server.metadata != 3 {
+		t.Fatalf("Expected the description to be requested again, got %v after %d requests", values, server.metadata)
+	}
+
+	cursor.Exec(context.Background(), "ALTER TABLE t CHANGE n n BIGINT")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	run(query("SELECT n FROM t"))
+	if server.metadata != 4 {
+		t.Fatalf("Expected the cache to be cleared by ALTER, got %d requests", server.metadata)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	server := &operationHiveServer{resultSet: true, rows: 2}
+	configuration := NewConnectConfiguration()
+	configuration.ResultCacheSize = 1
+	configuration.ResultCacheTTL = time.Hour
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	query := func(ctx context.Context, query string) []map[string]interface{} {
+		rows, err := connection.QueryMaps(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	expected := []map[string]interface{}{{"t.n": int32(0)}, {"t.n": int32(1)}}
+	if rows := query(context.Background(), "SELECT n FROM t"); !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected %v, got %v", expected, rows)
+	}
+	rows := query(context.Background(), "SELECT n FROM t")
+	if !reflect.DeepEqual(rows, expected) || server.executions != 1 {
+		t.Fatalf("Expected the cached rows without running the query again, got %v after %d executions", rows, server.executions)
+	}
+	rows[0]["t.n"] = int32(5)
+	if rows = query(context.Background(), "SELECT n FROM t"); !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected the cached rows to be copies, got %v", rows)
+	}
+	query(WithoutResultCache(context.Background()), "SELECT n FROM t")
+	if server.executions != 2 {
+		t.Fatalf("Expected the query to run bypassing the cache, got %d executions", server.executions)
+	}
+
+	// The least recently used query is evicted, and the other statements clear the cache
+	query(context.Background(), "SELECT n FROM u")
+	query(context.Background(), "SELECT n FROM t")
+	query(context.Background(), "INSERT INTO t VALUES (1)")
+	query(context.Background(), "SELECT n FROM t")
+	if server.executions != 6 {
+		t.Fatalf("Expected 6 executions, got %d", server.executions)
+	}
+	stats := connection.Stats()
+	if stats.ResultCacheHits != 2 || stats.ResultCacheMisses != 4 {
+		t.Fatalf("Expected 2 hits and 4 misses, got %d and %d", stats.ResultCacheHits, stats.ResultCacheMisses)
+	}
+
+	connection.resultCache.ttl = time.Nanosecond
+	connection.resultCache.clear()
+	query(context.Background(), "SELECT n FROM t")
+	query(context.Background(), "SELECT n FROM t")
+	if server.executions != 8 {
+		t.Fatalf("Expected the expired rows to be fetched again, got %d executions", server.executions)
+	}
+}
+
+// keysHiveServer answers GetPrimaryKeys, GetCrossReference and GetTypeInfo with one row each and records the requests
+type keysHiveServer struct {
+	fakeHiveServer
+	primaryKeys    *hiveserver.TGetPrimaryKeysReq
+	crossReference *hiveserver.TGetCrossReferenceReq
+	typeInfo       *hiveserver.TGetTypeInfoReq
+	fetched        bool
+}
+
+func (s *keysHiveServer) operation() *hiveserver.TOperationHandle {
+	s.fetched = false
+	return &hiveserver.TOperationHandle{
+		OperationId: &hiveserver.THandleIdentifier{GUID: make([]byte, 16), Secret: make([]byte, 16)},
+	}
+}
+
+func (s *keysHiveServer) GetPrimaryKeys(ctx context.Context, req *hiveserver.TGetPrimaryKeysReq) (*hiveserver.TGetPrimaryKeysResp, error) {
+	s.primaryKeys, s.crossReference, s.typeInfo = req, nil, nil
+	return &hiveserver.TGetPrimaryKeysResp{
+		Status:          &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		OperationHandle: s.operation(),
+	}, nil
+}
+
+func (s *keysHiveServer) GetCrossReference(ctx context.Context, req *hiveserver.TGetCrossReferenceReq) (*hiveserver.TGetCrossReferenceResp, error) {
+	s.primaryKeys, s.crossReference, s.typeInfo = nil, req, nil
+	return &hiveserver.TGetCrossReferenceResp{
+		Status:          &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		OperationHandle: s.operation(),
+	}, nil
+}
+
+func (s *keysHiveServer) GetTypeInfo(ctx context.Context, req *hiveserver.TGetTypeInfoReq) (*hiveserver.TGetTypeInfoResp, error) {
+	s.primaryKeys, s.crossReference, s.typeInfo = nil, nil, req
+	return &hiveserver.TGetTypeInfoResp{
+		Status:          &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		OperationHandle: s.operation(),
+	}, nil
+}
+
+func (s *keysHiveServer) GetOperationStatus(ctx context.Context, req *hiveserver.TGetOperationStatusReq) (*hiveserver.TGetOperationStatusResp, error) {
+	state := hiveserver.TOperationState_FINISHED_STATE
+	return &hiveserver.TGetOperationStatusResp{
+		Status:         &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		OperationState: &state,
+	}, nil
+}
+
+func (s *keysHiveServer) CloseOperation(ctx context.Context, req *hiveserver.TCloseOperationReq) (*hiveserver.TCloseOperationResp, error) {
+	return &hiveserver.TCloseOperationResp{Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS}}, nil
+}
+
+// columns returns the types of the result set and the row of the last operation
+func (s *keysHiveServer) columns() ([]hiveserver.TTypeId, []interface{}) {
+	if s.primaryKeys != nil {
+		return []hiveserver.TTypeId{hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE,
+				hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_INT_TYPE, hiveserver.TTypeId_STRING_TYPE},
+			[]interface{}{nil, "default", "orders", "id", int32(1), "pk_orders"}
+	}
+	if s.typeInfo != nil {
+		return []hiveserver.TTypeId{hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_INT_TYPE, hiveserver.TTypeId_INT_TYPE,
+				hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_SMALLINT_TYPE,
+				hiveserver.TTypeId_BOOLEAN_TYPE, hiveserver.TTypeId_SMALLINT_TYPE, hiveserver.TTypeId_BOOLEAN_TYPE, hiveserver.TTypeId_BOOLEAN_TYPE,
+				hiveserver.TTypeId_BOOLEAN_TYPE, hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_SMALLINT_TYPE, hiveserver.TTypeId_SMALLINT_TYPE,
+				hiveserver.TTypeId_INT_TYPE, hiveserver.TTypeId_INT_TYPE, hiveserver.TTypeId_INT_TYPE},
+			[]interface{}{"DECIMAL", int32(3), int32(38), nil, nil, "PRECISION,SCALE", int16(1), false, int16(3), false, false, false,
+				nil, int16(0), int16(38), nil, nil, int32(10)}
+	}
+	return []hiveserver.TTypeId{hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE,
+			hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE,
+			hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_INT_TYPE, hiveserver.TTypeId_SMALLINT_TYPE, hiveserver.TTypeId_SMALLINT_TYPE,
+			hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_STRING_TYPE, hiveserver.TTypeId_SMALLINT_TYPE},
+		[]interface{}{nil, "default", "orders", "id", nil, "default", "lines", "order_id", int32(1), int16(0), int16(1), "fk_lines", "pk_orders", int16(7)}
+}
+
+func (s *keysHiveServer) GetResultSetMetadata(ctx context.Context, req *hiveserver.TGetResultSetMetadataReq) (*hiveserver.TGetResultSetMetadataResp, error) {
+	types, _ := s.columns()
+	schema := &hiveserver.TTableSchema{}
+	for i, typeId := range types {
+		schema.Columns = append(schema.Columns, &hiveserver.TColumnDesc{
+			ColumnName: fmt.Sprintf("c%d", i),
+			TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{{
+				PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: typeId},
+			}}},
+		})
+	}
+	return &hiveserver.TGetResultSetMetadataResp{
+		Status: &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		Schema: schema,
+	}, nil
+}
+
+func (s *keysHiveServer) FetchResults(ctx context.Context, req *hiveserver.TFetchResultsReq) (*hiveserver.TFetchResultsResp, error) {
+	types, row := s.columns()
+	rows := 1
+	if s.fetched {
+		rows = 0
+	}
+	s.fetched = true
+	columns := make([]*hiveserver.TColumn, len(types))
+	for i, typeId := range types {
+		nulls := []byte{}
+		if row[i] == nil {
+			nulls = []byte{1}
+		}
+		switch typeId {
+		case hiveserver.TTypeId_INT_TYPE:
+			value, _ := row[i].(int32)
+			columns[i] = &hiveserver.TColumn{I32Val: &hiveserver.TI32Column{Values: []int32{value}[:rows], Nulls: nulls}}
+		case hiveserver.TTypeId_SMALLINT_TYPE:
+			value, _ := row[i].(int16)
+			columns[i] = &hiveserver.TColumn{I16Val: &hiveserver.TI16Column{Values: []int16{value}[:rows], Nulls: nulls}}
+		case hiveserver.TTypeId_BOOLEAN_TYPE:
+			value, _ := row[i].(bool)
+			columns[i] = &hiveserver.TColumn{BoolVal: &hiveserver.TBoolColumn{Values: []bool{value}[:rows], Nulls: nulls}}
+		default:
+			value, _ := row[i].(string)
+			columns[i] = &hiveserver.TColumn{StringVal: &hiveserver.TStringColumn{Values: []string{value}[:rows], Nulls: nulls}}
+		}
+	}
+	return &hiveserver.TFetchResultsResp{
+		Status:  &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_SUCCESS_STATUS},
+		Results: &hiveserver.TRowSet{Columns: columns},
+	}, nil
+}
+
+func TestGetPrimaryKeysAndCrossReference(t *testing.T) {
+	server := &keysHiveServer{}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+
+	primaryKeys, err := connection.GetPrimaryKeys(context.Background(), "default", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPrimaryKeys := []PrimaryKey{{Schema: "default", Table: "orders", Column: "id", KeySeq: 1, Name: "pk_orders"}}
+	if !reflect.DeepEqual(primaryKeys, expectedPrimaryKeys) {
+		t.Fatalf("Expected %+v, got %+v", expectedPrimaryKeys, primaryKeys)
+	}
+	if server.primaryKeys.GetSchemaName() != "default" || server.primaryKeys.GetTableName() != "orders" || server.primaryKeys.IsSetCatalogName() {
+		t.Fatalf("Unexpected request %v", server.primaryKeys)
+	}
+
+	foreignKeys, err := connection.GetCrossReference(context.Background(), "default", "orders", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedForeignKeys := []ForeignKey{{
+		ParentSchema: "default", ParentTable: "orders", ParentColumn: "id",
+		ForeignSchema: "default", ForeignTable: "lines", ForeignColumn: "order_id",
+		KeySeq: 1, DeleteRule: 1, Name: "fk_lines", ParentKeyName: "pk_orders", Deferrability: 7,
+	}}
+	if !reflect.DeepEqual(foreignKeys, expectedForeignKeys) {
+		t.Fatalf("Expected %+v, got %+v", expectedForeignKeys, foreignKeys)
+	}
+	if server.crossReference.GetParentTableName() != "orders" || server.crossReference.IsSetForeignTableName() {
+		t.Fatalf("Unexpected request %v", server.crossReference)
+	}
+}
+
+func TestGetTypeInfo(t *testing.T) {
+	server := &keysHiveServer{}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+
+	types, err := connection.GetTypeInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TypeInfo{{
+		Name: "DECIMAL", DataType: 3, Precision: 38, CreateParams: "PRECISION,SCALE", Nullable: 1, Searchable: 3,
+		MaximumScale: 38, NumPrecRadix: 10,
+	}}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, types)
+	}
+	if server.typeInfo == nil {
+		t.Fatal("Expected a GetTypeInfo request")
+	}
+}
@@ -0,0 +1,134 @@
+package gohive
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+// metadataCache keeps the descriptions of the result sets of the last queries run in a connection, by query text
+type metadataCache struct {
+	lock    sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type metadataCacheEntry struct {
+	key         string
+	description [][]string
+	columns     []*hiveserver.TColumnDesc
+}
+
+func newMetadataCache(size int) *metadataCache {
+	return &metadataCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (m *metadataCache) get(key string) *metadataCacheEntry {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	element, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	m.order.MoveToFront(element)
+	return element.Value.(*metadataCacheEntry)
+}
+
+func (m *metadataCache) put(key string, description [][]string, columns []*hiveserver.TColumnDesc) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if element, ok := m.entries[key]; ok {
+		m.order.Remove(element)
+	}
+	m.entries[key] = m.order.PushFront(&metadataCacheEntry{key: key, description: description, columns: columns})
+	if m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*metadataCacheEntry).key)
+	}
+}
+
+func (m *metadataCache) remove(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if element, ok := m.entries[key]; ok {
+		m.order.Remove(element)
+		delete(m.entries, key)
+	}
+}
+
+func (m *metadataCache) clear() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.order.Init()
+	m.entries = make(map[string]*list.Element)
+}
+
+// readStatements are the statements that don't change the schema of the tables, the others clear the cache
+var readStatements = map[string]bool{
+	"SELECT": true, "WITH": true, "VALUES": true, "SHOW": true, "DESCRIBE": true, "DESC": true, "EXPLAIN": true,
+}
+
+// namedMetadataKey is the key of a query run with ExecNamed, the template and the types of the parameters,
+// as the values don't change the columns of the result but their types can
+func namedMetadataKey(query string, params map[string]interface{}) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	key.WriteString(query)
+	for _, name := range names {
+		fmt.Fprintf(&key, "\x00%s:%T", name, params[name])
+	}
+	return key.String()
+}
+
+// descriptionMatches returns whether the columns received have the types of the description
+func descriptionMatches(columns []*hiveserver.TColumnDesc, queue []*hiveserver.TColumn) bool {
+	if len(columns) != len(queue) {
+		return false
+	}
+	for i, column := range queue {
+		expected := reflect.TypeOf("")
+		if entry := primitiveEntry(columns[i]); entry != nil {
+			expected = goType(entry.Type)
+		}
+		if columnGoType(column) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// columnGoType returns the type of the values of a column as received, nil if it doesn't have any set
+func columnGoType(column *hiveserver.TColumn) reflect.Type {
+	switch {
+	case column == nil:
+		return nil
+	case column.IsSetBoolVal():
+		return reflect.TypeOf(false)
+	case column.IsSetByteVal():
+		return reflect.TypeOf(int8(0))
+	case column.IsSetI16Val():
+		return reflect.TypeOf(int16(0))
+	case column.IsSetI32Val():
+		return reflect.TypeOf(int32(0))
+	case column.IsSetI64Val():
+		return reflect.TypeOf(int64(0))
+	case column.IsSetDoubleVal():
+		return reflect.TypeOf(float64(0))
+	case column.IsSetBinaryVal():
+		return reflect.TypeOf([]byte(nil))
+	case column.IsSetStringVal():
+		return reflect.TypeOf("")
+	}
+	return nil
+}
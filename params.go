@@ -0,0 +1,218 @@
+package gohive
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ExecNamed issues a synchronous query after replacing the :name parameters with the escaped literal of params[name].
+// A parameter can be referenced several times. Parameters missing from params and params not referenced by the
+// query are errors. Occurrences inside quoted strings, quoted identifiers, comments and ${...} variables are left
+// untouched, as are :: casts.
+//
+// Supported values are nil, bools, integers, floats, strings, []byte (written as a string) and time.Time
+// (written as a TIMESTAMP literal), and pointers to them.
+func (c *Cursor) ExecNamed(ctx context.Context, query string, params map[string]interface{}) {
+	rendered, err := renderNamedQuery(query, params)
+	if err != nil {
+		c.resetState()
+		c.Err = err
+		return
+	}
+	c.Exec(ctx, rendered)
+	if c.metadataKey != "" {
+		c.metadataKey = namedMetadataKey(query, params)
+	}
+}
+
+func isParamStart(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isParamPart(b byte) bool {
+	return isParamStart(b) || (b >= '0' && b <= '9')
+}
+
+// renderNamedQuery replaces the :name parameters of the query with literals
+func renderNamedQuery(query string, params map[string]interface{}) (string, error) {
+	var out strings.Builder
+	used := make(map[string]bool, len(params))
+	for i := 0; i < len(query); {
+		switch ch := query[i]; {
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := i + 1
+			for end < len(query) && query[end] != ch {
+				if query[end] == '\\' && ch != '`' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(query))
+			out.WriteString(query[i:end])
+			i = end
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+		case strings.HasPrefix(query[i:], "${"):
+			end := strings.IndexByte(query[i:], '}')
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end++
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+		case strings.HasPrefix(query[i:], "::"):
+			out.WriteString("::")
+			i += 2
+		case ch == ':' && i+1 < len(query) && isParamStart(query[i+1]) && (i == 0 || !isParamPart(query[i-1])):
+			end := i + 1
+			for end < len(query) && isParamPart(query[end]) {
+				end++
+			}
+			name := query[i+1 : end]
+			value, ok := params[name]
+			if !ok {
+				return "", errors.Errorf("gohive: missing value for parameter :%s", name)
+			}
+			literal, err := formatLiteral(value)
+			if err != nil {
+				return "", errors.Wrapf(err, "parameter :%s", name)
+			}
+			used[name] = true
+			out.WriteString(literal)
+			i = end
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+	for name := range params {
+		if !used[name] {
+			return "", errors.Errorf("gohive: parameter :%s is not used in the query", name)
+		}
+	}
+	return out.String(), nil
+}
+
+// formatLiteral returns the HiveQL literal for the value
+func formatLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return formatFloat(float64(v), 32)
+	case float64:
+		return formatFloat(v, 64)
+	case string:
+		return QuoteString(v), nil
+	case []byte:
+		return QuoteString(string(v)), nil
+	case time.Time:
+		return "TIMESTAMP " + QuoteString(v.Format("2006-01-02 15:04:05.999999999")), nil
+	case *bool:
+		return formatPointer(v)
+	case *int:
+		return formatPointer(v)
+	case *int32:
+		return formatPointer(v)
+	case *int64:
+		return formatPointer(v)
+	case *float64:
+		return formatPointer(v)
+	case *string:
+		return formatPointer(v)
+	case *time.Time:
+		return formatPointer(v)
+	}
+	return "", errors.Errorf("gohive: unsupported parameter type %T", value)
+}
+
+func formatPointer[T any](v *T) (string, error) {
+	if v == nil {
+		return "NULL", nil
+	}
+	return formatLiteral(*v)
+}
+
+func formatFloat(v float64, bitSize int) (string, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", errors.Errorf("gohive: %v can't be written as a literal", v)
+	}
+	return strconv.FormatFloat(v, 'g', -1, bitSize), nil
+}
+
+// QuoteIdentifier returns name quoted with backticks so it can be used as a table or column name in a query,
+// even if it's a reserved word. Backticks in the name are doubled, as Hive expects.
+func QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// QuoteString returns s as a single quoted string literal, escaping backslashes, quotes and control characters
+func QuoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case 0:
+			b.WriteString(`\0`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
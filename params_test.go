@@ -0,0 +1,49 @@
+package gohive
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderNamedQuery(t *testing.T) {
+	query := "SELECT a, '${x}:not_a_param', `c:d` FROM t -- :comment\n" +
+		"WHERE d >= :start AND d < :end AND s = :name AND f = ${hiveconf:flag} AND x = CAST(:start AS DATE) AND y = a::int /* :other */ OR n = :missing_ok"
+	rendered, err := renderNamedQuery(query, map[string]interface{}{
+		"start":      "2024-01-01",
+		"end":        time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		"name":       "O'Brien\\",
+		"missing_ok": nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "SELECT a, '${x}:not_a_param', `c:d` FROM t -- :comment\n" +
+		"WHERE d >= '2024-01-01' AND d < TIMESTAMP '2024-02-01 00:00:00' AND s = 'O\\'Brien\\\\' AND f = ${hiveconf:flag} AND x = CAST('2024-01-01' AS DATE) AND y = a::int /* :other */ OR n = NULL"
+	if rendered != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, rendered)
+	}
+}
+
+func TestRenderNamedQueryErrors(t *testing.T) {
+	if _, err := renderNamedQuery("SELECT :a", map[string]interface{}{}); err == nil {
+		t.Fatal("Expected error for a missing parameter")
+	}
+	if _, err := renderNamedQuery("SELECT :a", map[string]interface{}{"a": 1, "b": 2}); err == nil {
+		t.Fatal("Expected error for an unused parameter")
+	}
+	if _, err := renderNamedQuery("SELECT :a", map[string]interface{}{"a": struct{}{}}); err == nil {
+		t.Fatal("Expected error for an unsupported type")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if quoted := QuoteIdentifier("my`table"); quoted != "`my``table`" {
+		t.Fatalf("Unexpected identifier %s", quoted)
+	}
+	if quoted := QuoteIdentifier("select"); quoted != "`select`" {
+		t.Fatalf("Unexpected identifier %s", quoted)
+	}
+	if quoted := QuoteString("it's a \\ \"test\"\n"); quoted != `'it\'s a \\ "test"\n'` {
+		t.Fatalf("Unexpected string %s", quoted)
+	}
+}
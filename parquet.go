@@ -0,0 +1,603 @@
+package gohive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+// DEFAULT_PARQUET_ROW_GROUP_SIZE is the default number of rows per row group written by WriteParquet
+const DEFAULT_PARQUET_ROW_GROUP_SIZE = 100000
+
+// ParquetOptions configures how WriteParquet writes the file
+type ParquetOptions struct {
+	// Number of rows buffered in memory before they are written as a row group
+	RowGroupSize int
+}
+
+// Physical types, converted types and encodings from the parquet format specification
+const (
+	parquetBoolean           int32 = 0
+	parquetInt32             int32 = 1
+	parquetInt64             int32 = 2
+	parquetFloat             int32 = 4
+	parquetDouble            int32 = 5
+	parquetByteArray         int32 = 6
+	parquetFixedLenByteArray int32 = 7
+
+	parquetNoConvertedType  int32 = -1
+	parquetUTF8             int32 = 0
+	parquetDecimal          int32 = 5
+	parquetDate             int32 = 6
+	parquetTimestampMicros  int32 = 10
+	parquetInt8             int32 = 15
+	parquetInt16            int32 = 16
+	parquetEncodingPlain    int32 = 0
+	parquetEncodingRLE      int32 = 3
+	parquetRepetitionOption int32 = 1
+)
+
+var parquetMagic = []byte("PAR1")
+
+// WriteParquet fetches all the remaining rows of the cursor and writes them to w as a parquet file.
+// Hive primitive types are mapped to their parquet counterparts, DECIMAL is written as a
+// FIXED_LEN_BYTE_ARRAY with the precision and scale of the column, and complex types are written
+// as the string returned by the server. Only RowGroupSize rows are kept in memory at a time.
+func (c *Cursor) WriteParquet(ctx context.Context, w io.Writer, opts *ParquetOptions) error {
+	rowGroupSize := DEFAULT_PARQUET_ROW_GROUP_SIZE
+	if opts != nil && opts.RowGroupSize > 0 {
+		rowGroupSize = opts.RowGroupSize
+	}
+
+	schema := c.schema(ctx)
+	if c.Err != nil {
+		return c.Err
+	}
+	writer, err := newParquetWriter(w, schema)
+	if err != nil {
+		return err
+	}
+
+	for c.HasMore(ctx) {
+		if c.Err != nil {
+			return c.Err
+		}
+		if len(c.queue) != len(writer.columns) {
+			return errors.Errorf("%d columns were received but the schema has %d", len(c.queue), len(writer.columns))
+		}
+		for c.columnIndex < c.totalRows {
+			end := c.totalRows
+			if end-c.columnIndex > rowGroupSize-writer.rows {
+				end = c.columnIndex + rowGroupSize - writer.rows
+			}
+			if err = writer.appendRows(c.queue, c.columnIndex, end); err != nil {
+				return err
+			}
+			c.consumeRows(end)
+			if writer.rows >= rowGroupSize {
+				if err = writer.flushRowGroup(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if c.Err != nil {
+		return c.Err
+	}
+	return writer.close()
+}
+
+type parquetColumn struct {
+	name          string
+	hiveType      hiveserver.TTypeId
+	physicalType  int32
+	convertedType int32
+	typeLength    int32
+	precision     int32
+	scale         int32
+
+	present   []bool
+	booleans  []bool
+	values    bytes.Buffer
+	numValues int
+}
+
+type parquetColumnChunk struct {
+	column       *parquetColumn
+	offset       int64
+	size         int64
+	numValues    int
+	hasBooleans  bool
+	physicalType int32
+}
+
+type parquetRowGroup struct {
+	chunks []parquetColumnChunk
+	size   int64
+	rows   int
+}
+
+type parquetWriter struct {
+	w         *bufio.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rows      int
+	totalRows int64
+	rowGroups []parquetRowGroup
+}
+
+func newParquetWriter(w io.Writer, schema []*hiveserver.TColumnDesc) (*parquetWriter, error) {
+	writer := &parquetWriter{w: bufio.NewWriter(w)}
+	for _, desc := range schema {
+		column := &parquetColumn{
+			name:          desc.ColumnName,
+			hiveType:      hiveserver.TTypeId_STRING_TYPE,
+			physicalType:  parquetByteArray,
+			convertedType: parquetUTF8,
+		}
+		entry := primitiveEntry(desc)
+		if entry != nil {
+			column.hiveType = entry.Type
+		}
+		switch column.hiveType {
+		case hiveserver.TTypeId_BOOLEAN_TYPE:
+			column.physicalType, column.convertedType = parquetBoolean, parquetNoConvertedType
+		case hiveserver.TTypeId_TINYINT_TYPE:
+			column.physicalType, column.convertedType = parquetInt32, parquetInt8
+		case hiveserver.TTypeId_SMALLINT_TYPE:
+			column.physicalType, column.convertedType = parquetInt32, parquetInt16
+		case hiveserver.TTypeId_INT_TYPE:
+			column.physicalType, column.convertedType = parquetInt32, parquetNoConvertedType
+		case hiveserver.TTypeId_BIGINT_TYPE:
+			column.physicalType, column.convertedType = parquetInt64, parquetNoConvertedType
+		case hiveserver.TTypeId_FLOAT_TYPE:
+			column.physicalType, column.convertedType = parquetFloat, parquetNoConvertedType
+		case hiveserver.TTypeId_DOUBLE_TYPE:
+			column.physicalType, column.convertedType = parquetDouble, parquetNoConvertedType
+		case hiveserver.TTypeId_BINARY_TYPE:
+			column.physicalType, column.convertedType = parquetByteArray, parquetNoConvertedType
+		case hiveserver.TTypeId_DATE_TYPE:
+			column.physicalType, column.convertedType = parquetInt32, parquetDate
+		case hiveserver.TTypeId_TIMESTAMP_TYPE:
+			column.physicalType, column.convertedType = parquetInt64, parquetTimestampMicros
+		case hiveserver.TTypeId_DECIMAL_TYPE:
+			column.precision, column.scale = decimalPrecisionScale(entry)
+			column.physicalType, column.convertedType = parquetFixedLenByteArray, parquetDecimal
+			column.typeLength = decimalByteLength(column.precision)
+		}
+		writer.columns = append(writer.columns, column)
+	}
+	if _, err := writer.write(parquetMagic); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (p *parquetWriter) write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return n, err
+}
+
+// appendRows encodes the rows in [from, to) of the columns fetched from the server
+func (p *parquetWriter) appendRows(columns []*hiveserver.TColumn, from int, to int) error {
+	for i, column := range p.columns {
+		for position := from; position < to; position++ {
+			value := columnValue(columns[i], position)
+			column.numValues++
+			if value == nil {
+				column.present = append(column.present, false)
+				continue
+			}
+			column.present = append(column.present, true)
+			if err := column.appendValue(value); err != nil {
+				return errors.Wrapf(err, "column %s", column.name)
+			}
+		}
+	}
+	p.rows += to - from
+	return nil
+}
+
+func (column *parquetColumn) appendValue(value interface{}) error {
+	var buf [8]byte
+	switch v := value.(type) {
+	case bool:
+		column.booleans = append(column.booleans, v)
+	case int8:
+		binary.LittleEndian.PutUint32(buf[:4], uint32(int32(v)))
+		column.values.Write(buf[:4])
+	case int16:
+		binary.LittleEndian.PutUint32(buf[:4], uint32(int32(v)))
+		column.values.Write(buf[:4])
+	case int32:
+		binary.LittleEndian.PutUint32(buf[:4], uint32(v))
+		column.values.Write(buf[:4])
+	case int64:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		column.values.Write(buf[:])
+	case float64:
+		if column.physicalType == parquetFloat {
+			binary.LittleEndian.PutUint32(buf[:4], math.Float32bits(float32(v)))
+			column.values.Write(buf[:4])
+		} else {
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+			column.values.Write(buf[:])
+		}
+	case []byte:
+		binary.LittleEndian.PutUint32(buf[:4], uint32(len(v)))
+		column.values.Write(buf[:4])
+		column.values.Write(v)
+	case string:
+		switch column.hiveType {
+		case hiveserver.TTypeId_DATE_TYPE:
+			days, err := dateDays(v)
+			if err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint32(buf[:4], uint32(days))
+			column.values.Write(buf[:4])
+		case hiveserver.TTypeId_TIMESTAMP_TYPE:
+			timestamp, err := ParseTimestamp(v, time.UTC)
+			if err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint64(buf[:], uint64(timestamp.UnixMicro()))
+			column.values.Write(buf[:])
+		case hiveserver.TTypeId_DECIMAL_TYPE:
+			unscaled, err := decimalToFixedBytes(v, column.scale, column.typeLength)
+			if err != nil {
+				return err
+			}
+			column.values.Write(unscaled)
+		default:
+			binary.LittleEndian.PutUint32(buf[:4], uint32(len(v)))
+			column.values.Write(buf[:4])
+			column.values.WriteString(v)
+		}
+	default:
+		return errors.Errorf("unexpected value %v of type %T", value, value)
+	}
+	return nil
+}
+
+// flushRowGroup writes the buffered rows as a row group with a single data page per column
+func (p *parquetWriter) flushRowGroup() error {
+	if p.rows == 0 {
+		return nil
+	}
+	rowGroup := parquetRowGroup{rows: p.rows}
+	for _, column := range p.columns {
+		page := column.encodePage()
+		header, err := encodePageHeader(column.numValues, len(page))
+		if err != nil {
+			return err
+		}
+		chunk := parquetColumnChunk{
+			column:       column,
+			offset:       p.offset,
+			size:         int64(len(header) + len(page)),
+			numValues:    column.numValues,
+			physicalType: column.physicalType,
+		}
+		if _, err = p.write(header); err != nil {
+			return err
+		}
+		if _, err = p.write(page); err != nil {
+			return err
+		}
+		rowGroup.chunks = append(rowGroup.chunks, chunk)
+		rowGroup.size += chunk.size
+
+		column.present = column.present[:0]
+		column.booleans = column.booleans[:0]
+		column.values.Reset()
+		column.numValues = 0
+	}
+	p.rowGroups = append(p.rowGroups, rowGroup)
+	p.totalRows += int64(p.rows)
+	p.rows = 0
+	return nil
+}
+
+// encodePage returns the definition levels, prefixed by their length, followed by the PLAIN encoded values
+func (column *parquetColumn) encodePage() []byte {
+	levels := encodeRLE(column.present)
+	var page bytes.Buffer
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(levels)))
+	page.Write(length[:])
+	page.Write(levels)
+	if column.physicalType == parquetBoolean {
+		packed := make([]byte, (len(column.booleans)+7)/8)
+		for i, value := range column.booleans {
+			if value {
+				packed[i/8] |= 1 << uint(i%8)
+			}
+		}
+		page.Write(packed)
+	} else {
+		page.Write(column.values.Bytes())
+	}
+	return page.Bytes()
+}
+
+// encodeRLE encodes levels of bit width 1 with the RLE runs of the RLE/bit-packing hybrid encoding
+func encodeRLE(levels []bool) []byte {
+	var out []byte
+	var header [binary.MaxVarintLen64]byte
+	for i := 0; i < len(levels); {
+		run := 1
+		for i+run < len(levels) && levels[i+run] == levels[i] {
+			run++
+		}
+		n := binary.PutUvarint(header[:], uint64(run)<<1)
+		out = append(out, header[:n]...)
+		if levels[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i += run
+	}
+	return out
+}
+
+func (p *parquetWriter) close() error {
+	if err := p.flushRowGroup(); err != nil {
+		return err
+	}
+	footer, err := p.encodeFileMetadata()
+	if err != nil {
+		return err
+	}
+	if _, err = p.write(footer); err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	if _, err = p.write(length[:]); err != nil {
+		return err
+	}
+	if _, err = p.write(parquetMagic); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+// compactWriter writes thrift structs with the compact protocol, which is the one used by parquet metadata
+type compactWriter struct {
+	ctx      context.Context
+	buffer   *thrift.TMemoryBuffer
+	protocol thrift.TProtocol
+	err      error
+}
+
+func newCompactWriter() *compactWriter {
+	buffer := thrift.NewTMemoryBuffer()
+	return &compactWriter{
+		ctx:      context.Background(),
+		buffer:   buffer,
+		protocol: thrift.NewTCompactProtocolConf(buffer, &thrift.TConfiguration{}),
+	}
+}
+
+func (w *compactWriter) check(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *compactWriter) structBegin() {
+	w.check(w.protocol.WriteStructBegin(w.ctx, ""))
+}
+
+func (w *compactWriter) structEnd() {
+	w.check(w.protocol.WriteFieldStop(w.ctx))
+	w.check(w.protocol.WriteStructEnd(w.ctx))
+}
+
+func (w *compactWriter) field(id int16, fieldType thrift.TType) {
+	w.check(w.protocol.WriteFieldBegin(w.ctx, "", fieldType, id))
+}
+
+func (w *compactWriter) i32(id int16, value int32) {
+	w.field(id, thrift.I32)
+	w.check(w.protocol.WriteI32(w.ctx, value))
+}
+
+func (w *compactWriter) i64(id int16, value int64) {
+	w.field(id, thrift.I64)
+	w.check(w.protocol.WriteI64(w.ctx, value))
+}
+
+func (w *compactWriter) str(id int16, value string) {
+	w.field(id, thrift.STRING)
+	w.check(w.protocol.WriteString(w.ctx, value))
+}
+
+func (w *compactWriter) list(id int16, elemType thrift.TType, size int) {
+	w.field(id, thrift.LIST)
+	w.check(w.protocol.WriteListBegin(w.ctx, elemType, size))
+}
+
+func (w *compactWriter) bytes() ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	if err := w.protocol.Flush(w.ctx); err != nil {
+		return nil, err
+	}
+	return w.buffer.Bytes(), nil
+}
+
+func encodePageHeader(numValues int, pageSize int) ([]byte, error) {
+	w := newCompactWriter()
+	w.structBegin()
+	// Data page
+	w.i32(1, 0)
+	w.i32(2, int32(pageSize))
+	w.i32(3, int32(pageSize))
+	w.field(5, thrift.STRUCT)
+	w.structBegin()
+	w.i32(1, int32(numValues))
+	w.i32(2, parquetEncodingPlain)
+	w.i32(3, parquetEncodingRLE)
+	w.i32(4, parquetEncodingRLE)
+	w.structEnd()
+	w.structEnd()
+	return w.bytes()
+}
+
+func (p *parquetWriter) encodeFileMetadata() ([]byte, error) {
+	w := newCompactWriter()
+	w.structBegin()
+	w.i32(1, 1)
+
+	w.list(2, thrift.STRUCT, len(p.columns)+1)
+	w.structBegin()
+	w.str(4, "schema")
+	w.i32(5, int32(len(p.columns)))
+	w.structEnd()
+	for _, column := range p.columns {
+		w.structBegin()
+		w.i32(1, column.physicalType)
+		if column.physicalType == parquetFixedLenByteArray {
+			w.i32(2, column.typeLength)
+		}
+		w.i32(3, parquetRepetitionOption)
+		w.str(4, column.name)
+		if column.convertedType != parquetNoConvertedType {
+			w.i32(6, column.convertedType)
+		}
+		if column.convertedType == parquetDecimal {
+			w.i32(7, column.scale)
+			w.i32(8, column.precision)
+		}
+		w.structEnd()
+	}
+
+	w.i64(3, p.totalRows)
+
+	w.list(4, thrift.STRUCT, len(p.rowGroups))
+	for _, rowGroup := range p.rowGroups {
+		w.structBegin()
+		w.list(1, thrift.STRUCT, len(rowGroup.chunks))
+		for _, chunk := range rowGroup.chunks {
+			w.structBegin()
+			w.i64(2, chunk.offset)
+			w.field(3, thrift.STRUCT)
+			w.structBegin()
+			w.i32(1, chunk.physicalType)
+			w.list(2, thrift.I32, 2)
+			w.check(w.protocol.WriteI32(w.ctx, parquetEncodingPlain))
+			w.check(w.protocol.WriteI32(w.ctx, parquetEncodingRLE))
+			w.list(3, thrift.STRING, 1)
+			w.check(w.protocol.WriteString(w.ctx, chunk.column.name))
+			// Uncompressed
+			w.i32(4, 0)
+			w.i64(5, int64(chunk.numValues))
+			w.i64(6, chunk.size)
+			w.i64(7, chunk.size)
+			w.i64(9, chunk.offset)
+			w.structEnd()
+			w.structEnd()
+		}
+		w.i64(2, rowGroup.size)
+		w.i64(3, int64(rowGroup.rows))
+		w.structEnd()
+	}
+
+	w.str(6, "gohive")
+	w.structEnd()
+	return w.bytes()
+}
+
+// primitiveEntry returns the primitive type entry of the column, nil if it isn't described by one
+func primitiveEntry(column *hiveserver.TColumnDesc) *hiveserver.TPrimitiveTypeEntry {
+	if column == nil || column.TypeDesc == nil || len(column.TypeDesc.Types) == 0 {
+		return nil
+	}
+	return column.TypeDesc.Types[0].PrimitiveEntry
+}
+
+// decimalPrecisionScale returns the precision and scale qualifiers of a DECIMAL column, Hive's default decimal(10,0) if missing
+func decimalPrecisionScale(entry *hiveserver.TPrimitiveTypeEntry) (precision int32, scale int32) {
+	precision, scale = 10, 0
+	if entry == nil || entry.TypeQualifiers == nil {
+		return
+	}
+	if value, ok := entry.TypeQualifiers.Qualifiers[hiveserver.PRECISION]; ok && value.I32Value != nil {
+		precision = *value.I32Value
+	}
+	if value, ok := entry.TypeQualifiers.Qualifiers[hiveserver.SCALE]; ok && value.I32Value != nil {
+		scale = *value.I32Value
+	}
+	return
+}
+
+// decimalByteLength returns the minimum number of bytes for storing an unscaled value of the precision
+func decimalByteLength(precision int32) int32 {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)
+	length := int32(1)
+	for new(big.Int).Lsh(big.NewInt(1), uint(8*length-1)).Cmp(max) < 0 {
+		length++
+	}
+	return length
+}
+
+// dateDays returns the number of days from the Unix epoch to the DATE value
+func dateDays(v string) (int32, error) {
+	date, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return 0, err
+	}
+	days := date.Unix() / 86400
+	if date.Unix()%86400 < 0 {
+		days--
+	}
+	return int32(days), nil
+}
+
+// decimalToFixedBytes encodes the decimal string as the big endian two's complement of its unscaled value. The digits
+// beyond the scale are rounded half up, like Hive does, and values outside of the range of length bytes are rejected.
+func decimalToFixedBytes(value string, scale int32, length int32) ([]byte, error) {
+	integer, fraction, _ := strings.Cut(strings.TrimLeft(value, "+-"), ".")
+	roundUp := false
+	if int32(len(fraction)) > scale {
+		roundUp = fraction[scale] >= '5'
+		fraction = fraction[:scale]
+	}
+	fraction += strings.Repeat("0", int(scale)-len(fraction))
+	unscaled, ok := new(big.Int).SetString(integer+fraction, 10)
+	if !ok {
+		return nil, errors.Errorf("invalid decimal value %s", value)
+	}
+	if roundUp {
+		unscaled.Add(unscaled, big.NewInt(1))
+	}
+	if strings.HasPrefix(value, "-") {
+		unscaled.Neg(unscaled)
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(8*length-1))
+	if unscaled.Cmp(limit) >= 0 || unscaled.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return nil, errors.Errorf("decimal value %s doesn't fit in %d bytes", value, length)
+	}
+	if unscaled.Sign() < 0 {
+		unscaled.Add(unscaled, new(big.Int).Lsh(limit, 1))
+	}
+	b := unscaled.Bytes()
+	out := make([]byte, length)
+	copy(out[int(length)-len(b):], b)
+	return out, nil
+}
@@ -0,0 +1,283 @@
+package gohive
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func parquetColumnDesc(name string, typeId hiveserver.TTypeId) *hiveserver.TColumnDesc {
+	return &hiveserver.TColumnDesc{
+		ColumnName: name,
+		TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{
+			{PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: typeId}},
+		}},
+	}
+}
+
+func TestWriteParquetFile(t *testing.T) {
+	schema := []*hiveserver.TColumnDesc{
+		parquetColumnDesc("id", hiveserver.TTypeId_INT_TYPE),
+		parquetColumnDesc("name", hiveserver.TTypeId_STRING_TYPE),
+		parquetColumnDesc("amount", hiveserver.TTypeId_DECIMAL_TYPE),
+		parquetColumnDesc("flag", hiveserver.TTypeId_BOOLEAN_TYPE),
+	}
+	precision, scale := int32(9), int32(2)
+	schema[2].TypeDesc.Types[0].PrimitiveEntry.TypeQualifiers = &hiveserver.TTypeQualifiers{Qualifiers: map[string]*hiveserver.TTypeQualifierValue{
+		hiveserver.PRECISION: {I32Value: &precision},
+		hiveserver.SCALE:     {I32Value: &scale},
+	}}
+	columns := []*hiveserver.TColumn{
+		{I32Val: &hiveserver.TI32Column{Values: []int32{1, 2, 3}, Nulls: []byte{}}},
+		{StringVal: &hiveserver.TStringColumn{Values: []string{"a", "", "c"}, Nulls: []byte{2}}},
+		{StringVal: &hiveserver.TStringColumn{Values: []string{"1.005", "-0.00", "-2.5"}, Nulls: []byte{}}},
+		{BoolVal: &hiveserver.TBoolColumn{Values: []bool{true, false, true}, Nulls: []byte{}}},
+	}
+
+	var buffer bytes.Buffer
+	writer, err := newParquetWriter(&buffer, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.appendRows(columns, 0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.flushRowGroup(); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.appendRows(columns, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buffer.Bytes()
+	if !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+		t.Fatal("file should start and end with the parquet magic number")
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	metadata, _ := readCompact(t, data[len(data)-8-footerLength:len(data)-8])
+
+	if numRows := metadata[3].(int64); numRows != 3 {
+		t.Fatalf("Expected 3 rows, got %d", numRows)
+	}
+	elements := metadata[2].([]interface{})
+	if len(elements) != len(schema)+1 || elements[0].(map[int16]interface{})[5].(int32) != int32(len(schema)) {
+		t.Fatalf("Expected a root with %d children, got %v", len(schema), elements)
+	}
+	// Physical type, converted type, length, scale and precision of each column
+	expectedTypes := [][]interface{}{
+		{int32(1), nil, nil, nil, nil},
+		{int32(6), int32(0), nil, nil, nil},
+		{int32(7), int32(5), int32(4), int32(2), int32(9)},
+		{int32(0), nil, nil, nil, nil},
+	}
+	for i, element := range elements[1:] {
+		fields := element.(map[int16]interface{})
+		if name := string(fields[4].([]byte)); name != schema[i].ColumnName || fields[3].(int32) != 1 {
+			t.Errorf("Expected the optional column %s, got %s", schema[i].ColumnName, name)
+		}
+		actual := []interface{}{fields[1], fields[6], fields[2], fields[7], fields[8]}
+		if !reflect.DeepEqual(actual, expectedTypes[i]) {
+			t.Errorf("Expected the types %v for %s, got %v", expectedTypes[i], schema[i].ColumnName, actual)
+		}
+	}
+
+	// The values of each column in each row group, decoded from the definition levels and the PLAIN values of its page
+	expected := [][][]interface{}{
+		{{int32(1), int32(2)}, {"a", nil}, {int64(101), int64(0)}, {true, false}},
+		{{int32(3)}, {"c"}, {int64(-250)}, {true}},
+	}
+	rowGroups := metadata[4].([]interface{})
+	if len(rowGroups) != 2 {
+		t.Fatalf("Expected 2 row groups, got %d", len(rowGroups))
+	}
+	for i, rowGroup := range rowGroups {
+		chunks := rowGroup.(map[int16]interface{})[1].([]interface{})
+		if rows := rowGroup.(map[int16]interface{})[3].(int64); rows != int64(len(expected[i][0])) {
+			t.Fatalf("Expected %d rows in the row group %d, got %d", len(expected[i][0]), i, rows)
+		}
+		for j, chunk := range chunks {
+			chunkMetadata := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			path := chunkMetadata[3].([]interface{})
+			if len(path) != 1 || string(path[0].([]byte)) != schema[j].ColumnName || chunkMetadata[4].(int32) != 0 {
+				t.Fatalf("Unexpected path %v or codec of the column %s", path, schema[j].ColumnName)
+			}
+			offset := chunkMetadata[9].(int64)
+			header, headerLength := readCompact(t, data[offset:])
+			pageHeader := header[5].(map[int16]interface{})
+			numValues := int(pageHeader[1].(int32))
+			if header[1].(int32) != 0 || numValues != len(expected[i][j]) || chunkMetadata[5].(int64) != int64(numValues) {
+				t.Fatalf("Expected a data page of %d values, got %v", len(expected[i][j]), header)
+			}
+			if pageHeader[2].(int32) != 0 || pageHeader[3].(int32) != 3 {
+				t.Fatalf("Expected PLAIN values and RLE levels, got %v", pageHeader)
+			}
+			page := data[int(offset)+headerLength : int(offset)+headerLength+int(header[3].(int32))]
+			if total := int64(headerLength + len(page)); chunkMetadata[6].(int64) != total {
+				t.Fatalf("Expected a chunk of %d bytes, got %d", total, chunkMetadata[6].(int64))
+			}
+			values := readPlainPage(t, page, numValues, elements[j+1].(map[int16]interface{}))
+			if !reflect.DeepEqual(values, expected[i][j]) {
+				t.Errorf("Expected %v in the column %s of the row group %d, got %v", expected[i][j], schema[j].ColumnName, i, values)
+			}
+		}
+	}
+}
+
+// readCompact reads a thrift struct of the compact protocol as a map of its fields, returning the bytes read
+func readCompact(t *testing.T, data []byte) (map[int16]interface{}, int) {
+	buffer := &thrift.TMemoryBuffer{Buffer: bytes.NewBuffer(data)}
+	protocol := thrift.NewTCompactProtocolConf(buffer, &thrift.TConfiguration{})
+	value := readCompactValue(t, protocol, thrift.STRUCT)
+	return value.(map[int16]interface{}), len(data) - buffer.Len()
+}
+
+func readCompactValue(t *testing.T, protocol thrift.TProtocol, fieldType thrift.TType) interface{} {
+	ctx := context.Background()
+	var value interface{}
+	var err error
+	switch fieldType {
+	case thrift.STRUCT:
+		fields := map[int16]interface{}{}
+		if _, err = protocol.ReadStructBegin(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			_, fieldType, id, err := protocol.ReadFieldBegin(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fieldType == thrift.STOP {
+				break
+			}
+			fields[id] = readCompactValue(t, protocol, fieldType)
+		}
+		err = protocol.ReadStructEnd(ctx)
+		value = fields
+	case thrift.LIST:
+		elemType, size, err := protocol.ReadListBegin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		elements := []interface{}{}
+		for i := 0; i < size; i++ {
+			elements = append(elements, readCompactValue(t, protocol, elemType))
+		}
+		err = protocol.ReadListEnd(ctx)
+		value = elements
+	case thrift.I32:
+		value, err = protocol.ReadI32(ctx)
+	case thrift.I64:
+		value, err = protocol.ReadI64(ctx)
+	case thrift.STRING:
+		value, err = protocol.ReadBinary(ctx)
+	default:
+		t.Fatalf("Unexpected thrift type %s", fieldType)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// readPlainPage decodes the values of a data page of an optional column, nil for the NULL values. DECIMAL values are
+// returned unscaled.
+func readPlainPage(t *testing.T, page []byte, numValues int, element map[int16]interface{}) []interface{} {
+	levelsLength := int(binary.LittleEndian.Uint32(page))
+	levels := page[4 : 4+levelsLength]
+	values := page[4+levelsLength:]
+	// The levels are encoded with the RLE/bit-packing hybrid encoding with a bit width of 1
+	var present []bool
+	for len(levels) > 0 {
+		header, n := binary.Uvarint(levels)
+		levels = levels[n:]
+		if header&1 == 0 {
+			for i := 0; i < int(header>>1); i++ {
+				present = append(present, levels[0] == 1)
+			}
+			levels = levels[1:]
+		} else {
+			for i := 0; i < int(header>>1)*8; i++ {
+				present = append(present, levels[i/8]&(1<<uint(i%8)) != 0)
+			}
+			levels = levels[header>>1:]
+		}
+	}
+	if len(present) < numValues {
+		t.Fatalf("Expected %d definition levels, got %d", numValues, len(present))
+	}
+	var decoded []interface{}
+	booleans := 0
+	for _, isPresent := range present[:numValues] {
+		if !isPresent {
+			decoded = append(decoded, nil)
+			continue
+		}
+		switch element[1].(int32) {
+		case 0:
+			decoded = append(decoded, values[booleans/8]&(1<<uint(booleans%8)) != 0)
+			booleans++
+		case 1:
+			decoded = append(decoded, int32(binary.LittleEndian.Uint32(values)))
+			values = values[4:]
+		case 6:
+			length := binary.LittleEndian.Uint32(values)
+			decoded = append(decoded, string(values[4:4+length]))
+			values = values[4+length:]
+		case 7:
+			length := element[2].(int32)
+			unscaled := new(big.Int).SetBytes(values[:length])
+			if values[0]&0x80 != 0 {
+				unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(8*length)))
+			}
+			decoded = append(decoded, unscaled.Int64())
+			values = values[length:]
+		}
+	}
+	return decoded
+}
+
+func TestDecimalToFixedBytes(t *testing.T) {
+	if length := decimalByteLength(10); length != 5 {
+		t.Fatalf("Expected 5 bytes for precision 10, got %d", length)
+	}
+	tests := []struct {
+		value    string
+		scale    int32
+		expected []byte
+	}{
+		// -150 in two's complement
+		{"-1.5", 2, []byte{0xff, 0x6a}},
+		{"-0.00", 2, []byte{0, 0}},
+		{"-0.001", 2, []byte{0, 0}},
+		{"0.005", 2, []byte{0, 1}},
+		{"-0.005", 2, []byte{0xff, 0xff}},
+		{"1.2349", 3, []byte{0x04, 0xd3}},
+		{"32767", 0, []byte{0x7f, 0xff}},
+		{"-32768", 0, []byte{0x80, 0}},
+		{"327.675", 2, nil},
+		{"32768", 0, nil},
+		{"-32769", 0, nil},
+		{"123456", 0, nil},
+	}
+	for _, test := range tests {
+		b, err := decimalToFixedBytes(test.value, test.scale, 2)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("Expected an overflow error for %s, got %x", test.value, b)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(b, test.expected) {
+			t.Errorf("Expected %x for %s, got %x, %v", test.expected, test.value, b, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package gohive
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+	"github.com/pkg/errors"
+)
+
+// ErrTooManyEmptyPolls is the cause of the cursor error when the server sends MaxEmptyPolls batches without columns in a row
+var ErrTooManyEmptyPolls = errors.New("gohive: the server didn't send any column")
+
+// prefetcher fetches the next batches of an operation in the background while the current one is read
+type prefetcher struct {
+	results chan prefetchResult
+	stop    chan struct{}
+	// Cancels the fetch waiting for the transport with errPrefetchStopped
+	cancel context.CancelCauseFunc
+}
+
+// errPrefetchStopped is the cause of the cancellation of the fetches of a stopped prefetcher. A fetch already sent
+// isn't interrupted for it, the rest of the connection would be lost, see interruptMiddleware.
+var errPrefetchStopped = errors.New("gohive: the prefetching was stopped")
+
+type prefetchResult struct {
+	response *hiveserver.TFetchResultsResp
+	err      error
+}
+
+// startPrefetch starts fetching up to batches batches ahead of the ones received by the cursor.
+// It stops after a batch without rows or after an error. Each fetch is bounded by DefaultTimeout, as it isn't done
+// for a caller with a context.
+func (c *Cursor) startPrefetch(batches int) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	p := &prefetcher{
+		results: make(chan prefetchResult, batches),
+		stop:    make(chan struct{}),
+		cancel:  cancel,
+	}
+	fetchRequest := hiveserver.NewTFetchResultsReq()
+	fetchRequest.OperationHandle = c.operationHandle
+	fetchRequest.Orientation = hiveserver.TFetchOrientation_FETCH_NEXT
+	fetchRequest.MaxRows = c.getFetchSize()
+	client := c.conn.rpcClient()
+	pollInterval := c.getPollInterval()
+	maxEmptyPolls := c.conn.configuration.MaxEmptyPolls
+	conn := c.conn
+
+	go func() {
+		defer close(p.results)
+		emptyPolls := 0
+		for {
+			select {
+			case <-p.stop:
+				return
+			default:
+			}
+			fetchCtx, cancelFetch := conn.withDefaultTimeout(ctx)
+			response, err := client.FetchResults(fetchCtx, fetchRequest)
+			cancelFetch()
+			if err == nil && len(response.GetResults().GetColumns()) == 0 && success(safeStatus(response.GetStatus())) {
+				emptyPolls++
+				if maxEmptyPolls <= 0 || emptyPolls < maxEmptyPolls {
+					time.Sleep(pollInterval)
+					continue
+				}
+				err = errors.Wrapf(ErrTooManyEmptyPolls, "%d fetches", emptyPolls)
+			} else {
+				emptyPolls = 0
+			}
+			select {
+			case p.results <- prefetchResult{response: response, err: err}:
+			case <-p.stop:
+				return
+			}
+			if err != nil || !success(safeStatus(response.GetStatus())) {
+				return
+			}
+			if rows, err := getTotalRows(response.GetResults().GetColumns()); err != nil || rows == 0 {
+				return
+			}
+		}
+	}()
+	c.prefetch = p
+}
+
+// close stops the prefetching. A fetch already sent is left to finish in the background, the calls of the connection
+// are serialized so the next ones wait for it.
+func (p *prefetcher) close() {
+	close(p.stop)
+	p.cancel(errPrefetchStopped)
+}
+
+// stopPrefetch stops the prefetching of the cursor if it's in progress, discarding the batches not received yet
+func (c *Cursor) stopPrefetch() {
+	if c.prefetch != nil {
+		c.prefetch.close()
+		c.prefetch = nil
+	}
+}
+
+// receivePrefetched replaces the rows of the cursor with the next prefetched batch
+func (c *Cursor) receivePrefetched(ctx context.Context, n int) error {
+	if c.prefetch == nil {
+		c.startPrefetch(c.conn.configuration.PrefetchBatches)
+	}
+	var result prefetchResult
+	var ok bool
+	select {
+	case result, ok = <-c.prefetch.results:
+	case <-ctx.Done():
+		return errors.New("Context is done")
+	}
+	if !ok {
+		return errors.New("gohive: no more batches can be fetched after an error")
+	}
+	if result.err != nil {
+		// The next call fetches again, for example after reconnecting
+		c.fetchFailed = result.response == nil
+		c.stopPrefetch()
+		return c.fetchError(result.err, c.getFetchSize(), hiveserver.TFetchOrientation_FETCH_NEXT)
+	}
+	c.response = result.response
+	if safeStatus(result.response.GetStatus()).StatusCode != hiveserver.TStatusCode_SUCCESS_STATUS {
+		return errors.New(safeStatus(result.response.GetStatus()).String())
+	}
+	if err := c.parseResults(result.response); err != nil {
+		return err
+	}
+	if len(c.queue) < n {
+		return errors.Errorf("Only %d rows where received", len(c.queue))
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package gohive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestPrefetchBatches(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	configuration.FetchSize = 7
+	configuration.PrefetchBatches = 2
+	connection := connectFakeHiveServer(t, &operationHiveServer{rows: 1000}, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	for run := 0; run < 2; run++ {
+		cursor.Exec(context.Background(), "SELECT * FROM t")
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		var expected int32
+		for cursor.HasMore(context.Background()) {
+			var i int32
+			cursor.FetchOne(context.Background(), &i)
+			if cursor.Err != nil {
+				t.Fatal(cursor.Err)
+			}
+			if i != expected {
+				t.Fatalf("Expected %d, got %d", expected, i)
+			}
+			expected++
+			if run == 1 && expected == 100 {
+				// Closing the cursor in the middle of the result set stops the prefetching
+				break
+			}
+		}
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		if run == 0 && expected != 1000 {
+			t.Fatalf("Expected 1000 rows, got %d", expected)
+		}
+	}
+	cursor.Close()
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+}
+
+func TestPrefetchCanceled(t *testing.T) {
+	for _, defaultTimeout := range []time.Duration{0, 100 * time.Millisecond} {
+		server := &slowFetchHiveServer{operationHiveServer: operationHiveServer{rows: 100}, release: make(chan struct{}), answered: 1}
+		configuration := NewConnectConfiguration()
+		configuration.FetchSize = 10
+		configuration.PrefetchBatches = 2
+		configuration.DefaultTimeout = defaultTimeout
+		configuration.InterruptOnCancel = true
+		connection := connectFakeHiveServer(t, server, configuration)
+		defer connection.Close()
+		cursor := connection.Cursor()
+		cursor.Exec(context.Background(), "SELECT * FROM t")
+		if !cursor.HasMore(context.Background()) {
+			t.Fatal(cursor.Err)
+		}
+
+		if defaultTimeout > 0 {
+			// The wait for the second batch times out
+			var i int32
+			for cursor.HasMore(context.Background()) && cursor.Err == nil {
+				cursor.FetchOne(context.Background(), &i)
+			}
+			if cursor.Err == nil {
+				t.Fatal("Expected the prefetch to time out")
+			}
+			// The deadline of DefaultTimeout doesn't interrupt the fetch in progress, even with InterruptOnCancel,
+			// so the connection can be used once the server answers it
+			close(server.release)
+			other := connection.Cursor()
+			other.Exec(context.Background(), "SELECT 1")
+			if other.Err != nil {
+				t.Fatal(other.Err)
+			}
+			continue
+		}
+		// Closing the cursor stops the prefetching, the fetch already sent is left to finish instead of losing
+		// the connection
+		time.AfterFunc(100*time.Millisecond, func() {
+			close(server.release)
+		})
+		cursor.Close()
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		cursor.Exec(context.Background(), "SELECT * FROM t")
+		if cursor.Err != nil {
+			t.Fatalf("Expected the connection to be usable after closing the cursor, got %v", cursor.Err)
+		}
+	}
+}
+
+func TestMaxEmptyPolls(t *testing.T) {
+	// The batches without columns are polled again with and without prefetching
+	for _, prefetchBatches := range []int{0, 2} {
+		configuration := NewConnectConfiguration()
+		configuration.PollIntervalInMillis = 1
+		configuration.MaxEmptyPolls = 5
+		configuration.PrefetchBatches = prefetchBatches
+		server := &operationHiveServer{noColumns: true}
+		connection := connectFakeHiveServer(t, server, configuration)
+		cursor := connection.Cursor()
+		cursor.Exec(context.Background(), "SELECT * FROM t")
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		cursor.HasMore(context.Background())
+		if !errors.Is(cursor.Err, ErrTooManyEmptyPolls) {
+			t.Fatalf("Expected ErrTooManyEmptyPolls with %d prefetched batches, got %v", prefetchBatches, cursor.Err)
+		}
+		if server.fetches != 5 {
+			t.Fatalf("Expected 5 fetches with %d prefetched batches, got %d", prefetchBatches, server.fetches)
+		}
+		cursor.Close()
+		connection.Close()
+	}
+}
+
+func TestMaxEmptyPollsDefault(t *testing.T) {
+	// Without a deadline, the prefetching still gives up on a server that never sends columns
+	configuration := NewConnectConfiguration()
+	configuration.PollIntervalInMillis = 1
+	configuration.PrefetchBatches = 2
+	server := &operationHiveServer{noColumns: true}
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	cursor.HasMore(context.Background())
+	if !errors.Is(cursor.Err, ErrTooManyEmptyPolls) {
+		t.Fatalf("Expected ErrTooManyEmptyPolls, got %v", cursor.Err)
+	}
+	if server.fetches != DEFAULT_MAX_EMPTY_POLLS {
+		t.Fatalf("Expected %d fetches, got %d", DEFAULT_MAX_EMPTY_POLLS, server.fetches)
+	}
+}
+
+func TestPrefetchStoppedByScroll(t *testing.T) {
+	server := &scrollHiveServer{operationHiveServer: operationHiveServer{rows: 100, resultSet: true}}
+	server.status = &hiveserver.TStatus{StatusCode: hiveserver.TStatusCode_ERROR_STATUS, SqlState: thrift.StringPtr("HY106")}
+	configuration := NewConnectConfiguration()
+	configuration.FetchSize = 10
+	configuration.PrefetchBatches = 2
+	connection := connectFakeHiveServer(t, server, configuration)
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "SELECT * FROM t")
+	if !cursor.HasMore(context.Background()) || cursor.prefetch == nil {
+		t.Fatalf("Expected the batches to be prefetched, got %v", cursor.Err)
+	}
+
+	cursor.FetchPrior(context.Background())
+	if !errors.Is(cursor.Err, ErrScrollNotSupported) {
+		t.Fatalf("Expected ErrScrollNotSupported, got %v", cursor.Err)
+	}
+	if cursor.prefetch != nil {
+		t.Fatal("Expected FetchPrior to stop the prefetching")
+	}
+
+	// The next batch is prefetched again with FETCH_NEXT
+	for i := 0; i < 10; i++ {
+		var n int32
+		cursor.FetchOne(context.Background(), &n)
+	}
+	if !cursor.HasMore(context.Background()) || cursor.prefetch == nil {
+		t.Fatalf("Expected the batches to be prefetched, got %v", cursor.Err)
+	}
+	// The next fetch is sent with FETCH_FIRST instead of returning a batch prefetched with FETCH_NEXT
+	cursor.SetFetchOrientation(hiveserver.TFetchOrientation_FETCH_FIRST)
+	if cursor.prefetch != nil {
+		t.Fatal("Expected SetFetchOrientation to stop the prefetching")
+	}
+	for i := 0; i < 10; i++ {
+		var n int32
+		cursor.FetchOne(context.Background(), &n)
+	}
+	cursor.HasMore(context.Background())
+	if !errors.Is(cursor.Err, ErrScrollNotSupported) {
+		t.Fatalf("Expected the FETCH_FIRST fetch to be rejected, got %v", cursor.Err)
+	}
+}
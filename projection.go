@@ -0,0 +1,60 @@
+package gohive
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ProjectTo returns a function reordering the rows returned by RowSlice to the columns given, for code that expects
+// a fixed schema whatever the order of the SELECT. The columns are found in the Description by name, or by the name
+// without the table if it's unique, since HiveServer2 prefixes them with the table and the Spark Thrift server
+// doesn't. It fails if a column isn't in the result or matches several columns.
+//
+// The function can be used for all the rows of the result, it returns a new slice with the values of the columns.
+func (c *Cursor) ProjectTo(columns []string) (func(row []interface{}) []interface{}, error) {
+	description := c.Description()
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		index, err := findColumn(description, column)
+		if err != nil {
+			return nil, err
+		}
+		indexes[i] = index
+	}
+	return func(row []interface{}) []interface{} {
+		projected := make([]interface{}, len(indexes))
+		for i, index := range indexes {
+			if index < len(row) {
+				projected[i] = row[index]
+			}
+		}
+		return projected
+	}, nil
+}
+
+// findColumn returns the index of the column in the description, matching the name with or without the table
+func findColumn(description [][]string, column string) (int, error) {
+	for i, d := range description {
+		if d[0] == column {
+			return i, nil
+		}
+	}
+	index := -1
+	for i, d := range description {
+		if d[0][strings.LastIndex(d[0], ".")+1:] != column {
+			continue
+		}
+		if index >= 0 {
+			return 0, errors.Errorf("Column %s is ambiguous, it matches %s and %s", column, description[index][0], d[0])
+		}
+		index = i
+	}
+	if index < 0 {
+		return 0, errors.Errorf("Column %s isn't in the result", column)
+	}
+	return index, nil
+}
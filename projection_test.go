@@ -0,0 +1,33 @@
+package gohive
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProjectTo(t *testing.T) {
+	cursor := stringCursor(3)
+
+	project, err := cursor.ProjectTo([]string{"n", "t.s", "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor.RowSlice(context.Background())
+	row := cursor.RowSlice(context.Background())
+	if projected := project(row); !reflect.DeepEqual(projected, []interface{}{int32(1), "x", int32(1)}) {
+		t.Fatalf("Unexpected projection %v of %v", projected, row)
+	}
+
+	if _, err = cursor.ProjectTo([]string{"s", "missing"}); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("Expected an error for a missing column, got %v", err)
+	}
+	cursor.description = [][]string{{"a.id", "INT_TYPE"}, {"b.id", "INT_TYPE"}}
+	if _, err = cursor.ProjectTo([]string{"id"}); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Fatalf("Expected an error for an ambiguous column, got %v", err)
+	}
+	if _, err = cursor.ProjectTo([]string{"b.id"}); err != nil {
+		t.Fatalf("Expected the qualified name to be found, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package gohive
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+// FetchRaw returns the next row with each column as the bytes received from the server, without interpreting its type,
+// for proxies that forward the values. STRING backed types, like VARCHAR, DECIMAL, DATE, TIMESTAMP or the complex types,
+// are their text and BINARY its bytes. Booleans and numbers are written as text, like WriteCSV does. NULL is a nil slice.
+// The values of a row share one buffer owned by the caller. It returns io.EOF when there are no more rows, other errors
+// are also left in Err.
+func (c *Cursor) FetchRaw(ctx context.Context) ([][]byte, error) {
+	if !c.HasMore(ctx) {
+		if c.Err != nil {
+			return nil, c.Err
+		}
+		return nil, io.EOF
+	}
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	size := 0
+	for _, column := range c.queue {
+		size += rawSize(column, c.columnIndex)
+	}
+	buffer := make([]byte, 0, size)
+	row := make([][]byte, len(c.queue))
+	for i, column := range c.queue {
+		start := len(buffer)
+		var null bool
+		buffer, null = appendRaw(buffer, column, c.columnIndex)
+		if !null {
+			row[i] = buffer[start:len(buffer):len(buffer)]
+		}
+	}
+	c.consumeRows(c.columnIndex + 1)
+	return row, nil
+}
+
+// rawSize estimates the bytes appendRaw needs for the value, the buffer grows if it's short
+func rawSize(column *hiveserver.TColumn, position int) int {
+	if column.IsSetStringVal() && position < len(column.StringVal.Values) {
+		return len(column.StringVal.Values[position])
+	}
+	if column.IsSetBinaryVal() && position < len(column.BinaryVal.Values) {
+		return len(column.BinaryVal.Values[position])
+	}
+	return 20
+}
+
+// appendRaw appends the value of the column at position to b, it returns true for NULL values
+func appendRaw(b []byte, column *hiveserver.TColumn, position int) ([]byte, bool) {
+	switch v := columnValue(column, position).(type) {
+	case nil:
+		return b, true
+	case bool:
+		return strconv.AppendBool(b, v), false
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10), false
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10), false
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10), false
+	case int64:
+		return strconv.AppendInt(b, v, 10), false
+	case float64:
+		return strconv.AppendFloat(b, v, 'g', -1, 64), false
+	case string:
+		return append(b, v...), false
+	case []byte:
+		return append(b, v...), false
+	}
+	return b, true
+}
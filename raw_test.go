@@ -0,0 +1,42 @@
+package gohive
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestFetchRaw(t *testing.T) {
+	cursor := &Cursor{
+		conn:     &Connection{configuration: NewConnectConfiguration()},
+		response: &hiveserver.TFetchResultsResp{},
+		state:    _FINISHED,
+		queue: []*hiveserver.TColumn{
+			{I64Val: &hiveserver.TI64Column{Values: []int64{-7, 0}, Nulls: []byte{2}}},
+			{DoubleVal: &hiveserver.TDoubleColumn{Values: []float64{0.25, 1}, Nulls: []byte{}}},
+			{StringVal: &hiveserver.TStringColumn{Values: []string{"", "1.50"}, Nulls: []byte{}}},
+			{BinaryVal: &hiveserver.TBinaryColumn{Values: [][]byte{{0, 255}, nil}, Nulls: []byte{2}}},
+			{BoolVal: &hiveserver.TBoolColumn{Values: []bool{true, false}, Nulls: []byte{}}},
+		},
+		totalRows: 2,
+	}
+	expected := [][][]byte{
+		{[]byte("-7"), []byte("0.25"), {}, {0, 255}, []byte("true")},
+		{nil, []byte("1"), []byte("1.50"), nil, []byte("false")},
+	}
+	for i, row := range expected {
+		raw, err := cursor.FetchRaw(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(raw, row) {
+			t.Fatalf("Expected %q for row %d, got %q", row, i, raw)
+		}
+	}
+	if raw, err := cursor.FetchRaw(context.Background()); err != io.EOF {
+		t.Fatalf("Expected io.EOF after the last row, got %q, %v", raw, err)
+	}
+}
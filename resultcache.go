@@ -0,0 +1,124 @@
+package gohive
+
+import (
+	"container/list"
+	"context"
+	"maps"
+	"sync"
+	"time"
+)
+
+// resultCache keeps the rows of the last queries run with QueryMaps in a connection, by query text, for ResultCacheTTL
+type resultCache struct {
+	lock    sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type resultCacheEntry struct {
+	key     string
+	rows    []map[string]interface{}
+	expires time.Time
+}
+
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	return &resultCache{size: size, ttl: ttl, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (r *resultCache) get(key string) ([]map[string]interface{}, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	element, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*resultCacheEntry)
+	if time.Now().After(entry.expires) {
+		r.order.Remove(element)
+		delete(r.entries, key)
+		return nil, false
+	}
+	r.order.MoveToFront(element)
+	return entry.rows, true
+}
+
+func (r *resultCache) put(key string, rows []map[string]interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if element, ok := r.entries[key]; ok {
+		r.order.Remove(element)
+	}
+	r.entries[key] = r.order.PushFront(&resultCacheEntry{key: key, rows: rows, expires: time.Now().Add(r.ttl)})
+	if r.order.Len() > r.size {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*resultCacheEntry).key)
+	}
+}
+
+func (r *resultCache) clear() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.order.Init()
+	r.entries = make(map[string]*list.Element)
+}
+
+type bypassResultCacheKey struct{}
+
+// WithoutResultCache returns a context that makes QueryMaps run the query even if its rows are in the result cache,
+// the rows received replace the cached ones
+func WithoutResultCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassResultCacheKey{}, true)
+}
+
+// QueryMaps runs a query and returns all its rows as RowMap does. With ResultCacheSize and ResultCacheTTL set, the rows
+// of SELECT and the other read statements are kept by the exact text of the query, and returned without running it
+// again until they expire. The cache is cleared by any other statement executed in the connection, but not by the
+// changes done by other connections, so the rows can be up to ResultCacheTTL old.
+//
+// The maps returned are copies, they can be modified without changing the cached rows.
+func (c *Connection) QueryMaps(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	cache := c.resultCache
+	if cache != nil && !readStatements[statementType(query)] {
+		cache = nil
+	}
+	if cache != nil && ctx.Value(bypassResultCacheKey{}) == nil {
+		if rows, ok := cache.get(query); ok {
+			c.stats.resultCacheHits.Add(1)
+			return copyRows(rows), nil
+		}
+		c.stats.resultCacheMisses.Add(1)
+	}
+
+	cursor := c.Cursor()
+	defer cursor.Close()
+	cursor.Exec(ctx, query)
+	if cursor.Err != nil {
+		return nil, cursor.Err
+	}
+	rows := []map[string]interface{}{}
+	for cursor.HasMore(ctx) {
+		row := cursor.RowMap(ctx)
+		if cursor.Err != nil {
+			return nil, cursor.Err
+		}
+		rows = append(rows, row)
+	}
+	if cursor.Err != nil {
+		return nil, cursor.Err
+	}
+	if cache != nil {
+		cache.put(query, copyRows(rows))
+	}
+	return rows, nil
+}
+
+func copyRows(rows []map[string]interface{}) []map[string]interface{} {
+	copied := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied[i] = maps.Clone(row)
+	}
+	return copied
+}
@@ -0,0 +1,422 @@
+package gohive
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestDescribeGoTypes(t *testing.T) {
+	cursor := &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		description: [][]string{},
+		columns: []*hiveserver.TColumnDesc{
+			{ColumnName: "i", TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{
+				{PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: hiveserver.TTypeId_INT_TYPE}},
+			}}},
+			{ColumnName: "d", TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{
+				{PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: hiveserver.TTypeId_DECIMAL_TYPE}},
+			}}},
+			{ColumnName: "b", TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{
+				{PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: hiveserver.TTypeId_BINARY_TYPE}},
+			}}},
+			{ColumnName: "f", TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{
+				{PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{Type: hiveserver.TTypeId_FLOAT_TYPE}},
+			}}},
+			{ColumnName: "a", TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{
+				{ArrayEntry: &hiveserver.TArrayTypeEntry{}},
+			}}},
+		},
+	}
+	expected := []ColumnType{
+		{Name: "i", HiveType: "INT_TYPE", GoType: reflect.TypeOf(int32(0))},
+		{Name: "d", HiveType: "DECIMAL_TYPE", GoType: reflect.TypeOf("")},
+		{Name: "b", HiveType: "BINARY_TYPE", GoType: reflect.TypeOf([]byte(nil))},
+		{Name: "f", HiveType: "FLOAT_TYPE", GoType: reflect.TypeOf(float64(0))},
+		{Name: "a", HiveType: "ARRAY_TYPE", GoType: reflect.TypeOf("")},
+	}
+	if columns := cursor.Describe(); !reflect.DeepEqual(columns, expected) {
+		t.Fatalf("Expected %v, got %v", expected, columns)
+	}
+
+	cursor.conn.configuration.FloatAsFloat32 = true
+	expected[3].GoType = reflect.TypeOf(float32(0))
+	if columns := cursor.Describe(); !reflect.DeepEqual(columns, expected) {
+		t.Fatalf("Expected a float32 for the FLOAT column with FloatAsFloat32, got %v", columns)
+	}
+}
+
+// memoryCursor returns a cursor over rows of an INT and a BOOLEAN column without a server
+func memoryCursor(rows int) *Cursor {
+	ints := make([]int32, rows)
+	bools := make([]bool, rows)
+	for i := range ints {
+		ints[i] = int32(i)
+		bools[i] = i%2 == 0
+	}
+	return &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: [][]string{{"t.n", "INT_TYPE"}, {"t.b", "BOOLEAN_TYPE"}},
+		queue: []*hiveserver.TColumn{
+			{I32Val: &hiveserver.TI32Column{Values: ints, Nulls: []byte{}}},
+			{BoolVal: &hiveserver.TBoolColumn{Values: bools, Nulls: []byte{}}},
+		},
+		totalRows: rows,
+	}
+}
+
+func TestFetchInto(t *testing.T) {
+	cursor := memoryCursor(3)
+	dest := make([]interface{}, 2)
+	var rows [][]interface{}
+	for cursor.FetchInto(context.Background(), dest) {
+		rows = append(rows, []interface{}{dest[0], dest[1]})
+	}
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	expected := [][]interface{}{{int32(0), true}, {int32(1), false}, {int32(2), true}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected %v, got %v", expected, rows)
+	}
+
+	cursor = memoryCursor(1)
+	if cursor.FetchInto(context.Background(), make([]interface{}, 1)) || cursor.Err == nil {
+		t.Fatal("Expected an error for a destination with the wrong number of columns")
+	}
+}
+
+func TestFetchOneStruct(t *testing.T) {
+	type row struct {
+		N       int32
+		skipped string
+		B       *bool
+	}
+	cursor := memoryCursor(2)
+	var r row
+	cursor.FetchOne(context.Background(), &r)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if r.N != 0 || r.B == nil || !*r.B {
+		t.Fatalf("Expected 0 and true, got %v and %v", r.N, r.B)
+	}
+
+	var short struct{ N int32 }
+	cursor.FetchOne(context.Background(), &short)
+	if cursor.Err == nil || !strings.Contains(cursor.Err.Error(), "1 exported fields") {
+		t.Fatalf("Expected an error for a struct with fewer fields than columns, got %v", cursor.Err)
+	}
+	var wrong struct {
+		N string
+		B bool
+	}
+	cursor.FetchOne(context.Background(), &wrong)
+	if cursor.Err == nil || !strings.Contains(cursor.Err.Error(), "Unexpected data type *string") {
+		t.Fatalf("Expected an error for a field of the wrong type, got %v", cursor.Err)
+	}
+}
+
+func TestFetchOneUnion(t *testing.T) {
+	cursor := &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: [][]string{{"t.u", "UNION_TYPE"}},
+		queue: []*hiveserver.TColumn{
+			{StringVal: &hiveserver.TStringColumn{Values: []string{`{1:"a"}`}, Nulls: []byte{}}},
+		},
+		totalRows: 1,
+	}
+	// A Union is the value of the column, not a struct filled positionally
+	var u Union
+	cursor.FetchOne(context.Background(), &u)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if u != (Union{Tag: 1, Value: "a"}) {
+		t.Fatalf("Unexpected union %v", u)
+	}
+}
+
+func TestFloatAsFloat32(t *testing.T) {
+	floatCursor := func() *Cursor {
+		return &Cursor{
+			conn:        &Connection{configuration: NewConnectConfiguration()},
+			response:    &hiveserver.TFetchResultsResp{},
+			state:       _FINISHED,
+			description: [][]string{{"t.f", "FLOAT_TYPE"}, {"t.d", "DOUBLE_TYPE"}},
+			queue: []*hiveserver.TColumn{
+				{DoubleVal: &hiveserver.TDoubleColumn{Values: []float64{float64(float32(1.1)), 0}, Nulls: []byte{2}}},
+				{DoubleVal: &hiveserver.TDoubleColumn{Values: []float64{1.1, 2.2}, Nulls: []byte{}}},
+			},
+			totalRows: 2,
+		}
+	}
+
+	cursor := floatCursor()
+	if row := cursor.RowSlice(context.Background()); row[0] != float64(float32(1.1)) || row[1] != 1.1 {
+		t.Fatalf("Expected float64 values by default, got %#v", row)
+	}
+
+	cursor = floatCursor()
+	cursor.conn.configuration.FloatAsFloat32 = true
+	if row := cursor.RowSlice(context.Background()); row[0] != float32(1.1) || row[1] != 1.1 {
+		t.Fatalf("Expected a float32 for the FLOAT column, got %#v", row)
+	}
+	if row := cursor.RowMap(context.Background()); row["t.f"] != nil || row["t.d"] != 2.2 {
+		t.Fatalf("Expected a NULL FLOAT and a float64 DOUBLE, got %#v", row)
+	}
+
+	cursor = floatCursor()
+	var f float32
+	var d *float32
+	cursor.FetchOne(context.Background(), &f, &d)
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if f != 1.1 || d == nil || *d != float32(1.1) {
+		t.Fatalf("Expected 1.1 and 1.1, got %v and %v", f, d)
+	}
+	var p *float32
+	var e float64
+	cursor.FetchOne(context.Background(), &p, &e)
+	if cursor.Err != nil || p != nil || e != 2.2 {
+		t.Fatalf("Expected NULL and 2.2, got %v and %v (%v)", p, e, cursor.Err)
+	}
+}
+
+func TestRowMapMatchesRowSlice(t *testing.T) {
+	description := [][]string{
+		{"boolean", "BOOLEAN_TYPE"}, {"tinyint", "TINYINT_TYPE"}, {"smallint", "SMALLINT_TYPE"}, {"int", "INT_TYPE"},
+		{"bigint", "BIGINT_TYPE"}, {"float", "FLOAT_TYPE"}, {"double", "DOUBLE_TYPE"}, {"string", "STRING_TYPE"},
+		{"varchar", "VARCHAR_TYPE"}, {"timestamp", "TIMESTAMP_TYPE"}, {"date", "DATE_TYPE"}, {"binary", "BINARY_TYPE"},
+		{"array", "ARRAY_TYPE"}, {"map", "MAP_TYPE"}, {"struct", "STRUCT_TYPE"}, {"union", "UNION_TYPE"},
+		{"decimal", "DECIMAL_TYPE"}, {"interval", "INTERVAL_DAY_TIME_TYPE"},
+	}
+	// The second row is NULL in every column
+	strings := func(value string) *hiveserver.TColumn {
+		return &hiveserver.TColumn{StringVal: &hiveserver.TStringColumn{Values: []string{value, ""}, Nulls: []byte{2}}}
+	}
+	queue := []*hiveserver.TColumn{
+		{BoolVal: &hiveserver.TBoolColumn{Values: []bool{true, false}, Nulls: []byte{2}}},
+		{ByteVal: &hiveserver.TByteColumn{Values: []int8{1, 0}, Nulls: []byte{2}}},
+		{I16Val: &hiveserver.TI16Column{Values: []int16{2, 0}, Nulls: []byte{2}}},
+		{I32Val: &hiveserver.TI32Column{Values: []int32{3, 0}, Nulls: []byte{2}}},
+		{I64Val: &hiveserver.TI64Column{Values: []int64{4, 0}, Nulls: []byte{2}}},
+		{DoubleVal: &hiveserver.TDoubleColumn{Values: []float64{0.5, 0}, Nulls: []byte{2}}},
+		{DoubleVal: &hiveserver.TDoubleColumn{Values: []float64{0.25, 0}, Nulls: []byte{2}}},
+		strings("a string"), strings("a varchar"), strings("2024-01-02 03:04:05"), strings("2024-01-02"),
+		{BinaryVal: &hiveserver.TBinaryColumn{Values: [][]byte{[]byte("123"), nil}, Nulls: []byte{2}}},
+		strings("[1,2]"), strings(`{1:2}`), strings(`{"a":1}`), strings(`{0:1}`), strings("1.50"), strings("1 02:03:04.000000000"),
+	}
+	expected := []interface{}{true, int8(1), int16(2), int32(3), int64(4), 0.5, 0.25, "a string", "a varchar",
+		"2024-01-02 03:04:05", "2024-01-02", []byte("123"), "[1,2]", `{1:2}`, `{"a":1}`, `{0:1}`, "1.5", "1 02:03:04.000000000"}
+	newCursor := func() *Cursor {
+		return &Cursor{
+			conn:        &Connection{configuration: NewConnectConfiguration()},
+			response:    &hiveserver.TFetchResultsResp{},
+			state:       _FINISHED,
+			description: description,
+			queue:       queue,
+			totalRows:   2,
+		}
+	}
+
+	slices, maps := newCursor(), newCursor()
+	for row := 0; row < 2; row++ {
+		slice := slices.RowSlice(context.Background())
+		m := maps.RowMap(context.Background())
+		if slices.Err != nil || maps.Err != nil {
+			t.Fatal(slices.Err, maps.Err)
+		}
+		if len(m) != len(description) {
+			t.Fatalf("Expected a value per column, got %v", m)
+		}
+		for i, column := range description {
+			if !reflect.DeepEqual(slice[i], m[column[0]]) {
+				t.Errorf("RowSlice returned %#v and RowMap %#v for %s", slice[i], m[column[0]], column[0])
+			}
+			if row == 0 && !reflect.DeepEqual(slice[i], expected[i]) {
+				t.Errorf("Expected %#v for %s, got %#v", expected[i], column[0], slice[i])
+			}
+			if row == 1 && slice[i] != nil {
+				t.Errorf("Expected nil for the NULL %s, got %#v", column[0], slice[i])
+			}
+		}
+	}
+}
+
+func TestDecimalFormat(t *testing.T) {
+	scale := int32(3)
+	columns := []*hiveserver.TColumnDesc{{
+		ColumnName: "d",
+		TypeDesc: &hiveserver.TTypeDesc{Types: []*hiveserver.TTypeEntry{{PrimitiveEntry: &hiveserver.TPrimitiveTypeEntry{
+			Type: hiveserver.TTypeId_DECIMAL_TYPE,
+			TypeQualifiers: &hiveserver.TTypeQualifiers{Qualifiers: map[string]*hiveserver.TTypeQualifierValue{
+				hiveserver.SCALE: {I32Value: &scale},
+			}},
+		}}}},
+	}}
+	values := []string{"0.10", "1.000", "-2.5", "30", "0.12345"}
+	tests := []struct {
+		format   DecimalFormat
+		expected []interface{}
+	}{
+		{DecimalTrim, []interface{}{"0.1", "1", "-2.5", "30", "0.12345"}},
+		{DecimalAsIs, []interface{}{"0.10", "1.000", "-2.5", "30", "0.12345"}},
+		{DecimalFixedScale, []interface{}{"0.100", "1.000", "-2.500", "30.000", "0.123"}},
+	}
+	for _, test := range tests {
+		configuration := NewConnectConfiguration()
+		configuration.DecimalFormat = test.format
+		newCursor := func() *Cursor {
+			return &Cursor{
+				conn:        &Connection{configuration: configuration},
+				response:    &hiveserver.TFetchResultsResp{},
+				state:       _FINISHED,
+				description: [][]string{{"d", "DECIMAL_TYPE"}},
+				columns:     columns,
+				queue:       []*hiveserver.TColumn{{StringVal: &hiveserver.TStringColumn{Values: values, Nulls: []byte{}}}},
+				totalRows:   len(values),
+			}
+		}
+		slices, maps, bound := newCursor(), newCursor(), newCursor()
+		if err := bound.Bind([]reflect.Type{reflect.TypeOf("")}); err != nil {
+			t.Fatal(err)
+		}
+		dest := make([]interface{}, 1)
+		for i, expected := range test.expected {
+			if value := slices.RowSlice(context.Background()); slices.Err != nil || value[0] != expected {
+				t.Errorf("Expected %v from RowSlice with the format %d, got %v, %v", expected, test.format, value, slices.Err)
+			}
+			if value := maps.RowMap(context.Background()); maps.Err != nil || value["d"] != expected {
+				t.Errorf("Expected %v from RowMap with the format %d, got %v, %v", expected, test.format, value, maps.Err)
+			}
+			if !bound.FetchInto(context.Background(), dest) || *dest[0].(*string) != expected {
+				t.Errorf("Expected %v from FetchInto with the format %d for %s, got %v", expected, test.format, values[i], bound.Err)
+			}
+		}
+	}
+}
+
+// BenchmarkRowSlice, BenchmarkFetchInto and BenchmarkFetchIntoBound compare the allocations per row, FetchInto saves
+// the slice of the row and Bind the boxing of the values
+func BenchmarkRowSlice(b *testing.B) {
+	cursor := memoryCursor(b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cursor.RowSlice(context.Background())
+	}
+}
+
+func BenchmarkFetchInto(b *testing.B) {
+	cursor := memoryCursor(b.N)
+	dest := make([]interface{}, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cursor.FetchInto(context.Background(), dest)
+	}
+}
+
+func BenchmarkFetchIntoBound(b *testing.B) {
+	cursor := memoryCursor(b.N)
+	cursor.Bind([]reflect.Type{reflect.TypeOf(int32(0)), reflect.TypeOf(false)})
+	dest := make([]interface{}, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cursor.FetchInto(context.Background(), dest)
+	}
+}
+
+func TestBind(t *testing.T) {
+	cursor := memoryCursor(3)
+	cursor.queue[0].I32Val.Nulls = []byte{2}
+	if err := cursor.Bind([]reflect.Type{reflect.TypeOf(int32(0)), reflect.TypeOf(false)}); err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]interface{}, 2)
+	var rows [][]interface{}
+	var pointers []interface{}
+	for cursor.FetchInto(context.Background(), dest) {
+		row := make([]interface{}, 2)
+		for i, value := range dest {
+			switch value := value.(type) {
+			case *int32:
+				row[i] = *value
+			case *bool:
+				row[i] = *value
+			}
+		}
+		rows = append(rows, row)
+		pointers = append(pointers, dest[1])
+	}
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	expected := [][]interface{}{{int32(0), true}, {nil, false}, {int32(2), true}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected %v, got %v", expected, rows)
+	}
+	if pointers[0] != pointers[2] {
+		t.Fatal("Expected the buffers to be reused for every row")
+	}
+
+	cursor = memoryCursor(3)
+	cursor.Bind([]reflect.Type{reflect.TypeOf(int64(0)), reflect.TypeOf(false)})
+	if cursor.FetchInto(context.Background(), dest) || cursor.Err == nil || !strings.Contains(cursor.Err.Error(), "bound to int64 instead of int32") {
+		t.Fatalf("Expected an error for a column bound to the wrong type, got %v", cursor.Err)
+	}
+	cursor.Bind([]reflect.Type{reflect.TypeOf(int32(0))})
+	if cursor.FetchInto(context.Background(), dest) || cursor.Err == nil {
+		t.Fatal("Expected an error for a wrong number of types")
+	}
+	if err := cursor.Bind([]reflect.Type{reflect.TypeOf(int(0)), reflect.TypeOf(false)}); err == nil {
+		t.Fatal("Expected an error for a type that isn't the one of a column")
+	}
+	cursor.Bind(nil)
+	if !cursor.FetchInto(context.Background(), dest) || dest[0] != int32(0) {
+		t.Fatalf("Expected the values after unbinding, got %v (%v)", dest, cursor.Err)
+	}
+}
+
+func TestFetchOneNullable(t *testing.T) {
+	cursor := &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: [][]string{{"t.n", "SMALLINT_TYPE"}, {"t.s", "STRING_TYPE"}},
+		queue: []*hiveserver.TColumn{
+			{I16Val: &hiveserver.TI16Column{Values: []int16{0, 7}, Nulls: []byte{1}}},
+			{StringVal: &hiveserver.TStringColumn{Values: []string{"", "a"}, Nulls: []byte{1}}},
+		},
+		totalRows: 2,
+	}
+	var n sql.NullInt64
+	var s string
+	if cursor.FetchOneNullable(context.Background(), &n); cursor.Err == nil {
+		t.Fatal("Expected an error for the wrong number of destinations")
+	}
+	expected := [][]bool{{true, true}, {false, false}}
+	for row := 0; row < 2; row++ {
+		nulls := cursor.FetchOneNullable(context.Background(), &n, &s)
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		if !reflect.DeepEqual(nulls, expected[row]) || n.Valid == nulls[0] {
+			t.Fatalf("Expected the nulls %v, got %v and %v", expected[row], nulls, n)
+		}
+	}
+	if n.Int64 != 7 || s != "a" || cursor.RowsFetched() != 2 {
+		t.Fatalf("Unexpected values %v and %s after %d rows", n, s, cursor.RowsFetched())
+	}
+}
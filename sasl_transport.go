@@ -6,6 +6,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 
 	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/beltran/gosasl"
@@ -20,10 +22,57 @@ const (
 	COMPLETE = 5
 )
 
+// ErrFrameTooBig is the cause of the errors of the responses received in a SASL frame bigger than MaxSize
+var ErrFrameTooBig = errors.New("gohive: the SASL frame is bigger than MaxSize")
+
+// frameSizeError is the error of a frame bigger than the maximum length, its cause is ErrFrameTooBig
+type frameSizeError struct {
+	size      uint32
+	maxLength uint32
+}
+
+func (e *frameSizeError) Error() string {
+	return fmt.Sprintf("Frame size (%d) is bigger than the maximum allowed (%d), increase ConnectConfiguration.MaxSize: %s", e.size, e.maxLength, ErrFrameTooBig)
+}
+
+func (e *frameSizeError) Unwrap() error {
+	return ErrFrameTooBig
+}
+
+// SASLMechanism is the client side of a SASL mechanism implemented outside of the library, for example a mechanism
+// of the cluster not supported by gosasl. See ConnectConfiguration.NewSASLMechanism.
+type SASLMechanism interface {
+	// Name of the mechanism, sent to the server to start the negotiation
+	Name() string
+	// Start returns the initial response, sent with the name
+	Start() ([]byte, error)
+	// Step returns the response to a challenge of the server
+	Step(challenge []byte) ([]byte, error)
+	// Complete returns whether the negotiation finished on the client side. The server completing it before is an
+	// error.
+	Complete() bool
+	// Encode wraps the data sent and Decode unwraps the data received with the security layer negotiated, they
+	// return it as is without one
+	Encode(outgoing []byte) ([]byte, error)
+	Decode(incoming []byte) ([]byte, error)
+	// Dispose releases the resources of the mechanism when the transport is closed
+	Dispose()
+}
+
+// saslClient is the mechanism of a TSaslTransport, a gosasl client or a SASLMechanism
+type saslClient interface {
+	Start() ([]byte, error)
+	Step(challenge []byte) ([]byte, error)
+	Complete() bool
+	Encode(outgoing []byte) ([]byte, error)
+	Decode(incoming []byte) ([]byte, error)
+	Dispose()
+}
+
 // TSaslTransport is a tranport thrift struct that uses SASL
 type TSaslTransport struct {
 	service        string
-	saslClient     *gosasl.Client
+	saslClient     saslClient
 	tp             thrift.TTransport
 	tpFramed       thrift.TFramedTransport
 	mechanism      string
@@ -33,6 +82,7 @@ type TSaslTransport struct {
 	rawFrameSize   uint32 //Current remaining size of the frame. if ==0 read next frame header
 	frameSize      int    //Current remaining size of the frame. if ==0 read next frame header
 	maxLength      uint32
+	peerMaxLength  uint32 //Maximum frame size accepted by the server, 0 if it wasn't advertised
 	principal      string
 	OpeningContext context.Context
 }
@@ -50,10 +100,18 @@ func NewTSaslTransport(trans thrift.TTransport, host string, mechanismName strin
 		}
 	} else if mechanismName == "DIGEST-MD5" {
 		mechanism = gosasl.NewDigestMD5Mechanism(configuration["service"], configuration["username"], configuration["password"])
+	} else if mechanismName == "CRAM-MD5" {
+		mechanism = gosasl.NewCramMD5Mechanism(configuration["username"], configuration["password"])
+	} else if mechanismName == "ANONYMOUS" {
+		mechanism = gosasl.NewAnonymousMechanism()
 	} else {
-		panic("Mechanism not supported")
+		return nil, errors.Errorf("SASL mechanism %s is not supported", mechanismName)
 	}
 	client := gosasl.NewSaslClient(host, mechanism)
+	// The identity to act as, if it's different from the authenticated one
+	if authzid := configuration["authzid"]; authzid != "" {
+		client.GetConfig().AuthorizationID = authzid
+	}
 	return &TSaslTransport{
 		saslClient:     client,
 		tp:             trans,
@@ -64,6 +122,17 @@ func NewTSaslTransport(trans thrift.TTransport, host string, mechanismName strin
 	}, nil
 }
 
+// NewTSaslTransportMechanism returns a TSaslTransport negotiating the mechanism
+func NewTSaslTransportMechanism(trans thrift.TTransport, mechanism SASLMechanism, maxLength uint32) *TSaslTransport {
+	return &TSaslTransport{
+		saslClient:     mechanism,
+		tp:             trans,
+		mechanism:      mechanism.Name(),
+		maxLength:      maxLength,
+		OpeningContext: context.Background(),
+	}
+}
+
 // IsOpen opens a SASL connection
 func (p *TSaslTransport) IsOpen() bool {
 	return p.tp.IsOpen() && p.saslClient.Complete()
@@ -93,6 +162,9 @@ func (p *TSaslTransport) Open() (err error) {
 	for true {
 		status, challenge := p.recvSaslMsg(p.OpeningContext)
 		if status == OK {
+			if maxLength := parseSaslMaxBuf(challenge); maxLength > 0 {
+				p.peerMaxLength = maxLength
+			}
 			proccessed, err = p.saslClient.Step(challenge)
 			if err != nil {
 				return
@@ -207,7 +279,7 @@ func (p *TSaslTransport) readFrameHeader() (uint32, error) {
 		return 0, thrift.NewTTransportException(thrift.UNKNOWN_TRANSPORT_EXCEPTION, fmt.Sprintf("Incorrect frame size (%d)", size))
 	}
 	if size > p.maxLength {
-		return 0, thrift.NewTTransportException(thrift.UNKNOWN_TRANSPORT_EXCEPTION, fmt.Sprintf("Frame size is bigger than allowed, set configuration.MaxLength (%d)", size))
+		return 0, thrift.NewTTransportExceptionFromError(&frameSizeError{size: size, maxLength: p.maxLength})
 	}
 	return size, nil
 }
@@ -227,6 +299,9 @@ func (p *TSaslTransport) Flush(ctx context.Context) (err error) {
 	p.writeBuf.Reset()
 
 	size := len(wrappedBuf)
+	if p.peerMaxLength > 0 && uint32(size) > p.peerMaxLength {
+		return thrift.NewTTransportException(thrift.UNKNOWN_TRANSPORT_EXCEPTION, fmt.Sprintf("Frame size (%d) is bigger than the maximum accepted by the server (%d)", size, p.peerMaxLength))
+	}
 	buf := p.buffer[:4]
 	binary.BigEndian.PutUint32(buf, uint32(size))
 	_, err = p.tp.Write(buf)
@@ -249,6 +324,23 @@ func (p *TSaslTransport) RemainingBytes() uint64 {
 	return uint64(p.frameSize)
 }
 
+// parseSaslMaxBuf returns the maxbuf directive of a DIGEST-MD5 challenge, the maximum frame size the server accepts.
+// Other mechanisms negotiate it inside their security layer and 0 is returned for them.
+func parseSaslMaxBuf(challenge []byte) uint32 {
+	for _, directive := range strings.Split(string(challenge), ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(directive), "=")
+		if !found || key != "maxbuf" {
+			continue
+		}
+		maxLength, err := strconv.ParseUint(strings.Trim(value, `"`), 10, 32)
+		if err != nil {
+			return 0
+		}
+		return uint32(maxLength)
+	}
+	return 0
+}
+
 // SetMaxLength set the maxLength
 func (p *TSaslTransport) SetMaxLength(maxLength uint32) {
 	p.maxLength = maxLength
@@ -1,11 +1,17 @@
 package gohive
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"io"
+	"net"
+	"strings"
 	"testing"
 
 	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
 )
 
 func TestSaslTransport(t *testing.T) {
@@ -117,3 +123,175 @@ func TransportTest(t *testing.T, writeTrans thrift.TTransport, readTrans thrift.
 		}
 	}
 }
+
+func TestSaslTransportMechanisms(t *testing.T) {
+	configuration := map[string]string{
+		"username": "user",
+		"password": "pass",
+	}
+	for _, mechanism := range []string{"PLAIN", "DIGEST-MD5", "CRAM-MD5", "ANONYMOUS"} {
+		trans, err := NewTSaslTransport(thrift.NewTMemoryBuffer(), "localhost", mechanism, configuration, DEFAULT_MAX_LENGTH)
+		if err != nil {
+			t.Fatalf("Error creating transport with %s: %v", mechanism, err)
+		}
+		if trans.mechanism != mechanism {
+			t.Fatalf("Expected mechanism %s, got %s", mechanism, trans.mechanism)
+		}
+	}
+	_, err := NewTSaslTransport(thrift.NewTMemoryBuffer(), "localhost", "UNKNOWN", configuration, DEFAULT_MAX_LENGTH)
+	if err == nil {
+		t.Fatal("Expected an error for an unknown mechanism")
+	}
+}
+
+func TestParseSaslMaxBuf(t *testing.T) {
+	challenge := []byte(`realm="example.com",nonce="abc",qop="auth-conf",maxbuf=65536,charset=utf-8,algorithm=md5-sess`)
+	if maxLength := parseSaslMaxBuf(challenge); maxLength != 65536 {
+		t.Fatalf("Expected 65536, got %d", maxLength)
+	}
+	if maxLength := parseSaslMaxBuf([]byte("token")); maxLength != 0 {
+		t.Fatalf("Expected 0, got %d", maxLength)
+	}
+}
+
+func TestSaslTransportFrameTooBig(t *testing.T) {
+	socket := thrift.NewTMemoryBuffer()
+	trans, err := NewTSaslTransport(socket, "localhost", "PLAIN", map[string]string{"username": "user"}, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], 2048)
+	socket.Write(header[:])
+	_, err = trans.Read(make([]byte, 16))
+	if err == nil || !strings.Contains(err.Error(), "MaxSize") {
+		t.Fatalf("Expected an error suggesting to increase MaxSize, got %v", err)
+	}
+	if !errors.Is(err, ErrFrameTooBig) {
+		t.Fatalf("Expected ErrFrameTooBig, got %v", err)
+	}
+
+	cursor := &Cursor{conn: &Connection{configuration: &ConnectConfiguration{MaxSize: 1024}}, rowsFetched: 200}
+	message := cursor.fetchError(err, 1000, hiveserver.TFetchOrientation_FETCH_NEXT).Error()
+	for _, expected := range []string{"1000 rows", "at row 201", "2048 bytes", "MaxSize (1024)", "FetchSize"} {
+		if !strings.Contains(message, expected) {
+			t.Fatalf("Expected the error to contain %q, got %s", expected, message)
+		}
+	}
+	if message := cursor.fetchError(err, 1, hiveserver.TFetchOrientation_FETCH_PRIOR).Error(); strings.Contains(message, "FetchSize") || strings.Contains(message, "at row") || !strings.Contains(message, "The row") {
+		t.Fatalf("Expected the error to point to a single row at an unknown position, got %s", message)
+	}
+	if other := io.ErrUnexpectedEOF; cursor.fetchError(other, 1000, hiveserver.TFetchOrientation_FETCH_NEXT) != other {
+		t.Fatal("Expected other errors to be kept")
+	}
+}
+
+func TestSaslTransportAuthorizationID(t *testing.T) {
+	configuration := map[string]string{
+		"username": "user",
+		"password": "pass",
+		"authzid":  "admin",
+	}
+	trans, err := NewTSaslTransport(thrift.NewTMemoryBuffer(), "localhost", "PLAIN", configuration, DEFAULT_MAX_LENGTH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := trans.saslClient.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(response) != "admin\x00user\x00pass" {
+		t.Fatalf("Unexpected PLAIN response %q", response)
+	}
+}
+
+// xorMechanism is a SASL mechanism with a security layer xoring the data with a key
+type xorMechanism struct {
+	key      byte
+	complete bool
+	disposed bool
+}
+
+func (m *xorMechanism) Name() string {
+	return "XOR"
+}
+
+func (m *xorMechanism) Start() ([]byte, error) {
+	m.complete = true
+	return []byte("token"), nil
+}
+
+func (m *xorMechanism) Step(challenge []byte) ([]byte, error) {
+	return nil, errors.New("unexpected challenge")
+}
+
+func (m *xorMechanism) Complete() bool {
+	return m.complete
+}
+
+func (m *xorMechanism) Encode(outgoing []byte) ([]byte, error) {
+	encoded := make([]byte, len(outgoing))
+	for i, b := range outgoing {
+		encoded[i] = b ^ m.key
+	}
+	return encoded, nil
+}
+
+func (m *xorMechanism) Decode(incoming []byte) ([]byte, error) {
+	return m.Encode(incoming)
+}
+
+func (m *xorMechanism) Dispose() {
+	m.disposed = true
+}
+
+func TestSaslTransportCustomMechanism(t *testing.T) {
+	setup()
+	socket := thrift.NewTMemoryBuffer()
+	// The server completes the negotiation
+	socket.Write([]byte{COMPLETE, 0, 0, 0, 0})
+	mechanism := &xorMechanism{key: 0x55}
+	trans := NewTSaslTransportMechanism(socket, mechanism, DEFAULT_MAX_LENGTH)
+	if err := trans.Open(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{START, 0, 0, 0, 3, 'X', 'O', 'R', OK, 0, 0, 0, 5, 't', 'o', 'k', 'e', 'n'}
+	if sent := socket.Bytes(); !bytes.Equal(sent, expected) {
+		t.Fatalf("Expected the name and the initial response of the mechanism, got %q", sent)
+	}
+	socket.Reset()
+
+	trans.Write([]byte("data"))
+	trans.Flush(context.Background())
+	if frame := socket.Bytes(); !bytes.Equal(frame[4:], []byte{'d' ^ 0x55, 'a' ^ 0x55, 't' ^ 0x55, 'a' ^ 0x55}) {
+		t.Fatalf("Expected the data to be encoded by the mechanism, got %q", frame)
+	}
+	socket.Reset()
+	TransportTest(t, trans, trans)
+	trans.Close()
+	if !mechanism.disposed {
+		t.Fatal("Expected the mechanism to be disposed")
+	}
+}
+
+func TestNewSASLMechanismError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	configuration := NewConnectConfiguration()
+	mechanismErr := errors.New("no token")
+	var hosts []string
+	configuration.NewSASLMechanism = func(host string) (SASLMechanism, error) {
+		hosts = append(hosts, host)
+		return nil, mechanismErr
+	}
+	address := listener.Addr().(*net.TCPAddr)
+	if _, err = Connect("127.0.0.1", address.Port, "CUSTOM", configuration); !errors.Is(err, mechanismErr) {
+		t.Fatalf("Expected the error of NewSASLMechanism, got %v", err)
+	}
+	if len(hosts) != 1 || hosts[0] != "127.0.0.1" {
+		t.Fatalf("Expected NewSASLMechanism to be called with the host, got %v", hosts)
+	}
+}
@@ -0,0 +1,79 @@
+package gohive
+
+import (
+	"sync/atomic"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+// Stats is a snapshot of the activity of a connection
+type Stats struct {
+	// Number of statements successfully submitted
+	QueriesExecuted int64
+	// Number of FetchResults requests done for reading rows
+	FetchRoundTrips int64
+	// Number of rows received
+	RowsReturned int64
+	// Approximate size in bytes of the values received
+	BytesDecoded int64
+	// Number of QueryMaps calls answered from the result cache, and the ones that ran the query as it wasn't there
+	ResultCacheHits   int64
+	ResultCacheMisses int64
+}
+
+type connectionStats struct {
+	queriesExecuted   atomic.Int64
+	fetchRoundTrips   atomic.Int64
+	rowsReturned      atomic.Int64
+	bytesDecoded      atomic.Int64
+	resultCacheHits   atomic.Int64
+	resultCacheMisses atomic.Int64
+}
+
+// Stats returns a snapshot of the counters of the connection. It's safe to call it concurrently.
+func (c *Connection) Stats() Stats {
+	return Stats{
+		QueriesExecuted:   c.stats.queriesExecuted.Load(),
+		FetchRoundTrips:   c.stats.fetchRoundTrips.Load(),
+		RowsReturned:      c.stats.rowsReturned.Load(),
+		BytesDecoded:      c.stats.bytesDecoded.Load(),
+		ResultCacheHits:   c.stats.resultCacheHits.Load(),
+		ResultCacheMisses: c.stats.resultCacheMisses.Load(),
+	}
+}
+
+func (s *connectionStats) addFetch(rows int, columns []*hiveserver.TColumn) {
+	s.fetchRoundTrips.Add(1)
+	s.rowsReturned.Add(int64(rows))
+	s.bytesDecoded.Add(columnsSize(columns))
+}
+
+// columnsSize approximates the size of the values in the columns, including the null bitmaps
+func columnsSize(columns []*hiveserver.TColumn) (size int64) {
+	for _, column := range columns {
+		if column.IsSetBoolVal() {
+			size += int64(len(column.BoolVal.Values) + len(column.BoolVal.Nulls))
+		} else if column.IsSetByteVal() {
+			size += int64(len(column.ByteVal.Values) + len(column.ByteVal.Nulls))
+		} else if column.IsSetI16Val() {
+			size += int64(2*len(column.I16Val.Values) + len(column.I16Val.Nulls))
+		} else if column.IsSetI32Val() {
+			size += int64(4*len(column.I32Val.Values) + len(column.I32Val.Nulls))
+		} else if column.IsSetI64Val() {
+			size += int64(8*len(column.I64Val.Values) + len(column.I64Val.Nulls))
+		} else if column.IsSetDoubleVal() {
+			size += int64(8*len(column.DoubleVal.Values) + len(column.DoubleVal.Nulls))
+		} else if column.IsSetStringVal() {
+			for _, value := range column.StringVal.Values {
+				size += int64(len(value))
+			}
+			size += int64(len(column.StringVal.Nulls))
+		} else if column.IsSetBinaryVal() {
+			for _, value := range column.BinaryVal.Values {
+				size += int64(len(value))
+			}
+			size += int64(len(column.BinaryVal.Nulls))
+		}
+	}
+	return
+}
@@ -0,0 +1,26 @@
+package gohive
+
+import (
+	"testing"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestStats(t *testing.T) {
+	columns := []*hiveserver.TColumn{
+		{I32Val: &hiveserver.TI32Column{Values: []int32{1, 2, 3}, Nulls: []byte{0}}},
+		{StringVal: &hiveserver.TStringColumn{Values: []string{"a", "bc", ""}, Nulls: []byte{4}}},
+	}
+	if size := columnsSize(columns); size != 3*4+1+3+1 {
+		t.Fatalf("Unexpected size: %d", size)
+	}
+
+	connection := &Connection{}
+	connection.stats.queriesExecuted.Add(1)
+	connection.stats.addFetch(3, columns)
+	connection.stats.addFetch(0, nil)
+	expected := Stats{QueriesExecuted: 1, FetchRoundTrips: 2, RowsReturned: 3, BytesDecoded: 17}
+	if stats := connection.Stats(); stats != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, stats)
+	}
+}
@@ -0,0 +1,50 @@
+package gohive
+
+import (
+	"github.com/pkg/errors"
+)
+
+// StringBatch is a view of the values of a STRING backed column in the rows of the current batch not read yet
+type StringBatch struct {
+	// Values of the rows, the ones of NULL values are empty strings
+	Values []string
+	nulls  []byte
+	offset int
+}
+
+// IsNull returns whether the value at i in Values is NULL
+func (b StringBatch) IsNull(i int) bool {
+	return isNull(b.nulls, b.offset+i)
+}
+
+// StringColumn returns the values of the column at index for the rows of the current batch that haven't been read,
+// without copying them. The column must be carried as strings: STRING, VARCHAR, CHAR, DECIMAL, DATE, TIMESTAMP,
+// INTERVAL or a complex type. It doesn't fetch nor advance the cursor, HasMore fetches the next batch and SkipBatch
+// marks the rows as read, so several columns of the batch can be accessed.
+//
+// Values aliases the batch received from the server, which the other accessors also read, so it must not be
+// modified. It's only guaranteed to hold the values until the next fetch, and retaining it keeps the whole batch
+// in memory, copy the values that are kept.
+func (c *Cursor) StringColumn(index int) (StringBatch, error) {
+	if index < 0 || index >= len(c.queue) {
+		return StringBatch{}, errors.Errorf("Column %d doesn't exist, the result has %d columns", index, len(c.queue))
+	}
+	column := c.queue[index]
+	if !column.IsSetStringVal() {
+		return StringBatch{}, errors.Errorf("Column %d isn't a string column", index)
+	}
+	start := min(c.columnIndex, c.totalRows)
+	return StringBatch{
+		Values: column.StringVal.Values[start:c.totalRows:c.totalRows],
+		nulls:  column.StringVal.Nulls,
+		offset: start,
+	}, nil
+}
+
+// SkipBatch marks the rows of the current batch not read yet as read, for example after StringColumn.
+// The next HasMore fetches the following batch.
+func (c *Cursor) SkipBatch() {
+	if c.columnIndex < c.totalRows {
+		c.consumeRows(c.totalRows)
+	}
+}
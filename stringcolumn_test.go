@@ -0,0 +1,100 @@
+package gohive
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+// stringCursor returns a cursor with a batch of rows in memory, a STRING column and an INT one
+func stringCursor(rows int) *Cursor {
+	values := make([]string, rows)
+	ints := make([]int32, rows)
+	for i := range values {
+		values[i] = strings.Repeat("x", i%16)
+		ints[i] = int32(i)
+	}
+	return &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: [][]string{{"t.s", "STRING_TYPE"}, {"t.n", "INT_TYPE"}},
+		queue: []*hiveserver.TColumn{
+			{StringVal: &hiveserver.TStringColumn{Values: values, Nulls: []byte{}}},
+			{I32Val: &hiveserver.TI32Column{Values: ints, Nulls: []byte{}}},
+		},
+		totalRows: rows,
+	}
+}
+
+func TestStringColumn(t *testing.T) {
+	cursor := stringCursor(4)
+	cursor.queue[0].StringVal.Values[2] = ""
+	cursor.queue[0].StringVal.Nulls = []byte{4}
+	cursor.RowSlice(context.Background())
+
+	batch, err := cursor.StringColumn(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(batch.Values, []string{"x", "", "xxx"}) {
+		t.Fatalf("Expected the unread rows, got %q", batch.Values)
+	}
+	if batch.IsNull(0) || !batch.IsNull(1) || batch.IsNull(2) {
+		t.Fatal("Expected only the second value to be NULL")
+	}
+	if _, err = cursor.StringColumn(1); err == nil {
+		t.Fatal("Expected an error for an INT column")
+	}
+	if _, err = cursor.StringColumn(2); err == nil {
+		t.Fatal("Expected an error for a column out of range")
+	}
+
+	cursor.SkipBatch()
+	if cursor.Buffered() != 0 || cursor.RowsFetched() != 4 {
+		t.Fatalf("Expected the batch to be read, got %d buffered rows and %d read", cursor.Buffered(), cursor.RowsFetched())
+	}
+	if batch, _ = cursor.StringColumn(0); len(batch.Values) != 0 {
+		t.Fatalf("Expected no values after SkipBatch, got %q", batch.Values)
+	}
+}
+
+// BenchmarkStringColumn and BenchmarkStringFetchOne compare summing the lengths of a string column in a batch of
+// 1024 rows
+func BenchmarkStringColumn(b *testing.B) {
+	cursor := stringCursor(1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	total := 0
+	for i := 0; i < b.N; i++ {
+		cursor.columnIndex = 0
+		batch, _ := cursor.StringColumn(0)
+		for j, value := range batch.Values {
+			if !batch.IsNull(j) {
+				total += len(value)
+			}
+		}
+		cursor.SkipBatch()
+	}
+	b.ReportMetric(float64(total)/float64(b.N), "bytes/batch")
+}
+
+func BenchmarkStringFetchOne(b *testing.B) {
+	cursor := stringCursor(1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var s string
+	var n int32
+	total := 0
+	for i := 0; i < b.N; i++ {
+		cursor.columnIndex = 0
+		for j := 0; j < 1024; j++ {
+			cursor.FetchOne(context.Background(), &s, &n)
+			total += len(s)
+		}
+	}
+	b.ReportMetric(float64(total)/float64(b.N), "bytes/batch")
+}
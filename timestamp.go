@@ -0,0 +1,48 @@
+package gohive
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ParseTimestamp parses the text of a TIMESTAMP value, as returned by RowMap, RowSlice and FetchOne, in loc, UTC if it's nil.
+// The server sends yyyy-mm-dd hh:mm:ss followed by a fraction of 0 to 9 digits, all of them are kept in the nanoseconds.
+// TIMESTAMP WITH LOCAL TIME ZONE values end with the name of the time zone, which is used instead of loc.
+func ParseTimestamp(s string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	parts := strings.SplitN(s, " ", 3)
+	if len(parts) < 2 {
+		return time.Time{}, errors.Errorf("Invalid timestamp %q", s)
+	}
+	if len(parts) == 3 {
+		var err error
+		if loc, err = time.LoadLocation(parts[2]); err != nil {
+			return time.Time{}, errors.Wrapf(err, "Invalid time zone of timestamp %q", s)
+		}
+	}
+	clock, fraction, _ := strings.Cut(parts[1], ".")
+	if len(fraction) > 9 {
+		return time.Time{}, errors.Errorf("Invalid timestamp %q, the fraction has more than 9 digits", s)
+	}
+	nanoseconds := 0
+	if fraction != "" {
+		n, err := strconv.ParseUint(fraction, 10, 32)
+		if err != nil {
+			return time.Time{}, errors.Errorf("Invalid fraction of timestamp %q", s)
+		}
+		nanoseconds = int(n)
+		for i := len(fraction); i < 9; i++ {
+			nanoseconds *= 10
+		}
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", parts[0]+" "+clock, loc)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "Invalid timestamp %q", s)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), nanoseconds, loc), nil
+}
@@ -0,0 +1,87 @@
+package gohive
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := map[string]time.Time{
+		"2024-02-29 13:14:15":           time.Date(2024, 2, 29, 13, 14, 15, 0, time.UTC),
+		"2024-02-29 13:14:15.0":         time.Date(2024, 2, 29, 13, 14, 15, 0, time.UTC),
+		"2024-02-29 13:14:15.5":         time.Date(2024, 2, 29, 13, 14, 15, 500000000, time.UTC),
+		"2024-02-29 13:14:15.123":       time.Date(2024, 2, 29, 13, 14, 15, 123000000, time.UTC),
+		"2024-02-29 13:14:15.123456":    time.Date(2024, 2, 29, 13, 14, 15, 123456000, time.UTC),
+		"2024-02-29 13:14:15.000001":    time.Date(2024, 2, 29, 13, 14, 15, 1000, time.UTC),
+		"2024-02-29 13:14:15.123456789": time.Date(2024, 2, 29, 13, 14, 15, 123456789, time.UTC),
+		"2024-02-29 13:14:15.000000001": time.Date(2024, 2, 29, 13, 14, 15, 1, time.UTC),
+	}
+	for s, expected := range tests {
+		parsed, err := ParseTimestamp(s, nil)
+		if err != nil || !parsed.Equal(expected) {
+			t.Fatalf("Expected %s for %q, got %s (%v)", expected, s, parsed, err)
+		}
+	}
+
+	for _, s := range []string{"2024-02-29", "2024-02-29 13:14:15.1234567890", "2024-02-29 13:14:15.12a", "2024-02-29 13:14:15.-1", "2024-02-29 25:14:15"} {
+		if _, err := ParseTimestamp(s, nil); err == nil {
+			t.Fatalf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestParseTimestampLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	parsed, err := ParseTimestamp("2024-01-01 09:00:00.000000500", tokyo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2024, 1, 1, 0, 0, 0, 500, time.UTC); !parsed.Equal(expected) {
+		t.Fatalf("Expected %s, got %s", expected, parsed)
+	}
+	parsed, err = ParseTimestamp("2024-01-01 09:00:00.25 Asia/Tokyo", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2024, 1, 1, 0, 0, 0, 250000000, time.UTC); !parsed.Equal(expected) || parsed.Location().String() != "Asia/Tokyo" {
+		t.Fatalf("Expected %s in Asia/Tokyo, got %s", expected, parsed)
+	}
+}
+
+func TestTimestampPreserved(t *testing.T) {
+	values := []string{"2024-02-29 13:14:15.123456", "2024-02-29 13:14:15.123456789 UTC"}
+	cursor := &Cursor{
+		conn:        &Connection{configuration: NewConnectConfiguration()},
+		response:    &hiveserver.TFetchResultsResp{},
+		state:       _FINISHED,
+		description: [][]string{{"t.ts", "TIMESTAMP_TYPE"}, {"t.tsltz", "TIMESTAMPLOCALTZ_TYPE"}},
+		queue: []*hiveserver.TColumn{
+			{StringVal: &hiveserver.TStringColumn{Values: values[:1], Nulls: []byte{}}},
+			{StringVal: &hiveserver.TStringColumn{Values: values[1:], Nulls: []byte{}}},
+		},
+		totalRows: 1,
+	}
+	row := cursor.RowSlice(context.Background())
+	if cursor.Err != nil {
+		t.Fatal(cursor.Err)
+	}
+	if !reflect.DeepEqual(row, []interface{}{values[0], values[1]}) {
+		t.Fatalf("Expected the timestamps as sent by the server, got %v", row)
+	}
+	for i, value := range row {
+		parsed, err := ParseTimestamp(value.(string), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Nanosecond() != []int{123456000, 123456789}[i] {
+			t.Fatalf("Unexpected nanoseconds for %v: %d", value, parsed.Nanosecond())
+		}
+	}
+}
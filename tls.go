@@ -0,0 +1,63 @@
+package gohive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCertificatePinMismatch is the cause of the connection error when the certificate of the server doesn't match PinnedCertSHA256
+var ErrCertificatePinMismatch = errors.New("gohive: the certificate of the server doesn't match any pinned SHA-256 fingerprint")
+
+// parseCertificatePins decodes the hex fingerprints of PinnedCertSHA256, colons and case are ignored
+func parseCertificatePins(pins []string) ([][]byte, error) {
+	fingerprints := make([][]byte, 0, len(pins))
+	for _, pin := range pins {
+		fingerprint, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+		if err != nil || len(fingerprint) != sha256.Size {
+			return nil, errors.Errorf("Invalid pinned certificate SHA-256 fingerprint %q", pin)
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	return fingerprints, nil
+}
+
+// connectionTLSConfig returns the TLS configuration used to connect, nil for plain connections.
+// With PinnedCertSHA256 it's a copy of TLSConfig, or an empty one, that trusts the server certificate only if
+// its fingerprint is pinned instead of verifying its chain. The copy keeps the ClientSessionCache, and the pin
+// is checked in VerifyConnection as VerifyPeerCertificate isn't called when a session is resumed.
+func connectionTLSConfig(configuration *ConnectConfiguration) (*tls.Config, error) {
+	if len(configuration.PinnedCertSHA256) == 0 {
+		return configuration.TLSConfig, nil
+	}
+	fingerprints, err := parseCertificatePins(configuration.PinnedCertSHA256)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{}
+	if configuration.TLSConfig != nil {
+		tlsConfig = configuration.TLSConfig.Clone()
+	}
+	verifyConnection := tlsConfig.VerifyConnection
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.Wrap(ErrCertificatePinMismatch, "no certificate was presented")
+		}
+		fingerprint := sha256.Sum256(state.PeerCertificates[0].Raw)
+		for _, pinned := range fingerprints {
+			if bytes.Equal(fingerprint[:], pinned) {
+				if verifyConnection != nil {
+					return verifyConnection(state)
+				}
+				return nil
+			}
+		}
+		return errors.Wrapf(ErrCertificatePinMismatch, "presented %s", hex.EncodeToString(fingerprint[:]))
+	}
+	return tlsConfig, nil
+}
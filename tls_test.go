@@ -0,0 +1,57 @@
+package gohive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestPinnedCertSHA256(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	fingerprint := sha256.Sum256(server.Certificate().Raw)
+	pin := strings.ToUpper(hex.EncodeToString(fingerprint[:]))
+
+	configuration := NewConnectConfiguration()
+	configuration.PinnedCertSHA256 = []string{strings.Repeat("00", sha256.Size), pin[:2] + ":" + pin[2:]}
+	httpClient, protocol, err := getHTTPClient(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if protocol != "https" {
+		t.Fatalf("Expected https, got %s", protocol)
+	}
+	response, err := httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	configuration.PinnedCertSHA256 = []string{strings.Repeat("00", sha256.Size)}
+	httpClient, _, err = getHTTPClient(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = httpClient.Get(server.URL)
+	if !errors.Is(err, ErrCertificatePinMismatch) {
+		t.Fatalf("Expected ErrCertificatePinMismatch, got %v", err)
+	}
+}
+
+func TestPinnedCertSHA256Invalid(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.PinnedCertSHA256 = []string{"abc"}
+	if _, _, err := getHTTPClient(configuration); err == nil {
+		t.Fatal("Expected an error for an invalid fingerprint")
+	}
+	configuration.PinnedCertSHA256 = []string{strings.Repeat("00", sha256.Size)}
+	configuration.HTTPClient = &http.Client{}
+	if _, _, err := getHTTPClient(configuration); err == nil {
+		t.Fatal("Expected an error with a custom HTTPClient")
+	}
+}
@@ -0,0 +1,221 @@
+package gohive
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-data-exporter/gohive/hiveserver"
+)
+
+func TestHTTPEndpoint(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	if endpoint := httpEndpoint("http", "hs2.example.com", 10001, configuration, nil); endpoint != "http://hs2.example.com:10001/cliservice" {
+		t.Fatalf("Unexpected endpoint %s", endpoint)
+	}
+	configuration.HTTPPath = "gateway/cliservice?workload=analytics&x=%2F"
+	configuration.HTTPQueryParameters = url.Values{"pool": {"a b"}}
+	endpoint := httpEndpoint("https", "::1", 443, configuration, url.UserPassword("user", "p@ss"))
+	if endpoint != "https://user:p%40ss@[::1]:443/gateway/cliservice?workload=analytics&x=%2F&pool=a+b" {
+		t.Fatalf("Unexpected endpoint %s", endpoint)
+	}
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+	configuration.TransportMode = "http"
+	Connect(serverURL.Hostname(), port, "NONE", configuration)
+	if query.Get("workload") != "analytics" || query.Get("x") != "/" || query.Get("pool") != "a b" {
+		t.Fatalf("Unexpected query %v", query)
+	}
+}
+
+func TestGetHTTPClientCustom(t *testing.T) {
+	base := &http.Client{Timeout: 5 * time.Second}
+	configuration := NewConnectConfiguration()
+	configuration.HTTPClient = base
+	configuration.TLSConfig = &tls.Config{}
+	httpClient, protocol, err := getHTTPClient(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if protocol != "https" {
+		t.Fatalf("Expected https, got %s", protocol)
+	}
+	if httpClient == base || base.Transport != nil {
+		t.Fatal("The configured client shouldn't be modified")
+	}
+	if httpClient.Timeout != base.Timeout {
+		t.Fatalf("Expected timeout %v, got %v", base.Timeout, httpClient.Timeout)
+	}
+	if _, ok := httpClient.Transport.(*CookieDedupTransport); !ok {
+		t.Fatalf("Expected the transport to be wrapped, got %T", httpClient.Transport)
+	}
+}
+
+func TestRPCHookMiddleware(t *testing.T) {
+	type ctxKey struct{}
+	var calls []string
+	var endErr error
+	hook := func(ctx context.Context, rpc string) (context.Context, func(err error)) {
+		calls = append(calls, rpc)
+		return context.WithValue(ctx, ctxKey{}, rpc), func(err error) {
+			endErr = err
+		}
+	}
+	expectedErr := errors.New("failed")
+	inner := thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			if ctx.Value(ctxKey{}) != method {
+				t.Fatalf("The context returned by the hook wasn't used for %s", method)
+			}
+			return thrift.ResponseMeta{}, expectedErr
+		},
+	}
+	client := thrift.WrapClient(inner, rpcHookMiddleware(hook))
+	_, err := client.Call(context.Background(), "FetchResults", nil, nil)
+	if err != expectedErr || endErr != expectedErr {
+		t.Fatalf("Expected %v, got %v and %v", expectedErr, err, endErr)
+	}
+	if !reflect.DeepEqual(calls, []string{"FetchResults"}) {
+		t.Fatalf("Unexpected calls: %v", calls)
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	configuration := NewConnectConfiguration()
+	configuration.DefaultTimeout = time.Minute
+	connection := &Connection{configuration: configuration}
+
+	ctx, cancel := connection.withDefaultTimeout(context.Background())
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf("Expected a deadline within a minute, got %v", deadline)
+	}
+
+	explicit, explicitCancel := context.WithTimeout(context.Background(), time.Hour)
+	defer explicitCancel()
+	ctx, cancel = connection.withDefaultTimeout(explicit)
+	defer cancel()
+	if ctx != explicit {
+		t.Fatal("The deadline of the caller should take precedence")
+	}
+
+	configuration.DefaultTimeout = 0
+	ctx, cancel = connection.withDefaultTimeout(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("No deadline expected without a default timeout")
+	}
+}
+
+func TestTLSSessionResumption(t *testing.T) {
+	resumed := make(chan bool, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resumed <- r.TLS.DidResume
+	}))
+	server.StartTLS()
+	defer server.Close()
+	tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig
+	tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(8)
+
+	// http transport
+	configuration := NewConnectConfiguration()
+	configuration.TLSConfig = tlsConfig
+	configuration.DisableKeepAlives = true
+	for i := 0; i < 2; i++ {
+		httpClient, _, err := getHTTPClient(configuration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := httpClient.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if !<-resumed && i == 1 {
+			t.Fatal("The TLS session wasn't resumed by the http transport")
+		}
+	}
+
+	// binary transport
+	address := server.Listener.Addr().String()
+	for i := 0; i < 2; i++ {
+		socket := thrift.NewTSSLSocketConf(address, &thrift.TConfiguration{TLSConfig: tlsConfig})
+		if err := socket.Open(); err != nil {
+			t.Fatal(err)
+		}
+		// Read the response to a request so the session ticket sent after the handshake is processed
+		fmt.Fprintf(socket, "GET / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", address)
+		io.ReadAll(socket)
+		if !<-resumed && i == 1 {
+			t.Fatal("The TLS session wasn't resumed by the binary transport")
+		}
+		socket.Close()
+	}
+}
+
+func TestWithSocketTimeout(t *testing.T) {
+	host, port := startSilentServer(t)
+	socket := thrift.NewTSocketConf(fmt.Sprintf("%s:%d", host, port), &thrift.TConfiguration{})
+	if err := socket.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	protocol := thrift.NewTBinaryProtocolConf(socket, &thrift.TConfiguration{})
+	tClient := thrift.WrapClient(thrift.NewTStandardClient(protocol, protocol), socketTimeoutMiddleware(socket, 0))
+	client := hiveserver.NewTCLIServiceClient(tClient)
+
+	start := time.Now()
+	_, err := client.FetchResults(WithSocketTimeout(context.Background(), 100*time.Millisecond), hiveserver.NewTFetchResultsReq())
+	if err == nil {
+		t.Fatal("Expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("The call took %s with a socket timeout of 100ms", elapsed)
+	}
+}
+
+func TestSessionCookies(t *testing.T) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration := NewConnectConfiguration()
+	configuration.CookieJar = jar
+	httpClient, _, err := getHTTPClient(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if httpClient.Jar != jar {
+		t.Fatal("The configured cookie jar should be used")
+	}
+
+	endpoint := "http://hs2.example.com:10000/cliservice"
+	u, _ := url.Parse(endpoint)
+	jar.SetCookies(u, []*http.Cookie{{Name: "hive.server2.auth", Value: "token"}})
+	connection := &Connection{cookieJar: jar, cookieURL: endpoint}
+	cookies := connection.SessionCookies()
+	if len(cookies) != 1 || cookies[0].Value != "token" {
+		t.Fatalf("Unexpected cookies: %v", cookies)
+	}
+	if (&Connection{}).SessionCookies() != nil {
+		t.Fatal("Expected no cookies without the http transport")
+	}
+}
@@ -0,0 +1,50 @@
+package gohive
+
+import (
+	"context"
+	"regexp"
+)
+
+var applicationIDPattern = regexp.MustCompile(`\bapplication_\d+_\d+\b`)
+
+// resetApplicationIDs forgets the YARN application ids of the previous operation
+func (c *Cursor) resetApplicationIDs() {
+	c.applicationIDsLock.Lock()
+	defer c.applicationIDsLock.Unlock()
+	c.applicationIDs = nil
+}
+
+// recordApplicationIDs adds the YARN application ids found in the log lines to the ones of the operation
+func (c *Cursor) recordApplicationIDs(lines []string) {
+	c.applicationIDsLock.Lock()
+	defer c.applicationIDsLock.Unlock()
+	for _, line := range lines {
+	ids:
+		for _, id := range applicationIDPattern.FindAllString(line, -1) {
+			for _, known := range c.applicationIDs {
+				if id == known {
+					continue ids
+				}
+			}
+			c.applicationIDs = append(c.applicationIDs, id)
+		}
+	}
+}
+
+// ApplicationIDs returns the ids of the YARN applications, like application_1700000000000_0042, launched by the
+// latest operation for its MapReduce, Tez or Spark jobs, in the order they appear in its logs. The logs not read
+// yet are fetched, and the ones read before with FetchLogs, the Logs channel or StreamLogs are searched too.
+// It's best effort: the logs depend on hive.server2.logging.operation.level and are gone once the operation is closed.
+func (c *Cursor) ApplicationIDs(ctx context.Context) []string {
+	if c.operationHandle != nil {
+		for {
+			logs, err := c.fetchLogs(ctx)
+			if err != nil || len(logs) == 0 {
+				break
+			}
+		}
+	}
+	c.applicationIDsLock.Lock()
+	defer c.applicationIDsLock.Unlock()
+	return append([]string(nil), c.applicationIDs...)
+}
@@ -0,0 +1,49 @@
+package gohive
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRecordApplicationIDs(t *testing.T) {
+	cursor := &Cursor{}
+	cursor.recordApplicationIDs([]string{
+		"Starting Job = job_1700000000000_0001, Tracking URL = http://rm:8088/proxy/application_1700000000000_0001/",
+		"Kill Command = yarn application -kill application_1700000000000_0001",
+		"application_1700000000000_0002 and xapplication_1_2",
+	})
+	expected := []string{"application_1700000000000_0001", "application_1700000000000_0002"}
+	if !reflect.DeepEqual(cursor.applicationIDs, expected) {
+		t.Fatalf("Expected %v, got %v", expected, cursor.applicationIDs)
+	}
+	cursor.recordApplicationIDs(nil)
+	if len(cursor.applicationIDs) != 2 {
+		t.Fatalf("Expected the ids to be kept without lines, got %v", cursor.applicationIDs)
+	}
+	cursor.resetApplicationIDs()
+	if cursor.applicationIDs != nil {
+		t.Fatalf("Expected no ids, got %v", cursor.applicationIDs)
+	}
+}
+
+func TestApplicationIDs(t *testing.T) {
+	server := &operationHiveServer{logLines: 3, logFormat: "Status: Running (Executing on YARN cluster with App id application_1700000000000_%04d)"}
+	connection := connectFakeHiveServer(t, server, NewConnectConfiguration())
+	defer connection.Close()
+	cursor := connection.Cursor()
+	defer cursor.Close()
+	expected := []string{"application_1700000000000_0000", "application_1700000000000_0001", "application_1700000000000_0002"}
+	for i := 0; i < 2; i++ {
+		cursor.Exec(context.Background(), "INSERT INTO t SELECT * FROM s")
+		if cursor.Err != nil {
+			t.Fatal(cursor.Err)
+		}
+		if logs := cursor.FetchLogs(); len(logs) != 1 || cursor.Err != nil {
+			t.Fatalf("Expected a line of logs, got %v (%v)", logs, cursor.Err)
+		}
+		if ids := cursor.ApplicationIDs(context.Background()); !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("Expected %v, got %v", expected, ids)
+		}
+	}
+}
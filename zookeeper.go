@@ -0,0 +1,92 @@
+package gohive
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ZookeeperNodeParser returns the address of the HiveServer2 instance registered as a znode from its name and its
+// data. The znodes it returns an error for are skipped.
+type ZookeeperNodeParser func(name string, data []byte) (host string, port int, err error)
+
+// ParseZookeeperServerURI parses the names registered by HiveServer2, serverUri=host:port;version=...;sequence=...
+// The data isn't used. It's the parser used when ZookeeperNodeParser isn't set, which doesn't read the data.
+func ParseZookeeperServerURI(name string, data []byte) (string, int, error) {
+	nodes := parseHiveServer2Info([]string{name})
+	if len(nodes) == 0 {
+		return "", 0, errors.Errorf("The znode %s doesn't have a serverUri", name)
+	}
+	port, err := strconv.Atoi(nodes[0]["port"])
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "The znode %s has an invalid port", name)
+	}
+	return nodes[0]["host"], port, nil
+}
+
+// ParseZookeeperConfigs parses the data HiveServer2 publishes with hive.server2.zookeeper.publish.configs, its
+// configuration as key=value pairs separated by semicolons. The port is the one of hive.server2.transport.mode.
+func ParseZookeeperConfigs(name string, data []byte) (string, int, error) {
+	configs := make(map[string]string)
+	for _, param := range strings.Split(string(data), ";") {
+		if key, value, found := strings.Cut(param, "="); found {
+			configs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	portKey := "hive.server2.thrift.port"
+	if configs["hive.server2.transport.mode"] == "http" {
+		portKey = "hive.server2.thrift.http.port"
+	}
+	host := configs["hive.server2.thrift.bind.host"]
+	if host == "" {
+		return "", 0, errors.Errorf("The data of the znode %s doesn't have hive.server2.thrift.bind.host", name)
+	}
+	port, err := strconv.Atoi(configs[portKey])
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "The data of the znode %s has an invalid %s", name, portKey)
+	}
+	return host, port, nil
+}
+
+// ParseZookeeperJSON parses data encoded as a JSON object with the host in "host" or "address" and the port in
+// "port", for example the service instances registered with Curator
+func ParseZookeeperJSON(name string, data []byte) (string, int, error) {
+	var instance struct {
+		Host    string `json:"host"`
+		Address string `json:"address"`
+		Port    int    `json:"port"`
+	}
+	if err := json.Unmarshal(data, &instance); err != nil {
+		return "", 0, errors.Wrapf(err, "The data of the znode %s isn't JSON", name)
+	}
+	host := instance.Host
+	if host == "" {
+		host = instance.Address
+	}
+	if host == "" || instance.Port <= 0 {
+		return "", 0, errors.Errorf("The data of the znode %s doesn't have a host and a port", name)
+	}
+	return host, instance.Port, nil
+}
+
+// zookeeperNodes returns the servers registered as the children znodes, get reads the data of a child by its name
+func zookeeperNodes(children []string, get func(name string) ([]byte, error), parser ZookeeperNodeParser) []map[string]string {
+	if parser == nil {
+		return parseHiveServer2Info(children)
+	}
+	var nodes []map[string]string
+	for _, child := range children {
+		data, err := get(child)
+		if err != nil {
+			continue
+		}
+		host, port, err := parser(child, data)
+		if err != nil {
+			continue
+		}
+		nodes = append(nodes, map[string]string{"host": host, "port": strconv.Itoa(port)})
+	}
+	return nodes
+}
@@ -0,0 +1,65 @@
+package gohive
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestZookeeperNodeParsers(t *testing.T) {
+	tests := []struct {
+		parser ZookeeperNodeParser
+		name   string
+		data   string
+		host   string
+		port   int
+	}{
+		{ParseZookeeperServerURI, "serverUri=x1.test.io:10000;version=3.1.3;sequence=0000000001", "", "x1.test.io", 10000},
+		{ParseZookeeperServerURI, "serverUri=x1.test.io;sequence=0000000001", "", "", 0},
+		{ParseZookeeperConfigs, "instance-0000000001", "hive.server2.thrift.bind.host=x2.test.io;hive.server2.thrift.port=10001;hive.server2.transport.mode=binary", "x2.test.io", 10001},
+		{ParseZookeeperConfigs, "instance-0000000002", "hive.server2.thrift.bind.host=x2.test.io;hive.server2.thrift.http.port=10002;hive.server2.transport.mode=http", "x2.test.io", 10002},
+		{ParseZookeeperConfigs, "instance-0000000003", "hive.server2.thrift.port=10001", "", 0},
+		{ParseZookeeperJSON, "instance-0000000004", `{"name":"hiveserver2","address":"x3.test.io","port":10003}`, "x3.test.io", 10003},
+		{ParseZookeeperJSON, "instance-0000000005", `{"host":"x4.test.io","port":10004}`, "x4.test.io", 10004},
+		{ParseZookeeperJSON, "instance-0000000006", `{"host":"x4.test.io"}`, "", 0},
+		{ParseZookeeperJSON, "instance-0000000007", `serverUri=x4.test.io:10004`, "", 0},
+	}
+	for _, test := range tests {
+		host, port, err := test.parser(test.name, []byte(test.data))
+		if test.host == "" {
+			if err == nil {
+				t.Errorf("Expected an error for %s %q, got %s:%d", test.name, test.data, host, port)
+			}
+			continue
+		}
+		if err != nil || host != test.host || port != test.port {
+			t.Errorf("Expected %s:%d for %s %q, got %s:%d (%v)", test.host, test.port, test.name, test.data, host, port, err)
+		}
+	}
+}
+
+func TestZookeeperNodes(t *testing.T) {
+	data := map[string]string{
+		"instance-1": `{"address":"x1.test.io","port":10000}`,
+		"instance-2": `invalid`,
+		"instance-3": `{"address":"x3.test.io","port":10003}`,
+	}
+	get := func(name string) ([]byte, error) {
+		value, ok := data[name]
+		if !ok {
+			return nil, errors.New("no node")
+		}
+		return []byte(value), nil
+	}
+	nodes := zookeeperNodes([]string{"instance-1", "instance-2", "instance-3", "instance-4"}, get, ParseZookeeperJSON)
+	expected := []map[string]string{{"host": "x1.test.io", "port": "10000"}, {"host": "x3.test.io", "port": "10003"}}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Fatalf("Expected %v, got %v", expected, nodes)
+	}
+
+	// The names are parsed without reading the data by default
+	nodes = zookeeperNodes([]string{"serverUri=x1.test.io:10000;version=3.1.3"}, nil, nil)
+	if len(nodes) != 1 || nodes[0]["host"] != "x1.test.io" || nodes[0]["version"] != "3.1.3" {
+		t.Fatalf("Unexpected nodes %v", nodes)
+	}
+}